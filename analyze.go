@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"kanade/audio"
+	"kanade/config"
+	"kanade/downloader"
+	"kanade/library"
+	"kanade/loudness"
+)
+
+// runAnalyze is the headless "kanade analyze" command. It measures the
+// loudness of every song without ReplayGain values and returns the exit
+// code.
+func runAnalyze(cfg *config.Config, configDir string, args []string) int {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	depth := flags.Int("depth", cfg.Library.MaxDepth, "maximum directory depth to scan (-1 for unlimited)")
+	symlinks := flags.String("symlinks", cfg.Library.FollowSymlinks, "symlink policy: skip, files or all")
+	all := flags.Bool("all", false, "re-analyze songs that already have loudness values")
+	writeTags := flags.Bool("write-tags", false, "also write REPLAYGAIN_* tags into the files")
+	flags.Usage = func() {
+		fmt.Println("Usage: kanade analyze [flags] [directory...]")
+		fmt.Println("Measures EBU R128 loudness and true peak per track and album and stores")
+		fmt.Println("the ReplayGain values in the library index.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	symlinkPolicy, err := library.ParseSymlinkPolicy(*symlinks)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	roots, err := resolveRoots(flags.Args(), cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if ffmpegPath, ok := downloader.FindFFmpeg(roots[0]); ok {
+		audio.SetFFmpegPath(ffmpegPath)
+	} else if *writeTags {
+		fmt.Println("Error: ffmpeg is required for --write-tags")
+		return 1
+	}
+
+	index, err := library.OpenIndex(filepath.Join(configDir, "library.json"))
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	songLibrary := &library.Library{}
+	songLibrary.SetIndex(index)
+
+	songs, err := songLibrary.ReadRoots(roots, library.ScanOptions{
+		MaxDepth: *depth,
+		Symlinks: symlinkPolicy,
+	})
+	if err != nil {
+		fmt.Printf("Error reading directories: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Found %d songs\n", len(songs))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	options := loudness.Options{All: *all, WriteTags: *writeTags}
+	result, err := loudness.AnalyzeLibrary(ctx, songLibrary, options, func(p loudness.Progress) {
+		if p.Path != "" {
+			fmt.Printf("[%d/%d] %s\n", p.Done+1, p.Total, filepath.Base(p.Path))
+		}
+	})
+
+	fmt.Printf("Analyzed %d songs, %d failed\n", result.Analyzed, result.Failed)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
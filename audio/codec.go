@@ -0,0 +1,288 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/mp3"
+	"github.com/gopxl/beep/v2/vorbis"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+const sniffSize = 64
+
+type DecodeFunc func(file *os.File) (beep.StreamSeekCloser, beep.Format, error)
+
+// InfoFunc reads a file's stream info from its headers without decoding it.
+type InfoFunc func(r io.ReaderAt, size int64) (StreamInfo, error)
+
+type Codec struct {
+	Name       string
+	Extensions []string
+	MimeTypes  []string
+	Match      func(header []byte) bool
+	Decode     DecodeFunc
+	Info       InfoFunc
+}
+
+var codecs = struct {
+	mu   sync.RWMutex
+	list []*Codec
+}{}
+
+func init() {
+	RegisterCodec(&Codec{
+		Name:       "MP3",
+		Extensions: []string{".mp3"},
+		MimeTypes:  []string{"audio/mpeg"},
+		Match:      isMP3,
+		Decode: func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return mp3.Decode(file)
+		},
+		Info: readMP3Info,
+	})
+	RegisterCodec(&Codec{
+		Name:       "WAV",
+		Extensions: []string{".wav"},
+		MimeTypes:  []string{"audio/x-wav", "audio/wav"},
+		Match: func(header []byte) bool {
+			return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE"
+		},
+		Decode: func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return wav.Decode(file)
+		},
+		Info: readWAVInfo,
+	})
+	RegisterCodec(&Codec{
+		Name:       "FLAC",
+		Extensions: []string{".flac"},
+		MimeTypes:  []string{"audio/flac", "audio/x-flac"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("fLaC"))
+		},
+		Decode: func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return flac.Decode(file)
+		},
+		Info: readFLACInfo,
+	})
+	RegisterCodec(&Codec{
+		Name:       "Ogg Vorbis",
+		Extensions: []string{".ogg", ".oga"},
+		MimeTypes:  []string{"audio/ogg", "audio/vorbis"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("OggS")) && bytes.Contains(header, []byte("\x01vorbis"))
+		},
+		Decode: func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return vorbis.Decode(file)
+		},
+		Info: readOggInfo,
+	})
+	// The codecs below have no native decoder and are played through ffmpeg.
+	RegisterCodec(&Codec{
+		Name:       "Opus",
+		Extensions: []string{".opus"},
+		MimeTypes:  []string{"audio/opus"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("OggS")) && bytes.Contains(header, []byte("OpusHead"))
+		},
+		Info: readOggInfo,
+	})
+	RegisterCodec(&Codec{
+		Name:       "AAC",
+		Extensions: []string{".m4a", ".m4b", ".aac", ".alac"},
+		MimeTypes:  []string{"audio/mp4", "audio/aac"},
+		Match: func(header []byte) bool {
+			if len(header) >= 8 && string(header[4:8]) == "ftyp" {
+				return true
+			}
+			// ADTS frame sync with layer 0.
+			return len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0
+		},
+		Info: readMP4Info,
+	})
+	RegisterCodec(&Codec{
+		Name:       "AIFF",
+		Extensions: []string{".aif", ".aiff", ".aifc"},
+		MimeTypes:  []string{"audio/aiff", "audio/x-aiff"},
+		Match: func(header []byte) bool {
+			return len(header) >= 12 && string(header[0:4]) == "FORM" &&
+				(string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC")
+		},
+		Info: readAIFFInfo,
+	})
+	RegisterCodec(&Codec{
+		Name:       "WMA",
+		Extensions: []string{".wma"},
+		MimeTypes:  []string{"audio/x-ms-wma"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11})
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:       "Monkey's Audio",
+		Extensions: []string{".ape"},
+		MimeTypes:  []string{"audio/x-ape"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("MAC "))
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:       "WavPack",
+		Extensions: []string{".wv"},
+		MimeTypes:  []string{"audio/x-wavpack"},
+		Match: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("wvpk"))
+		},
+	})
+}
+
+func isMP3(header []byte) bool {
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		return true
+	}
+	// MPEG audio frame sync with a non-zero layer; ADTS AAC uses layer 0.
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0
+}
+
+func RegisterCodec(codec *Codec) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	codecs.list = append(codecs.list, codec)
+}
+
+func (c *Codec) CanDecode() bool {
+	return c.Decode != nil || FFmpegAvailable()
+}
+
+func (c *Codec) hasExtension(ext string) bool {
+	for _, e := range c.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func CodecForExtension(path string) *Codec {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil
+	}
+
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+
+	for _, codec := range codecs.list {
+		if codec.hasExtension(ext) {
+			return codec
+		}
+	}
+	return nil
+}
+
+func IsSupportedExtension(path string) bool {
+	codec := CodecForExtension(path)
+	return codec != nil && codec.CanDecode()
+}
+
+func MimeTypes() []string {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+
+	var types []string
+	for _, codec := range codecs.list {
+		if codec.CanDecode() {
+			types = append(types, codec.MimeTypes...)
+		}
+	}
+	return types
+}
+
+func DetectCodec(path string) (*Codec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return detectCodec(file, path)
+}
+
+// detectCodec prefers the codec named by the extension when the file's
+// leading bytes agree with it, then any codec whose magic bytes match, and
+// finally the extension alone for formats without a reliable signature.
+func detectCodec(file *os.File, path string) (*Codec, error) {
+	header := make([]byte, sniffSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	header = header[:n]
+
+	byExtension := CodecForExtension(path)
+	if byExtension != nil && byExtension.Match != nil && byExtension.Match(header) {
+		return byExtension, nil
+	}
+
+	codecs.mu.RLock()
+	for _, codec := range codecs.list {
+		if codec.Match != nil && codec.Match(header) {
+			codecs.mu.RUnlock()
+			return codec, nil
+		}
+	}
+	codecs.mu.RUnlock()
+
+	if byExtension != nil {
+		return byExtension, nil
+	}
+	return nil, fmt.Errorf("unsupported file format: %s", filepath.Ext(path))
+}
+
+func decodeFile(file *os.File, path string) (beep.StreamSeekCloser, beep.Format, error) {
+	codec, err := detectCodec(file, path)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	if !codec.CanDecode() {
+		return nil, beep.Format{}, fmt.Errorf("no decoder available for %s", codec.Name)
+	}
+
+	if codec.Decode == nil {
+		return decodeFileWithFFmpeg(file)
+	}
+
+	streamer, format, err := codec.Decode(file)
+	if err != nil {
+		if FFmpegAvailable() {
+			if streamer, format, ferr := decodeFileWithFFmpeg(file); ferr == nil {
+				return streamer, format, nil
+			}
+		}
+		return nil, beep.Format{}, fmt.Errorf("failed to decode %s: %w", codec.Name, err)
+	}
+	return streamer, format, nil
+}
+
+// Decode opens filePath with the same decoders the player uses, at the
+// file's own sample rate. The caller closes the streamer.
+func Decode(filePath string) (beep.StreamSeekCloser, beep.Format, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	streamer, format, err := decodeFile(file, filePath)
+	if err != nil {
+		file.Close()
+		return nil, beep.Format{}, err
+	}
+	return streamer, format, nil
+}
@@ -0,0 +1,86 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gopxl/beep/v2"
+)
+
+type FadeCurve int
+
+const (
+	FadeEqualPower FadeCurve = iota
+	FadeLinear
+)
+
+func (c FadeCurve) String() string {
+	if c == FadeLinear {
+		return "linear"
+	}
+	return "equal-power"
+}
+
+func ParseFadeCurve(s string) (FadeCurve, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "equal-power", "equal_power", "equalpower":
+		return FadeEqualPower, nil
+	case "linear":
+		return FadeLinear, nil
+	}
+	return FadeEqualPower, fmt.Errorf("unknown fade curve %q (use linear or equal-power)", s)
+}
+
+// gain maps fade progress x in [0, 1] to a gain for the incoming track.
+// The outgoing track uses gain(1 - x), which for the equal-power curve
+// keeps the summed loudness steady through the fade.
+func (c FadeCurve) gain(x float64) float64 {
+	x = math.Max(0, math.Min(1, x))
+	if c == FadeLinear {
+		return x
+	}
+	return math.Sin(x * math.Pi / 2)
+}
+
+// fadeEnvelope ramps a streamer in or out over total samples.
+type fadeEnvelope struct {
+	streamer beep.Streamer
+	curve    FadeCurve
+	fadeIn   bool
+	position int
+	total    int
+}
+
+func (e *fadeEnvelope) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = e.streamer.Stream(samples)
+	for i := range samples[:n] {
+		x := float64(e.position) / float64(e.total)
+		if !e.fadeIn {
+			x = 1 - x
+		}
+		g := e.curve.gain(x)
+		samples[i][0] *= g
+		samples[i][1] *= g
+		e.position++
+	}
+	return n, ok
+}
+
+func (e *fadeEnvelope) Err() error {
+	return e.streamer.Err()
+}
+
+// crossfade mixes the tail of one track with the head of the next.
+type crossfade struct {
+	mixer beep.Streamer
+}
+
+func newCrossfade(out, in beep.Streamer, samples int, curve FadeCurve) *crossfade {
+	return &crossfade{
+		mixer: beep.Mix(
+			beep.Take(samples, &fadeEnvelope{streamer: out, curve: curve, total: samples}),
+			beep.Take(samples, &fadeEnvelope{streamer: in, curve: curve, fadeIn: true, total: samples}),
+		),
+	}
+}
@@ -0,0 +1,274 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	EQBands    = 10
+	MaxEQGain  = 12.0
+	eqBandQ    = 1.41
+	eqFlatGain = 0.0
+)
+
+// EQFrequencies are the band centres in Hz, an octave apart.
+var EQFrequencies = [EQBands]float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+type EQGains [EQBands]float64
+
+func (g EQGains) IsFlat() bool {
+	for _, gain := range g {
+		if gain != eqFlatGain {
+			return false
+		}
+	}
+	return true
+}
+
+var eqPresets = struct {
+	mu      sync.RWMutex
+	presets map[string]EQGains
+}{
+	presets: map[string]EQGains{
+		"flat":       {},
+		"bass boost": {6, 5, 4, 2, 0, 0, 0, 0, 0, 0},
+		"treble":     {0, 0, 0, 0, 0, 1, 2, 4, 5, 6},
+		"vocal":      {-2, -2, -1, 1, 3, 4, 3, 1, 0, -1},
+		"rock":       {4, 3, 2, 0, -1, -1, 1, 2, 3, 4},
+		"pop":        {-1, 1, 3, 4, 3, 0, -1, -1, 1, 2},
+		"jazz":       {3, 2, 1, 2, -1, -1, 0, 1, 2, 3},
+		"classical":  {4, 3, 2, 1, 0, 0, 0, 1, 2, 3},
+		"electronic": {5, 4, 1, 0, -2, 1, 0, 1, 4, 5},
+		"loudness":   {5, 3, 0, 0, -1, 0, -1, 0, 3, 4},
+	},
+}
+
+// RegisterEQPreset adds or replaces a preset. User presets from the
+// config file are registered at startup.
+func RegisterEQPreset(name string, gains EQGains) {
+	eqPresets.mu.Lock()
+	defer eqPresets.mu.Unlock()
+	eqPresets.presets[strings.ToLower(name)] = gains
+}
+
+func EQPreset(name string) (EQGains, error) {
+	eqPresets.mu.RLock()
+	defer eqPresets.mu.RUnlock()
+
+	gains, ok := eqPresets.presets[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return EQGains{}, fmt.Errorf("unknown equalizer preset %q", name)
+	}
+	return gains, nil
+}
+
+// EQPresetNames lists presets alphabetically with flat first.
+func EQPresetNames() []string {
+	eqPresets.mu.RLock()
+	defer eqPresets.mu.RUnlock()
+
+	names := make([]string, 0, len(eqPresets.presets))
+	for name := range eqPresets.presets {
+		if name != "flat" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"flat"}, names...)
+}
+
+// peakingFilter is an RBJ peaking EQ biquad for one band and channel.
+type peakingFilter struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *peakingFilter) configure(frequency, gain, sampleRate float64) {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * frequency / sampleRate
+	alpha := math.Sin(w0) / (2 * eqBandQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha/a
+
+	f.b0 = (1 + alpha*a) / a0
+	f.b1 = -2 * cos / a0
+	f.b2 = (1 - alpha*a) / a0
+	f.a1 = -2 * cos / a0
+	f.a2 = (1 - alpha/a) / a0
+}
+
+func (f *peakingFilter) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// Equalizer is a ten band graphic EQ. It sits between the Ctrl and the
+// volume stage and keeps its settings across tracks. Bands set to 0 dB
+// are skipped, so a flat EQ costs nothing. Boosted bands are offset by a
+// preamp cut of the largest boost, so they can't push the signal into
+// clipping.
+type Equalizer struct {
+	mu         sync.Mutex
+	streamer   beep.Streamer
+	sampleRate float64
+	gains      EQGains
+	preset     string
+	filters    [EQBands][2]peakingFilter
+}
+
+func NewEqualizer() *Equalizer {
+	return &Equalizer{preset: "flat"}
+}
+
+func (e *Equalizer) setStreamer(s beep.Streamer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.streamer = s
+}
+
+func (e *Equalizer) setSampleRate(sampleRate beep.SampleRate) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sampleRate = float64(sampleRate)
+	for band := range e.gains {
+		e.configureUnsafe(band)
+	}
+}
+
+func (e *Equalizer) configureUnsafe(band int) {
+	if e.sampleRate == 0 {
+		return
+	}
+	for c := range e.filters[band] {
+		e.filters[band][c].configure(EQFrequencies[band], e.gains[band], e.sampleRate)
+	}
+}
+
+func (e *Equalizer) Gains() EQGains {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.gains
+}
+
+// Preset is the name of the preset in use, or "custom" once bands have
+// been changed by hand.
+func (e *Equalizer) Preset() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.preset
+}
+
+func (e *Equalizer) SetPreset(name string) error {
+	gains, err := EQPreset(name)
+	if err != nil {
+		return err
+	}
+	e.SetGains(gains)
+
+	e.mu.Lock()
+	e.preset = strings.ToLower(strings.TrimSpace(name))
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Equalizer) SetGains(gains EQGains) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.preset = "custom"
+	for band, gain := range gains {
+		e.setGainUnsafe(band, gain)
+	}
+}
+
+func (e *Equalizer) SetBand(band int, gain float64) error {
+	if band < 0 || band >= EQBands {
+		return fmt.Errorf("equalizer band %d out of range", band)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.preset = "custom"
+	e.setGainUnsafe(band, gain)
+	return nil
+}
+
+func (e *Equalizer) setGainUnsafe(band int, gain float64) {
+	previous := e.gains[band]
+	e.gains[band] = math.Max(-MaxEQGain, math.Min(MaxEQGain, gain))
+	// A flat band isn't run, so its filters still hold the samples from
+	// when it last was; picking up from them would click.
+	if (previous == eqFlatGain) != (e.gains[band] == eqFlatGain) {
+		for c := range e.filters[band] {
+			e.filters[band][c].z1, e.filters[band][c].z2 = 0, 0
+		}
+	}
+	e.configureUnsafe(band)
+}
+
+// Preamp is the gain in dB applied ahead of the bands, which is never
+// positive.
+func (e *Equalizer) Preamp() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.preampUnsafe()
+}
+
+func (e *Equalizer) preampUnsafe() float64 {
+	boost := 0.0
+	for band, gain := range e.gains {
+		if e.sampleRate == 0 || EQFrequencies[band] < e.sampleRate/2 {
+			boost = math.Max(boost, gain)
+		}
+	}
+	return -boost
+}
+
+func (e *Equalizer) Stream(samples [][2]float64) (n int, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.streamer == nil {
+		return 0, false
+	}
+	n, ok = e.streamer.Stream(samples)
+	if e.sampleRate == 0 {
+		return n, ok
+	}
+
+	if preamp := e.preampUnsafe(); preamp < 0 {
+		scale := math.Pow(10, preamp/20)
+		for i := range samples[:n] {
+			samples[i][0] *= scale
+			samples[i][1] *= scale
+		}
+	}
+	for band, gain := range e.gains {
+		// Bands at or above Nyquist can't be represented.
+		if gain == eqFlatGain || EQFrequencies[band] >= e.sampleRate/2 {
+			continue
+		}
+		filters := &e.filters[band]
+		for i := range samples[:n] {
+			samples[i][0] = filters[0].process(samples[i][0])
+			samples[i][1] = filters[1].process(samples[i][1])
+		}
+	}
+	return n, ok
+}
+
+func (e *Equalizer) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.streamer == nil {
+		return nil
+	}
+	return e.streamer.Err()
+}
@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+func sineStreamer(frequency float64) beep.Streamer {
+	phase := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			value := 0.5 * math.Sin(2*math.Pi*frequency*float64(phase)/float64(testSampleRate))
+			samples[i] = [2]float64{value, value}
+			phase++
+		}
+		return len(samples), true
+	})
+}
+
+func TestEqualizerRaisedBandStartsClean(t *testing.T) {
+	const band = 3
+
+	used := NewEqualizer()
+	used.setSampleRate(testSampleRate)
+	used.setStreamer(sineStreamer(250))
+	samples := make([][2]float64, 4096)
+
+	used.SetBand(band, 9)
+	used.Stream(samples)
+	used.SetBand(band, 0)
+	used.Stream(samples)
+
+	// Raised again, the band has to behave as if it had never run, rather
+	// than carry on from the samples it last saw.
+	used.SetBand(band, 6)
+	fresh := NewEqualizer()
+	fresh.setSampleRate(testSampleRate)
+	fresh.SetBand(band, 6)
+
+	input := make([][2]float64, 512)
+	sineStreamer(250).Stream(input)
+	used.setStreamer(beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		return copy(samples, input), true
+	}))
+	fresh.setStreamer(beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		return copy(samples, input), true
+	}))
+
+	got := make([][2]float64, len(input))
+	want := make([][2]float64, len(input))
+	used.Stream(got)
+	fresh.Stream(want)
+	for i := range got {
+		if math.Abs(got[i][0]-want[i][0]) > 1e-12 {
+			t.Fatalf("sample %d = %v after raising the band again, want %v", i, got[i][0], want[i][0])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventTrackLoaded EventType = iota
+	EventStarted
+	EventPaused
+	EventStopped
+	EventSeeked
+	EventVolumeChanged
+	EventSpeedChanged
+	EventFinished
+	EventError
+	EventMetadata
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTrackLoaded:
+		return "track loaded"
+	case EventStarted:
+		return "started"
+	case EventPaused:
+		return "paused"
+	case EventStopped:
+		return "stopped"
+	case EventSeeked:
+		return "seeked"
+	case EventVolumeChanged:
+		return "volume changed"
+	case EventSpeedChanged:
+		return "speed changed"
+	case EventFinished:
+		return "finished"
+	case EventError:
+		return "error"
+	case EventMetadata:
+		return "metadata"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change in the player's state. Fields that don't
+// apply to the event type are left zero.
+type Event struct {
+	Type     EventType
+	Path     string
+	Position time.Duration
+	Length   time.Duration
+	Volume   float64
+	Speed    float64
+	// Continued marks a TrackLoaded event for a track the player moved on
+	// to by itself, gaplessly or through a crossfade.
+	Continued bool
+	// Title is what a live stream says is playing, on Metadata events.
+	Title string
+	Err   error
+}
+
+// eventBacklog is how many events a subscriber can have waiting. Past it
+// the oldest are dropped, so a subscriber that stops reading costs a fixed
+// amount of memory.
+const eventBacklog = 64
+
+// coalesces reports whether the event only reports the latest value of
+// something, such as the volume, so that a newer one makes any still
+// queued for the subscriber pointless.
+func (t EventType) coalesces() bool {
+	switch t {
+	case EventSeeked, EventVolumeChanged, EventSpeedChanged, EventMetadata:
+		return true
+	}
+	return false
+}
+
+// eventBus fans events out to subscribers. Publishing never blocks, since
+// events are also published from the output's goroutine; each subscriber
+// has its own queue, drained into its channel by a goroutine.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[int]*subscriber
+	nextID      int
+}
+
+type subscriber struct {
+	events chan Event
+	queue  []Event
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[int]*subscriber)
+	}
+	id := b.nextID
+	b.nextID++
+	sub := &subscriber{
+		events: make(chan Event),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	b.subscribers[id] = sub
+	go b.deliver(sub)
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if sub, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(sub.done)
+		}
+	}
+	return sub.events, unsubscribe
+}
+
+// deliver hands a subscriber its queued events in order, and closes its
+// channel once it unsubscribes.
+func (b *eventBus) deliver(sub *subscriber) {
+	defer close(sub.events)
+
+	for {
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return
+		}
+
+		for {
+			b.mu.Lock()
+			if len(sub.queue) == 0 {
+				b.mu.Unlock()
+				break
+			}
+			event := sub.queue[0]
+			sub.queue = sub.queue[1:]
+			b.mu.Unlock()
+
+			select {
+			case sub.events <- event:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscribers {
+		if event.Type.coalesces() {
+			// The newer value goes to the back, so it still comes after
+			// anything published before it.
+			sub.queue = slices.DeleteFunc(sub.queue, func(queued Event) bool {
+				return queued.Type == event.Type
+			})
+		}
+		sub.queue = append(sub.queue, event)
+		if len(sub.queue) > eventBacklog {
+			sub.queue = slices.Delete(sub.queue, 0, len(sub.queue)-eventBacklog)
+		}
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, sub := range b.subscribers {
+		delete(b.subscribers, id)
+		close(sub.done)
+	}
+}
@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusKeepsStateChangesForSlowSubscribers(t *testing.T) {
+	var bus eventBus
+	events, unsubscribe := bus.subscribe()
+	defer unsubscribe()
+
+	bus.publish(Event{Type: EventStarted})
+	for i := range 1000 {
+		bus.publish(Event{Type: EventVolumeChanged, Volume: float64(i)})
+	}
+	bus.publish(Event{Type: EventFinished, Path: "a"})
+	bus.publish(Event{Type: EventTrackLoaded, Path: "b"})
+
+	var got []Event
+	timeout := time.After(5 * time.Second)
+	for len(got) == 0 || got[len(got)-1].Type != EventTrackLoaded {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("timed out after %d events", len(got))
+		}
+	}
+
+	if got[0].Type != EventStarted {
+		t.Errorf("first event = %v, want started", got[0].Type)
+	}
+	if finished := got[len(got)-2]; finished.Type != EventFinished || finished.Path != "a" {
+		t.Errorf("event before the last = %+v, want finished a", finished)
+	}
+	volumes := got[1 : len(got)-2]
+	for _, event := range volumes {
+		if event.Type != EventVolumeChanged {
+			t.Fatalf("got %v between the volume changes", event.Type)
+		}
+	}
+	// One may already be on its way; the rest collapse into the latest.
+	if len(volumes) == 0 || len(volumes) > 2 {
+		t.Errorf("%d volume events delivered, want 1 or 2", len(volumes))
+	} else if last := volumes[len(volumes)-1].Volume; last != 999 {
+		t.Errorf("last volume delivered = %v, want 999", last)
+	}
+}
+
+func TestEventBusDropsOldestWhenFull(t *testing.T) {
+	var bus eventBus
+	events, unsubscribe := bus.subscribe()
+	defer unsubscribe()
+
+	for i := range 1000 {
+		bus.publish(Event{Type: EventPaused, Position: time.Duration(i)})
+	}
+
+	var got []Event
+	timeout := time.After(5 * time.Second)
+	for len(got) == 0 || got[len(got)-1].Position != 999 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("timed out after %d events", len(got))
+		}
+	}
+
+	// One event may already be on its way when the queue fills up.
+	if len(got) > eventBacklog+2 {
+		t.Errorf("%d events delivered, want at most %d", len(got), eventBacklog+2)
+	}
+	tail := got[len(got)-eventBacklog:]
+	for i, event := range tail {
+		if want := time.Duration(1000 - eventBacklog + i); event.Position != want {
+			t.Fatalf("event %d of the last %d has position %d, want %d", i, eventBacklog, event.Position, want)
+		}
+	}
+}
+
+func TestEventBusUnsubscribeClosesChannel(t *testing.T) {
+	var bus eventBus
+	events, unsubscribe := bus.subscribe()
+
+	bus.publish(Event{Type: EventStarted})
+	unsubscribe()
+	unsubscribe()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel not closed after unsubscribing")
+		}
+	}
+}
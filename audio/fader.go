@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// fader scales the player's output by a level that can ramp over time,
+// independent of the volume setting. The level goes through a cubic curve
+// so a linear ramp sounds like an even fade rather than a sudden drop at
+// the end.
+type fader struct {
+	mu       sync.Mutex
+	streamer beep.Streamer
+	level    float64
+	target   float64
+	step     float64
+	// reached is closed once the level gets to the target. drained is set
+	// when the streamer has run out, after which nothing reaches it.
+	reached chan struct{}
+	drained bool
+}
+
+func newFader() *fader {
+	return &fader{level: 1, target: 1}
+}
+
+func (f *fader) setStreamer(streamer beep.Streamer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.streamer = streamer
+	f.drained = false
+}
+
+// fadeTo ramps the level to target over the given number of samples, or
+// jumps there when samples is zero. The returned channel is closed when
+// the last sample of the ramp has been streamed.
+func (f *fader) fadeTo(target float64, samples int) <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.signalReached()
+	f.reached = make(chan struct{})
+	f.target = target
+	if samples <= 0 || f.drained || f.streamer == nil {
+		f.level = target
+		f.step = 0
+	} else {
+		f.step = (target - f.level) / float64(samples)
+	}
+
+	reached := f.reached
+	if f.level == f.target {
+		f.signalReached()
+	}
+	return reached
+}
+
+func (f *fader) signalReached() {
+	if f.reached != nil {
+		close(f.reached)
+		f.reached = nil
+	}
+}
+
+func (f *fader) Stream(samples [][2]float64) (n int, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.streamer == nil {
+		return 0, false
+	}
+	n, ok = f.streamer.Stream(samples)
+	if !ok {
+		f.drained = true
+		f.level = f.target
+		f.signalReached()
+	}
+	if f.level == 1 && f.target == 1 {
+		return n, ok
+	}
+
+	for i := range samples[:n] {
+		if f.level != f.target {
+			f.level += f.step
+			if (f.step > 0 && f.level >= f.target) || (f.step < 0 && f.level <= f.target) {
+				f.level = f.target
+				f.signalReached()
+			}
+		}
+		gain := f.level * f.level * f.level
+		samples[i][0] *= gain
+		samples[i][1] *= gain
+	}
+	return n, ok
+}
+
+func (f *fader) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.streamer == nil {
+		return nil
+	}
+	return f.streamer.Err()
+}
@@ -0,0 +1,310 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	ffmpegSampleRate = beep.SampleRate(44100)
+	ffmpegChannels   = 2
+	ffmpegFrameSize  = 2 * ffmpegChannels
+)
+
+var (
+	durationPattern = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	bitratePattern  = regexp.MustCompile(`bitrate: (\d+) kb/s`)
+	streamPattern   = regexp.MustCompile(`Audio: [^\n]*?, (\d+) Hz, ([^,\n]+)`)
+)
+
+var ffmpeg = struct {
+	mu   sync.RWMutex
+	path string
+}{}
+
+func SetFFmpegPath(path string) {
+	ffmpeg.mu.Lock()
+	defer ffmpeg.mu.Unlock()
+	ffmpeg.path = path
+}
+
+func FFmpegPath() string {
+	ffmpeg.mu.RLock()
+	defer ffmpeg.mu.RUnlock()
+	return ffmpeg.path
+}
+
+func FFmpegAvailable() bool {
+	return FFmpegPath() != ""
+}
+
+type ffmpegStreamer struct {
+	mu         sync.Mutex
+	ffmpegPath string
+	filePath   string
+	length     int
+	position   int
+
+	// stdin feeds ffmpeg when it reads from a pipe rather than a file.
+	stdin io.Reader
+
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	reader *bufio.Reader
+	buf    []byte
+	err    error
+}
+
+// decodeWithFFmpeg pipes the file through ffmpeg as raw 16-bit stereo PCM.
+// ffmpeg can't seek within a pipe, so seeking restarts it at the new offset.
+func decodeWithFFmpeg(filePath string) (beep.StreamSeekCloser, beep.Format, error) {
+	ffmpegPath := FFmpegPath()
+	if ffmpegPath == "" {
+		return nil, beep.Format{}, fmt.Errorf("ffmpeg is not available")
+	}
+
+	info, err := probeWithFFmpeg(ffmpegPath, filePath)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	s := &ffmpegStreamer{
+		ffmpegPath: ffmpegPath,
+		filePath:   filePath,
+		length:     ffmpegSampleRate.N(info.Duration),
+	}
+	if err := s.start(0); err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	format := beep.Format{
+		SampleRate:  ffmpegSampleRate,
+		NumChannels: ffmpegChannels,
+		Precision:   2,
+	}
+	return s, format, nil
+}
+
+func probeWithFFmpeg(ffmpegPath, filePath string) (StreamInfo, error) {
+	cmd := exec.Command(ffmpegPath, "-hide_banner", "-nostdin", "-i", filePath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Without an output file ffmpeg always exits with an error after
+	// printing the input summary, so only the output matters here.
+	_ = cmd.Run()
+	output := stderr.Bytes()
+
+	match := durationPattern.FindSubmatch(output)
+	if match == nil {
+		return StreamInfo{}, fmt.Errorf("ffmpeg could not read duration of %s", filePath)
+	}
+
+	hours, _ := strconv.Atoi(string(match[1]))
+	minutes, _ := strconv.Atoi(string(match[2]))
+	seconds, _ := strconv.ParseFloat(string(match[3]), 64)
+
+	info := StreamInfo{
+		Duration: time.Duration(hours)*time.Hour +
+			time.Duration(minutes)*time.Minute +
+			time.Duration(seconds*float64(time.Second)),
+	}
+
+	if match := bitratePattern.FindSubmatch(output); match != nil {
+		info.Bitrate, _ = strconv.Atoi(string(match[1]))
+	}
+	if match := streamPattern.FindSubmatch(output); match != nil {
+		info.SampleRate, _ = strconv.Atoi(string(match[1]))
+		info.Channels = parseChannelLayout(string(match[2]))
+	}
+
+	return info, nil
+}
+
+func parseChannelLayout(layout string) int {
+	layout = strings.TrimSpace(layout)
+	switch {
+	case layout == "mono":
+		return 1
+	case layout == "stereo":
+		return 2
+	case strings.HasSuffix(layout, " channels"):
+		n, _ := strconv.Atoi(strings.TrimSuffix(layout, " channels"))
+		return n
+	}
+
+	// Layouts such as "5.1(side)" or "7.1" count the LFE after the dot.
+	layout, _, _ = strings.Cut(layout, "(")
+	main, lfe, found := strings.Cut(layout, ".")
+	channels, err := strconv.Atoi(main)
+	if err != nil {
+		return 0
+	}
+	if found {
+		extra, _ := strconv.Atoi(lfe)
+		channels += extra
+	}
+	return channels
+}
+
+func (s *ffmpegStreamer) start(position int) error {
+	offset := ffmpegSampleRate.D(position).Seconds()
+
+	cmd := exec.Command(s.ffmpegPath,
+		"-hide_banner", "-nostdin", "-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", s.filePath,
+		"-vn", "-f", "s16le", "-acodec", "pcm_s16le",
+		"-ac", strconv.Itoa(ffmpegChannels),
+		"-ar", strconv.Itoa(int(ffmpegSampleRate)),
+		"-",
+	)
+	if s.stdin != nil {
+		cmd.Stdin = s.stdin
+		// ffmpeg exits before its input does; don't wait on the copy.
+		cmd.WaitDelay = time.Second
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open ffmpeg output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	s.cmd = cmd
+	s.stdout = stdout
+	s.reader = bufio.NewReaderSize(stdout, 64*1024)
+	s.position = position
+	s.err = nil
+	return nil
+}
+
+func (s *ffmpegStreamer) stop() {
+	if s.cmd == nil {
+		return
+	}
+	s.stdout.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.cmd.Wait()
+	s.cmd = nil
+	s.stdout = nil
+	s.reader = nil
+}
+
+func (s *ffmpegStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reader == nil {
+		return 0, false
+	}
+
+	need := len(samples) * ffmpegFrameSize
+	if cap(s.buf) < need {
+		s.buf = make([]byte, need)
+	}
+	buf := s.buf[:need]
+
+	read, err := io.ReadFull(s.reader, buf)
+	n = read / ffmpegFrameSize
+	for i := 0; i < n; i++ {
+		frame := buf[i*ffmpegFrameSize:]
+		samples[i][0] = float64(int16(binary.LittleEndian.Uint16(frame[0:]))) / 32768
+		samples[i][1] = float64(int16(binary.LittleEndian.Uint16(frame[2:]))) / 32768
+	}
+	s.position += n
+
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.err = fmt.Errorf("ffmpeg read failed: %w", err)
+		}
+		s.stop()
+		return n, n > 0
+	}
+	return n, true
+}
+
+func (s *ffmpegStreamer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *ffmpegStreamer) Len() int {
+	return s.length
+}
+
+func (s *ffmpegStreamer) Position() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.position
+}
+
+func (s *ffmpegStreamer) Seek(p int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p < 0 || p > s.length {
+		return fmt.Errorf("seek position %d out of range [0, %d]", p, s.length)
+	}
+
+	s.stop()
+	return s.start(p)
+}
+
+func (s *ffmpegStreamer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+	return nil
+}
+
+// decodeReaderWithFFmpeg pipes r through ffmpeg, for streams in formats
+// without a native decoder. The result can't seek.
+func decodeReaderWithFFmpeg(r io.Reader) (beep.StreamSeekCloser, beep.Format, error) {
+	ffmpegPath := FFmpegPath()
+	if ffmpegPath == "" {
+		return nil, beep.Format{}, fmt.Errorf("ffmpeg is not available")
+	}
+
+	s := &ffmpegStreamer{
+		ffmpegPath: ffmpegPath,
+		filePath:   "pipe:0",
+		stdin:      r,
+	}
+	if err := s.start(0); err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	format := beep.Format{
+		SampleRate:  ffmpegSampleRate,
+		NumChannels: ffmpegChannels,
+		Precision:   2,
+	}
+	return s, format, nil
+}
+
+func decodeFileWithFFmpeg(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+	streamer, format, err := decodeWithFFmpeg(file.Name())
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	// ffmpeg opens the file itself, so the handle is no longer needed.
+	file.Close()
+	return streamer, format, nil
+}
@@ -0,0 +1,214 @@
+package audio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// preparedTrack is a decoded track at the speaker's sample rate, ready to
+// be played or spliced in after the current one.
+type preparedTrack struct {
+	path     string
+	streamer *positionStreamer
+	format   beep.Format
+	length   time.Duration
+	// gapless tracks are spliced in directly, never crossfaded.
+	gapless bool
+	// ffmpeg is set when the track is decoded by ffmpeg, which has to be
+	// restarted to seek.
+	ffmpeg   bool
+	loudness Loudness
+	gain     *gainStreamer
+	// stream is set when the track is a live stream.
+	stream *httpStream
+}
+
+// trackChange records the gapless source moving from one track to the
+// next.
+type trackChange struct {
+	track    *preparedTrack
+	previous beep.StreamSeekCloser
+}
+
+// gaplessSource feeds the speaker from the current track and, when that
+// runs dry, continues with the next one inside the same buffer. It runs
+// on the speaker goroutine, so it only takes its own lock and leaves the
+// player to pick up changes through takeChanges.
+type gaplessSource struct {
+	mu      sync.Mutex
+	current *positionStreamer
+	path    string
+	next    *preparedTrack
+	changes []trackChange
+	// onAdvance is called on the speaker goroutine when the next track
+	// takes over.
+	onAdvance func(track *preparedTrack)
+
+	fadeSamples int
+	curve       FadeCurve
+	fade        *crossfade
+}
+
+func newGaplessSource(track *preparedTrack, fadeSamples int, curve FadeCurve) *gaplessSource {
+	return &gaplessSource{current: track.streamer, path: track.path, fadeSamples: fadeSamples, curve: curve}
+}
+
+func (s *gaplessSource) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n < len(samples) {
+		if s.fade != nil {
+			streamed, _ := s.fade.mixer.Stream(samples[n:])
+			n += streamed
+			if n == len(samples) {
+				break
+			}
+			s.advance()
+			continue
+		}
+
+		chunk := samples[n:]
+		untilFade, fading := s.samplesUntilFade()
+		if fading {
+			if untilFade <= 0 {
+				s.startFade()
+				continue
+			}
+			chunk = chunk[:min(len(chunk), untilFade)]
+		}
+
+		streamed, _ := s.current.Stream(chunk)
+		n += streamed
+		if streamed == len(chunk) {
+			continue
+		}
+
+		// A short read means the current track is drained.
+		if s.next == nil {
+			return n, n > 0
+		}
+		s.advance()
+	}
+
+	return n, true
+}
+
+// samplesUntilFade reports how many samples of the current track remain
+// before a crossfade into the next one should begin.
+func (s *gaplessSource) samplesUntilFade() (int, bool) {
+	// A live stream has no end to fade from.
+	if s.fadeSamples <= 0 || s.next == nil || s.next.gapless || s.current.looping() || s.current.Len() <= 0 {
+		return 0, false
+	}
+	remaining := s.current.Len() - s.current.Position()
+	return remaining - s.fadeLength(), true
+}
+
+func (s *gaplessSource) fadeLength() int {
+	remaining := s.current.Len() - s.current.Position()
+	return max(min(s.fadeSamples, remaining, s.next.streamer.Len()/2), 0)
+}
+
+func (s *gaplessSource) startFade() {
+	length := s.fadeLength()
+	if length == 0 {
+		// Nothing left to blend; drop straight into the next track.
+		s.advance()
+		return
+	}
+	s.fade = newCrossfade(s.current, s.next.streamer, length, s.curve)
+}
+
+func (s *gaplessSource) advance() {
+	s.changes = append(s.changes, trackChange{
+		track:    s.next,
+		previous: s.current,
+	})
+	track := s.next
+	s.current = track.streamer
+	s.path = track.path
+	s.next = nil
+	s.fade = nil
+	if s.onAdvance != nil {
+		s.onAdvance(track)
+	}
+}
+
+func (s *gaplessSource) setCrossfade(fadeSamples int, curve FadeCurve) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fadeSamples = fadeSamples
+	s.curve = curve
+}
+
+// cancelFade abandons a crossfade in progress, rewinding the next track
+// so it starts cleanly later. Seeking calls this.
+func (s *gaplessSource) cancelFade() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fade == nil {
+		return
+	}
+	s.fade = nil
+	if s.next != nil {
+		s.next.streamer.Seek(0)
+	}
+}
+
+func (s *gaplessSource) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Err()
+}
+
+// setNext replaces the queued track and returns the one it replaced.
+func (s *gaplessSource) setNext(track *preparedTrack) *preparedTrack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.next
+	s.next = track
+	s.fade = nil
+	return previous
+}
+
+func (s *gaplessSource) nextTrack() *preparedTrack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+func (s *gaplessSource) hasNext() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next != nil
+}
+
+func (s *gaplessSource) currentPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.path
+}
+
+func (s *gaplessSource) nextPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == nil {
+		return ""
+	}
+	return s.next.path
+}
+
+func (s *gaplessSource) takeChanges() []trackChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes := s.changes
+	s.changes = nil
+	return changes
+}
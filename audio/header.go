@@ -0,0 +1,583 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The readers below take a file's stream info from its container headers
+// alone, so scanning a library never decodes audio or starts ffmpeg. The
+// bitrate is worked out from the size of the audio itself, leaving out
+// tags and embedded cover art.
+
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if read == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+func payloadInfo(info StreamInfo, payload int64) StreamInfo {
+	if seconds := info.Duration.Seconds(); seconds > 0 && payload > 0 {
+		info.Bitrate = int(float64(payload) * 8 / seconds / 1000)
+	}
+	return info
+}
+
+func samplesDuration(samples uint64, rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(rate) * float64(time.Second))
+}
+
+var (
+	mp3Bitrates = [2][3][15]int{
+		// MPEG-1 layers I, II and III.
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		// MPEG-2 and 2.5 layers I, II and III.
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	length     int
+}
+
+func (f mp3Frame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && !f.mpeg1:
+		return 576
+	}
+	return 1152
+}
+
+func parseMP3Frame(header []byte) (mp3Frame, bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := header[1] >> 3 & 0x03
+	layerBits := header[1] >> 1 & 0x03
+	bitrateIndex := header[2] >> 4
+	rateIndex := header[2] >> 2 & 0x03
+	if version == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{
+		mpeg1:      version == 3,
+		layer:      4 - int(layerBits),
+		sampleRate: mp3SampleRates[rateIndex],
+		channels:   2,
+	}
+	table := 1
+	if frame.mpeg1 {
+		table = 0
+	}
+	frame.bitrate = mp3Bitrates[table][frame.layer-1][bitrateIndex]
+	switch version {
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+	if header[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	padding := int(header[2] >> 1 & 0x01)
+	switch {
+	case frame.layer == 1:
+		frame.length = (12*frame.bitrate*1000/frame.sampleRate + padding) * 4
+	case frame.layer == 3 && !frame.mpeg1:
+		frame.length = 72*frame.bitrate*1000/frame.sampleRate + padding
+	default:
+		frame.length = 144*frame.bitrate*1000/frame.sampleRate + padding
+	}
+	return frame, true
+}
+
+// id3v2Size returns the length of an ID3v2 tag at offset, or zero.
+func id3v2Size(r io.ReaderAt, offset int64) int64 {
+	header, err := readAt(r, offset, 10)
+	if err != nil || string(header[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// trailingTagsSize returns the length of the ID3v1 and APEv2 tags at the
+// end of a file.
+func trailingTagsSize(r io.ReaderAt, size int64) int64 {
+	var tags int64
+	if tag, err := readAt(r, size-128, 3); err == nil && string(tag) == "TAG" {
+		tags += 128
+	}
+	if footer, err := readAt(r, size-tags-32, 32); err == nil && string(footer[:8]) == "APETAGEX" {
+		tags += int64(binary.LittleEndian.Uint32(footer[12:16]))
+		if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+			tags += 32
+		}
+	}
+	return tags
+}
+
+const mp3SearchSize = 64 * 1024
+
+func readMP3Info(r io.ReaderAt, size int64) (StreamInfo, error) {
+	start := int64(0)
+	for {
+		tag := id3v2Size(r, start)
+		if tag == 0 {
+			break
+		}
+		start += tag
+	}
+
+	window := make([]byte, min(mp3SearchSize, max(size-start, 0)))
+	n, _ := r.ReadAt(window, start)
+	window = window[:n]
+
+	// A frame only counts when the next one follows it, since sync bits
+	// also turn up inside leftover tag data.
+	var frame mp3Frame
+	offset := -1
+	for i := 0; i+4 <= len(window); i++ {
+		f, ok := parseMP3Frame(window[i:])
+		if !ok {
+			continue
+		}
+		next := make([]byte, 4)
+		if _, err := r.ReadAt(next, start+int64(i+f.length)); err == nil {
+			if g, ok := parseMP3Frame(next); !ok || g.sampleRate != f.sampleRate {
+				continue
+			}
+		}
+		frame, offset = f, i
+		break
+	}
+	if offset < 0 {
+		return StreamInfo{}, fmt.Errorf("no MPEG audio frame found")
+	}
+
+	audioStart := start + int64(offset)
+	payload := size - trailingTagsSize(r, size) - audioStart
+	info := StreamInfo{SampleRate: frame.sampleRate, Channels: frame.channels}
+
+	// A Xing, Info or VBRI header in the first frame counts the frames and
+	// bytes of a variable bitrate file.
+	sideInfo := 17
+	switch {
+	case frame.mpeg1 && frame.channels == 2:
+		sideInfo = 32
+	case !frame.mpeg1 && frame.channels == 1:
+		sideInfo = 9
+	}
+	var frames, bytesCount uint32
+	if xing, err := readAt(r, audioStart+4+int64(sideInfo), 16); err == nil &&
+		(string(xing[:4]) == "Xing" || string(xing[:4]) == "Info") {
+		flags := binary.BigEndian.Uint32(xing[4:8])
+		field := 8
+		if flags&0x01 != 0 {
+			frames = binary.BigEndian.Uint32(xing[field : field+4])
+			field += 4
+		}
+		if flags&0x02 != 0 {
+			bytesCount = binary.BigEndian.Uint32(xing[field : field+4])
+		}
+	} else if vbri, err := readAt(r, audioStart+36, 18); err == nil && string(vbri[:4]) == "VBRI" {
+		bytesCount = binary.BigEndian.Uint32(vbri[10:14])
+		frames = binary.BigEndian.Uint32(vbri[14:18])
+	}
+
+	if frames > 0 {
+		info.Duration = samplesDuration(uint64(frames)*uint64(frame.samples()), frame.sampleRate)
+		if bytesCount > 0 {
+			payload = int64(bytesCount)
+		}
+		return payloadInfo(info, payload), nil
+	}
+
+	info.Bitrate = frame.bitrate
+	info.Duration = time.Duration(float64(payload) * 8 / float64(frame.bitrate*1000) * float64(time.Second))
+	return info, nil
+}
+
+func readWAVInfo(r io.ReaderAt, size int64) (StreamInfo, error) {
+	var info StreamInfo
+	var byteRate uint32
+	for offset := int64(12); offset+8 <= size; {
+		chunk, err := readAt(r, offset, 8)
+		if err != nil {
+			return StreamInfo{}, err
+		}
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			format, err := readAt(r, offset+8, 16)
+			if err != nil {
+				return StreamInfo{}, fmt.Errorf("failed to read fmt chunk: %w", err)
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+		case "data":
+			if byteRate == 0 {
+				return StreamInfo{}, fmt.Errorf("data chunk before fmt chunk")
+			}
+			// Streamed recordings leave the length unset.
+			length = min(length, size-offset-8)
+			info.Duration = time.Duration(float64(length) / float64(byteRate) * float64(time.Second))
+			info.Bitrate = int(byteRate) * 8 / 1000
+			return info, nil
+		}
+		offset += 8 + length + length%2
+	}
+	return StreamInfo{}, fmt.Errorf("no data chunk found")
+}
+
+// extendedFloat decodes the 80-bit float AIFF stores its sample rate in.
+func extendedFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7FFF)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
+
+func readAIFFInfo(r io.ReaderAt, size int64) (StreamInfo, error) {
+	var info StreamInfo
+	var frames uint32
+	var payload int64
+	for offset := int64(12); offset+8 <= size; {
+		chunk, err := readAt(r, offset, 8)
+		if err != nil {
+			return StreamInfo{}, err
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[4:8]))
+		switch string(chunk[:4]) {
+		case "COMM":
+			comm, err := readAt(r, offset+8, 18)
+			if err != nil {
+				return StreamInfo{}, fmt.Errorf("failed to read COMM chunk: %w", err)
+			}
+			info.Channels = int(binary.BigEndian.Uint16(comm[0:2]))
+			frames = binary.BigEndian.Uint32(comm[2:6])
+			info.SampleRate = int(extendedFloat(comm[8:18]))
+		case "SSND":
+			payload = min(length, size-offset-8) - 8
+		}
+		offset += 8 + length + length%2
+	}
+	if info.SampleRate == 0 {
+		return StreamInfo{}, fmt.Errorf("no COMM chunk found")
+	}
+	info.Duration = samplesDuration(uint64(frames), info.SampleRate)
+	return payloadInfo(info, payload), nil
+}
+
+func readFLACInfo(r io.ReaderAt, size int64) (StreamInfo, error) {
+	var info StreamInfo
+	var samples uint64
+	offset := int64(4)
+	for {
+		header, err := readAt(r, offset, 4)
+		if err != nil {
+			return StreamInfo{}, fmt.Errorf("failed to read metadata block: %w", err)
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if header[0]&0x7F == 0 {
+			block, err := readAt(r, offset+4, 18)
+			if err != nil {
+				return StreamInfo{}, fmt.Errorf("failed to read STREAMINFO: %w", err)
+			}
+			packed := binary.BigEndian.Uint64(block[10:18])
+			info.SampleRate = int(packed >> 44)
+			info.Channels = int(packed>>41&0x07) + 1
+			samples = packed & (1<<36 - 1)
+		}
+		offset += 4 + length
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	if info.SampleRate == 0 {
+		return StreamInfo{}, fmt.Errorf("no STREAMINFO block found")
+	}
+	info.Duration = samplesDuration(samples, info.SampleRate)
+	return payloadInfo(info, size-trailingTagsSize(r, size)-offset), nil
+}
+
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+	length   int64
+}
+
+func readOggPage(r io.ReaderAt, offset int64) (oggPage, error) {
+	header, err := readAt(r, offset, 27)
+	if err != nil || string(header[:4]) != "OggS" {
+		return oggPage{}, fmt.Errorf("no Ogg page at %d", offset)
+	}
+	segments, err := readAt(r, offset+27, int(header[26]))
+	if err != nil {
+		return oggPage{}, err
+	}
+	page := oggPage{
+		granule:  int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:   binary.LittleEndian.Uint32(header[14:18]),
+		segments: segments,
+		length:   27 + int64(len(segments)),
+	}
+	for _, segment := range segments {
+		page.length += int64(segment)
+	}
+	return page, nil
+}
+
+// lastGranule finds the granule position of the stream's last page.
+func lastGranule(r io.ReaderAt, size int64, serial uint32) (int64, bool) {
+	for end := size; end > 0; {
+		start := max(end-mp3SearchSize, 0)
+		window := make([]byte, end-start)
+		n, _ := r.ReadAt(window, start)
+		window = window[:n]
+		for i := bytes.LastIndex(window, []byte("OggS")); i >= 0; i = bytes.LastIndex(window[:i], []byte("OggS")) {
+			page, err := readOggPage(r, start+int64(i))
+			if err == nil && page.serial == serial && page.granule >= 0 {
+				return page.granule, true
+			}
+		}
+		if start == 0 {
+			break
+		}
+		// Overlap the windows so a page header is never split.
+		end = start + 27
+	}
+	return 0, false
+}
+
+func readOggInfo(r io.ReaderAt, size int64) (StreamInfo, error) {
+	first, err := readOggPage(r, 0)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	packet, err := readAt(r, first.length-sumSegments(first.segments), min(int(sumSegments(first.segments)), 32))
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to read identification header: %w", err)
+	}
+
+	var info StreamInfo
+	var headerPackets int
+	var preSkip int64
+	switch {
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		headerPackets = 3
+	case len(packet) >= 12 && string(packet[:8]) == "OpusHead":
+		// Opus always decodes at 48 kHz, whatever the input rate was.
+		info.Channels = int(packet[9])
+		info.SampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+		headerPackets = 2
+	default:
+		return StreamInfo{}, fmt.Errorf("unknown Ogg stream")
+	}
+
+	// The header packets, which hold the tags and any cover art, end on a
+	// page boundary; everything after them is audio.
+	audioStart := int64(0)
+	for packets := 0; packets < headerPackets; {
+		page, err := readOggPage(r, audioStart)
+		if err != nil {
+			return StreamInfo{}, err
+		}
+		if page.serial == first.serial {
+			for _, segment := range page.segments {
+				if segment < 255 {
+					packets++
+				}
+			}
+		}
+		audioStart += page.length
+	}
+
+	if granule, ok := lastGranule(r, size, first.serial); ok && granule > preSkip {
+		info.Duration = samplesDuration(uint64(granule-preSkip), info.SampleRate)
+	}
+	return payloadInfo(info, size-audioStart), nil
+}
+
+func sumSegments(segments []byte) int64 {
+	var sum int64
+	for _, segment := range segments {
+		sum += int64(segment)
+	}
+	return sum
+}
+
+type mp4Box struct {
+	kind   string
+	offset int64
+	size   int64
+	header int64
+}
+
+func (b mp4Box) body() int64 { return b.offset + b.header }
+func (b mp4Box) end() int64  { return b.offset + b.size }
+
+func mp4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset+8 <= end; {
+		header, err := readAt(r, offset, 8)
+		if err != nil {
+			return nil, err
+		}
+		box := mp4Box{kind: string(header[4:8]), offset: offset, size: int64(binary.BigEndian.Uint32(header[0:4])), header: 8}
+		switch box.size {
+		case 0:
+			box.size = end - offset
+		case 1:
+			large, err := readAt(r, offset+8, 8)
+			if err != nil {
+				return nil, err
+			}
+			box.size = int64(binary.BigEndian.Uint64(large))
+			box.header = 16
+		}
+		if box.size < box.header {
+			return nil, fmt.Errorf("invalid %q box", box.kind)
+		}
+		boxes = append(boxes, box)
+		offset += box.size
+	}
+	return boxes, nil
+}
+
+func findBox(r io.ReaderAt, parent mp4Box, path ...string) (mp4Box, bool) {
+	for _, kind := range path {
+		boxes, err := mp4Boxes(r, parent.body(), parent.end())
+		if err != nil {
+			return mp4Box{}, false
+		}
+		found := false
+		for _, box := range boxes {
+			if box.kind == kind {
+				parent, found = box, true
+				break
+			}
+		}
+		if !found {
+			return mp4Box{}, false
+		}
+	}
+	return parent, true
+}
+
+func readMP4Info(r io.ReaderAt, size int64) (StreamInfo, error) {
+	// Raw ADTS streams have no container to read.
+	if kind, err := readAt(r, 4, 4); err != nil || string(kind) != "ftyp" {
+		return StreamInfo{}, ErrNoStreamInfo
+	}
+	boxes, err := mp4Boxes(r, 0, size)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+
+	var moov mp4Box
+	var payload int64
+	for _, box := range boxes {
+		switch box.kind {
+		case "moov":
+			moov = box
+		case "mdat":
+			payload += box.size - box.header
+		}
+	}
+	if moov.kind == "" {
+		return StreamInfo{}, fmt.Errorf("no moov box found")
+	}
+
+	traks, err := mp4Boxes(r, moov.body(), moov.end())
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	for _, trak := range traks {
+		if trak.kind != "trak" {
+			continue
+		}
+		hdlr, ok := findBox(r, trak, "mdia", "hdlr")
+		if !ok {
+			continue
+		}
+		handler, err := readAt(r, hdlr.body()+8, 4)
+		if err != nil || string(handler) != "soun" {
+			continue
+		}
+
+		var info StreamInfo
+		if mdhd, ok := findBox(r, trak, "mdia", "mdhd"); ok {
+			if header, err := readAt(r, mdhd.body(), 32); err == nil {
+				var timescale uint32
+				var duration uint64
+				if header[0] == 1 {
+					timescale = binary.BigEndian.Uint32(header[20:24])
+					duration = binary.BigEndian.Uint64(header[24:32])
+				} else {
+					timescale = binary.BigEndian.Uint32(header[12:16])
+					duration = uint64(binary.BigEndian.Uint32(header[16:20]))
+				}
+				// Audio tracks normally count time in samples.
+				if timescale >= 8000 {
+					info.SampleRate = int(timescale)
+				}
+				info.Duration = samplesDuration(duration, int(timescale))
+			}
+		}
+		if stsd, ok := findBox(r, trak, "mdia", "minf", "stbl", "stsd"); ok {
+			// The first sample entry follows the version, flags and count.
+			if entry, err := readAt(r, stsd.body()+8, 36); err == nil {
+				info.Channels = int(binary.BigEndian.Uint16(entry[24:26]))
+				if rate := int(binary.BigEndian.Uint32(entry[32:36]) >> 16); rate > 0 && info.SampleRate == 0 {
+					info.SampleRate = rate
+				}
+			}
+		}
+		return payloadInfo(info, payload), nil
+	}
+	return StreamInfo{}, fmt.Errorf("no audio track found")
+}
@@ -0,0 +1,401 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp3Frames writes n frames with the given header and zeroed side info and
+// audio, each length bytes long.
+func mp3Frames(header [4]byte, length, n int) []byte {
+	frame := make([]byte, length)
+	copy(frame, header[:])
+	return bytes.Repeat(frame, n)
+}
+
+// MPEG-1 layer III, 128 kbps, 44.1 kHz, joint stereo: 417 bytes a frame.
+var mp3Header = [4]byte{0xFF, 0xFB, 0x90, 0x40}
+
+func id3v2Tag(body int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(body >> 21 & 0x7F), byte(body >> 14 & 0x7F), byte(body >> 7 & 0x7F), byte(body & 0x7F)}
+	return append(tag, make([]byte, body)...)
+}
+
+func id3v1Tag() []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	return tag
+}
+
+// xingMP3 writes a variable bitrate file whose Xing header counts frames
+// of audio making up bytes.
+func xingMP3(frames, bytes uint32) []byte {
+	data := mp3Frames(mp3Header, 417, 3)
+	xing := data[4+32:]
+	copy(xing, "Xing")
+	binary.BigEndian.PutUint32(xing[4:], 0x03)
+	binary.BigEndian.PutUint32(xing[8:], frames)
+	binary.BigEndian.PutUint32(xing[12:], bytes)
+	return data
+}
+
+type riffChunk struct {
+	id   string
+	body []byte
+}
+
+func riff(order binary.ByteOrder, magic, form string, chunks ...riffChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString(form)
+	for _, chunk := range chunks {
+		body.WriteString(chunk.id)
+		binary.Write(&body, order, uint32(len(chunk.body)))
+		body.Write(chunk.body)
+		if len(chunk.body)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	data := append([]byte(magic), 0, 0, 0, 0)
+	order.PutUint32(data[4:], uint32(body.Len()))
+	return append(data, body.Bytes()...)
+}
+
+func wavFormat(channels, rate, bits int) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)
+	binary.LittleEndian.PutUint16(format[2:], uint16(channels))
+	binary.LittleEndian.PutUint32(format[4:], uint32(rate))
+	binary.LittleEndian.PutUint32(format[8:], uint32(rate*channels*bits/8))
+	binary.LittleEndian.PutUint16(format[12:], uint16(channels*bits/8))
+	binary.LittleEndian.PutUint16(format[14:], uint16(bits))
+	return format
+}
+
+func aiffCommon(channels int, frames uint32, rate uint64) []byte {
+	comm := make([]byte, 18)
+	binary.BigEndian.PutUint16(comm[0:], uint16(channels))
+	binary.BigEndian.PutUint32(comm[2:], frames)
+	binary.BigEndian.PutUint16(comm[6:], 16)
+	// The rate as an 80-bit float: a normalised 64-bit mantissa and a
+	// biased exponent.
+	exponent := 63
+	for rate&(1<<63) == 0 {
+		rate <<= 1
+		exponent--
+	}
+	binary.BigEndian.PutUint16(comm[8:], uint16(16383+exponent))
+	binary.BigEndian.PutUint64(comm[10:], rate)
+	return comm
+}
+
+func flacFile(rate, channels int, samples uint64, audio int) []byte {
+	data := []byte("fLaC")
+	data = append(data, 0x00, 0, 0, 34)
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:], uint64(rate)<<44|uint64(channels-1)<<41|15<<36|samples)
+	data = append(data, streamInfo...)
+	// A padding block, marked as the last.
+	data = append(data, 0x81, 0, 0, 100)
+	data = append(data, make([]byte, 100)...)
+	return append(data, make([]byte, audio)...)
+}
+
+// oggPageBytes builds a page holding the given packets, each ending on the
+// page.
+func oggPageBytes(serial uint32, granule int64, packets ...[]byte) []byte {
+	var segments, body []byte
+	for _, packet := range packets {
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		body = append(body, packet...)
+	}
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = append(page, make([]byte, 8)...)
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, body...)
+}
+
+func vorbisFile(channels, rate int, granule int64, audio int) ([]byte, int) {
+	id := make([]byte, 30)
+	copy(id, "\x01vorbis")
+	id[11] = byte(channels)
+	binary.LittleEndian.PutUint32(id[12:], uint32(rate))
+	data := oggPageBytes(7, 0, id)
+	data = append(data, oggPageBytes(7, 0, []byte("\x03vorbis comments"), make([]byte, 300))...)
+	audioPage := oggPageBytes(7, granule, make([]byte, audio))
+	return append(data, audioPage...), len(audioPage)
+}
+
+func opusFile(channels int, preSkip uint16, granule int64, audio int) ([]byte, int) {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	binary.LittleEndian.PutUint32(head[12:], 44100)
+	data := oggPageBytes(3, 0, head)
+	data = append(data, oggPageBytes(3, 0, []byte("OpusTags"))...)
+	var audioPages int
+	for _, page := range [][]byte{
+		oggPageBytes(3, granule/2, make([]byte, audio/2)),
+		oggPageBytes(3, granule, make([]byte, audio-audio/2)),
+	} {
+		audioPages += len(page)
+		data = append(data, page...)
+	}
+	return data, audioPages
+}
+
+func mp4Box32(kind string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	box = append(box, kind...)
+	return append(box, body...)
+}
+
+func mp4Box64(kind string, body []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, kind...)
+	box = binary.BigEndian.AppendUint64(box, uint64(16+len(body)))
+	return append(box, body...)
+}
+
+// mp4File writes an audio track counting duration units of timescale,
+// with an mdhd of the given version and mdat bytes of audio.
+func mp4File(version byte, timescale uint32, duration uint64, channels int, mdat int, largeMdat bool) []byte {
+	var mdhd []byte
+	if version == 1 {
+		mdhd = make([]byte, 36)
+		mdhd[0] = 1
+		binary.BigEndian.PutUint32(mdhd[20:], timescale)
+		binary.BigEndian.PutUint64(mdhd[24:], duration)
+	} else {
+		mdhd = make([]byte, 24)
+		binary.BigEndian.PutUint32(mdhd[12:], timescale)
+		binary.BigEndian.PutUint32(mdhd[16:], uint32(duration))
+	}
+	hdlr := make([]byte, 25)
+	copy(hdlr[8:], "soun")
+
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[16:], uint16(channels))
+	binary.BigEndian.PutUint32(entry[24:], 44100<<16)
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, mp4Box32("mp4a", entry)...)
+
+	moov := mp4Box32("moov",
+		mp4Box32("mvhd", make([]byte, 100)),
+		mp4Box32("trak",
+			mp4Box32("tkhd", make([]byte, 84)),
+			mp4Box32("mdia",
+				mp4Box32("mdhd", mdhd),
+				mp4Box32("hdlr", hdlr),
+				mp4Box32("minf",
+					mp4Box32("stbl",
+						mp4Box32("stsd", stsd))))))
+
+	data := mp4Box32("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom"))
+	data = append(data, moov...)
+	if largeMdat {
+		return append(data, mp4Box64("mdat", make([]byte, mdat))...)
+	}
+	return append(data, mp4Box32("mdat", make([]byte, mdat))...)
+}
+
+func TestReadStreamInfoHeaders(t *testing.T) {
+	cbr := mp3Frames(mp3Header, 417, 100)
+	// MPEG-2 layer III, 64 kbps, 22.05 kHz, mono: 208 bytes a frame.
+	mpeg2 := mp3Frames([4]byte{0xFF, 0xF3, 0x80, 0xC0}, 208, 50)
+
+	vorbis, vorbisAudio := vorbisFile(2, 44100, 88200, 10000)
+	opus, opusAudio := opusFile(2, 312, 96000+312, 24000)
+
+	wav := riff(binary.LittleEndian, "RIFF", "WAVE",
+		riffChunk{"fmt ", wavFormat(2, 44100, 16)},
+		riffChunk{"LIST", make([]byte, 33)},
+		riffChunk{"data", make([]byte, 176400)})
+	// A streamed recording leaves the data length at its maximum.
+	streamedWAV := riff(binary.LittleEndian, "RIFF", "WAVE",
+		riffChunk{"fmt ", wavFormat(1, 8000, 8)},
+		riffChunk{"data", make([]byte, 4000)})
+	binary.LittleEndian.PutUint32(streamedWAV[len(streamedWAV)-4000-4:], 0xFFFFFFFF)
+
+	tests := []struct {
+		name string
+		read func(io.ReaderAt, int64) (StreamInfo, error)
+		data []byte
+		want StreamInfo
+	}{
+		{
+			name: "CBR MP3",
+			read: readMP3Info,
+			data: cbr,
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 128, Duration: 2606250 * time.Microsecond},
+		},
+		{
+			name: "MP3 with ID3v2 and ID3v1 tags",
+			read: readMP3Info,
+			data: bytes.Join([][]byte{id3v2Tag(3000), cbr, id3v1Tag()}, nil),
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 128, Duration: 2606250 * time.Microsecond},
+		},
+		{
+			name: "VBR MP3 with a Xing header",
+			read: readMP3Info,
+			data: append(id3v2Tag(200), xingMP3(500, 300000)...),
+			// 500 frames of 1152 samples; 300000 bytes over that time.
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 183, Duration: 13061224 * time.Microsecond},
+		},
+		{
+			name: "MPEG-2 mono MP3",
+			read: readMP3Info,
+			data: mpeg2,
+			want: StreamInfo{SampleRate: 22050, Channels: 1, Bitrate: 64, Duration: 1300 * time.Millisecond},
+		},
+		{
+			name: "WAV with an odd-sized chunk",
+			read: readWAVInfo,
+			data: wav,
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 1411, Duration: time.Second},
+		},
+		{
+			name: "streamed WAV",
+			read: readWAVInfo,
+			data: streamedWAV,
+			want: StreamInfo{SampleRate: 8000, Channels: 1, Bitrate: 64, Duration: 500 * time.Millisecond},
+		},
+		{
+			name: "AIFF",
+			read: readAIFFInfo,
+			data: riff(binary.BigEndian, "FORM", "AIFF",
+				riffChunk{"COMM", aiffCommon(2, 88200, 44100)},
+				riffChunk{"SSND", make([]byte, 8+352800)}),
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 1411, Duration: 2 * time.Second},
+		},
+		{
+			name: "AIFF at 48 kHz",
+			read: readAIFFInfo,
+			data: riff(binary.BigEndian, "FORM", "AIFF",
+				riffChunk{"COMM", aiffCommon(1, 24000, 48000)},
+				riffChunk{"SSND", make([]byte, 8+48000)}),
+			want: StreamInfo{SampleRate: 48000, Channels: 1, Bitrate: 768, Duration: 500 * time.Millisecond},
+		},
+		{
+			name: "FLAC",
+			read: readFLACInfo,
+			data: append(flacFile(48000, 2, 96000, 50000), id3v1Tag()...),
+			want: StreamInfo{SampleRate: 48000, Channels: 2, Bitrate: 200, Duration: 2 * time.Second},
+		},
+		{
+			name: "Ogg Vorbis",
+			read: readOggInfo,
+			data: vorbis,
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: vorbisAudio * 8 / 2 / 1000, Duration: 2 * time.Second},
+		},
+		{
+			name: "Opus with pre-skip",
+			read: readOggInfo,
+			data: opus,
+			want: StreamInfo{SampleRate: 48000, Channels: 2, Bitrate: opusAudio * 8 / 2 / 1000, Duration: 2 * time.Second},
+		},
+		{
+			name: "MP4",
+			read: readMP4Info,
+			data: mp4File(0, 44100, 132300, 2, 48000, false),
+			want: StreamInfo{SampleRate: 44100, Channels: 2, Bitrate: 128, Duration: 3 * time.Second},
+		},
+		{
+			name: "MP4 with a 64-bit mdhd and mdat",
+			read: readMP4Info,
+			data: mp4File(1, 48000, 144000, 1, 96000, true),
+			want: StreamInfo{SampleRate: 48000, Channels: 1, Bitrate: 256, Duration: 3 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := test.read(bytes.NewReader(test.data), int64(len(test.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.SampleRate != test.want.SampleRate || info.Channels != test.want.Channels || info.Bitrate != test.want.Bitrate {
+				t.Errorf("got %d Hz, %d channels, %d kbps, want %d Hz, %d channels, %d kbps",
+					info.SampleRate, info.Channels, info.Bitrate, test.want.SampleRate, test.want.Channels, test.want.Bitrate)
+			}
+			if diff := (info.Duration - test.want.Duration).Abs(); diff > time.Millisecond {
+				t.Errorf("duration = %v, want %v", info.Duration, test.want.Duration)
+			}
+		})
+	}
+}
+
+func TestReadStreamInfoTruncated(t *testing.T) {
+	vorbis, _ := vorbisFile(2, 44100, 88200, 1000)
+	wav := riff(binary.LittleEndian, "RIFF", "WAVE",
+		riffChunk{"fmt ", wavFormat(2, 44100, 16)},
+		riffChunk{"data", make([]byte, 1000)})
+	aiff := riff(binary.BigEndian, "FORM", "AIFF",
+		riffChunk{"COMM", aiffCommon(2, 1000, 44100)},
+		riffChunk{"SSND", make([]byte, 1000)})
+	mp4 := mp4File(0, 44100, 44100, 2, 1000, false)
+
+	tests := []struct {
+		name string
+		read func(io.ReaderAt, int64) (StreamInfo, error)
+		data []byte
+	}{
+		{"MP3 cut inside the tag", readMP3Info, id3v2Tag(3000)[:1000]},
+		{"MP3 with no frames", readMP3Info, make([]byte, 5000)},
+		{"WAV cut inside fmt", readWAVInfo, wav[:28]},
+		{"WAV without data", readWAVInfo, wav[:36]},
+		{"AIFF cut inside COMM", readAIFFInfo, aiff[:24]},
+		{"FLAC cut inside STREAMINFO", readFLACInfo, flacFile(44100, 2, 44100, 0)[:20]},
+		{"Ogg cut inside the first page", readOggInfo, vorbis[:20]},
+		{"Ogg cut inside the headers", readOggInfo, vorbis[:70]},
+		{"MP4 cut inside moov", readMP4Info, mp4[:100]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if info, err := test.read(bytes.NewReader(test.data), int64(len(test.data))); err == nil {
+				t.Errorf("read %+v from a truncated file", info)
+			}
+		})
+	}
+}
+
+func TestReadStreamInfoFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "track.mp3")
+	if err := os.WriteFile(path, append(id3v2Tag(500), xingMP3(500, 300000)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ReadStreamInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SampleRate != 44100 || info.Bitrate != 183 {
+		t.Errorf("MP3 info = %+v", info)
+	}
+
+	// Raw AAC has no container to read the length from.
+	path = filepath.Join(dir, "track.aac")
+	if err := os.WriteFile(path, []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC, 0, 0, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadStreamInfo(path); !errors.Is(err, ErrNoStreamInfo) {
+		t.Errorf("raw AAC returned %v, want ErrNoStreamInfo", err)
+	}
+}
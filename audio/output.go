@@ -0,0 +1,141 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// Output is where the player sends its samples. It mirrors the speaker
+// package so the sound card can be swapped for a headless sink.
+type Output interface {
+	Init(sampleRate beep.SampleRate, bufferSize int) error
+	Play(s ...beep.Streamer)
+	Clear()
+	// Lock stops the output from pulling samples until Unlock, so
+	// streamers can be changed safely while playing.
+	Lock()
+	Unlock()
+	Close() error
+}
+
+// Device is a sound card, or an ALSA plugin in front of one, that audio
+// can be sent to.
+type Device struct {
+	Name        string
+	Description string
+}
+
+// DeviceOutput is an output that can move to another device while
+// playing.
+type DeviceOutput interface {
+	Output
+	Device() string
+	SetDevice(name string) error
+}
+
+// failableOutput is an output that can stop by itself, as when a device
+// is unplugged, rather than only when it is closed.
+type failableOutput interface {
+	Err() error
+	setFailHandler(onFail func(error))
+}
+
+type OutputBackend int
+
+const (
+	OutputSpeaker OutputBackend = iota
+	OutputALSA
+	OutputNull
+	OutputWAV
+)
+
+func (b OutputBackend) String() string {
+	switch b {
+	case OutputALSA:
+		return "alsa"
+	case OutputNull:
+		return "null"
+	case OutputWAV:
+		return "wav"
+	default:
+		return "speaker"
+	}
+}
+
+func ParseOutputBackend(s string) (OutputBackend, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "speaker":
+		return OutputSpeaker, nil
+	case "alsa", "device":
+		return OutputALSA, nil
+	case "null", "none":
+		return OutputNull, nil
+	case "wav", "file":
+		return OutputWAV, nil
+	default:
+		return OutputSpeaker, fmt.Errorf("unknown output %q (want speaker, alsa, null or wav)", s)
+	}
+}
+
+type OutputConfig struct {
+	Backend OutputBackend
+	// Device is the ALSA device the alsa output plays through, e.g. hw:1,0.
+	// Empty means the system default.
+	Device string
+	// Path is the file the WAV output writes to.
+	Path string
+	// Realtime paces the null and WAV outputs like a sound card. Without
+	// it they consume samples as fast as the player can produce them.
+	Realtime bool
+}
+
+func NewOutput(config OutputConfig) (Output, error) {
+	switch config.Backend {
+	case OutputALSA:
+		return NewDeviceOutput(config.Device)
+	case OutputNull:
+		return NewNullOutput(config.Realtime), nil
+	case OutputWAV:
+		if config.Path == "" {
+			return nil, fmt.Errorf("the wav output needs a file path")
+		}
+		return NewWAVOutput(config.Path, config.Realtime), nil
+	default:
+		return NewSpeakerOutput(), nil
+	}
+}
+
+// speakerOutput plays through the sound card using beep's global speaker.
+type speakerOutput struct{}
+
+func NewSpeakerOutput() Output {
+	return speakerOutput{}
+}
+
+func (speakerOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	return speaker.Init(sampleRate, bufferSize)
+}
+
+func (speakerOutput) Play(s ...beep.Streamer) {
+	speaker.Play(s...)
+}
+
+func (speakerOutput) Clear() {
+	speaker.Clear()
+}
+
+func (speakerOutput) Lock() {
+	speaker.Lock()
+}
+
+func (speakerOutput) Unlock() {
+	speaker.Unlock()
+}
+
+func (speakerOutput) Close() error {
+	speaker.Close()
+	return nil
+}
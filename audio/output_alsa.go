@@ -0,0 +1,203 @@
+//go:build linux && cgo
+
+package audio
+
+// #cgo pkg-config: alsa
+//
+// #include <stdlib.h>
+// #include <alsa/asoundlib.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unsafe"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// alsaOutput plays through an ALSA device chosen by name, such as
+// default, hw:1,0 or a PulseAudio or PipeWire plugin. Unlike the speaker
+// it can be moved to another device while playing; the mixer, and so the
+// playing streamers, stay as they are.
+type alsaOutput struct {
+	softwareOutput
+	device string
+	handle *C.snd_pcm_t
+}
+
+func NewDeviceOutput(device string) (DeviceOutput, error) {
+	if device == "" {
+		device = "default"
+	}
+	return &alsaOutput{device: device}, nil
+}
+
+func (o *alsaOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	handle, err := openPCM(o.device, sampleRate, bufferSize)
+	if err != nil {
+		return err
+	}
+	o.handle = handle
+	if err := o.start(sampleRate, bufferSize, o.consume); err != nil {
+		o.closePCM()
+		return err
+	}
+	return nil
+}
+
+func (o *alsaOutput) Device() string {
+	return o.device
+}
+
+// SetDevice switches to another device. If it can't be opened, playback
+// goes back to the previous one.
+func (o *alsaOutput) SetDevice(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	if o.done == nil {
+		o.device = name
+		return nil
+	}
+
+	// The old device has to be closed first, in case both are the same
+	// card and it can only be opened once.
+	sampleRate, bufferSize := o.sampleRate, o.bufferSize
+	o.stop()
+	o.closePCM()
+
+	handle, err := openPCM(name, sampleRate, bufferSize)
+	if err != nil {
+		if restoreErr := o.Init(sampleRate, bufferSize); restoreErr != nil {
+			log.Printf("Failed to reopen %s: %v", o.device, restoreErr)
+		}
+		return err
+	}
+	o.handle = handle
+	o.device = name
+	return o.start(sampleRate, bufferSize, o.consume)
+}
+
+func (o *alsaOutput) Close() error {
+	o.stop()
+	o.closePCM()
+	return o.Err()
+}
+
+func (o *alsaOutput) closePCM() {
+	if o.handle != nil {
+		C.snd_pcm_close(o.handle)
+		o.handle = nil
+	}
+}
+
+// consume writes the mix as 16-bit frames. The writes block while the
+// device buffer is full, which paces playback. A write that fails, as when
+// a USB card is unplugged, stops the output.
+func (o *alsaOutput) consume() error {
+	samples := make([][2]float64, max(o.bufferSize/2, 1))
+	frames := make([]int16, 2*len(samples))
+	for {
+		n, ok := o.read(samples)
+		if !ok {
+			return nil
+		}
+		for i, sample := range samples[:n] {
+			frames[2*i] = toInt16(sample[0])
+			frames[2*i+1] = toInt16(sample[1])
+		}
+		if err := writePCM(o.handle, frames[:2*n]); err != nil {
+			return fmt.Errorf("failed to write to %s: %w", o.device, err)
+		}
+	}
+}
+
+func toInt16(sample float64) int16 {
+	return int16(max(min(sample, 1), -1) * 32767)
+}
+
+func openPCM(device string, sampleRate beep.SampleRate, bufferSize int) (*C.snd_pcm_t, error) {
+	name := C.CString(device)
+	defer C.free(unsafe.Pointer(name))
+
+	var handle *C.snd_pcm_t
+	if err := C.snd_pcm_open(&handle, name, C.SND_PCM_STREAM_PLAYBACK, 0); err < 0 {
+		return nil, fmt.Errorf("failed to open %s: %w", device, alsaError(err))
+	}
+
+	latency := sampleRate.D(bufferSize).Microseconds()
+	err := C.snd_pcm_set_params(handle, C.SND_PCM_FORMAT_S16_LE, C.SND_PCM_ACCESS_RW_INTERLEAVED,
+		2, C.uint(sampleRate), 1, C.uint(latency))
+	if err < 0 {
+		C.snd_pcm_close(handle)
+		return nil, fmt.Errorf("failed to set up %s at %d Hz: %w", device, int(sampleRate), alsaError(err))
+	}
+	return handle, nil
+}
+
+// writePCM writes interleaved stereo frames, recovering from underruns,
+// which happen whenever playback pauses.
+func writePCM(handle *C.snd_pcm_t, frames []int16) error {
+	for len(frames) > 0 {
+		n := C.snd_pcm_writei(handle, unsafe.Pointer(&frames[0]), C.snd_pcm_uframes_t(len(frames)/2))
+		if n < 0 {
+			if err := C.snd_pcm_recover(handle, C.int(n), 1); err < 0 {
+				return alsaError(err)
+			}
+			continue
+		}
+		frames = frames[2*int(n):]
+	}
+	return nil
+}
+
+// Devices lists the ALSA devices that can play audio.
+func Devices() ([]Device, error) {
+	iface := C.CString("pcm")
+	defer C.free(unsafe.Pointer(iface))
+
+	var hints *unsafe.Pointer
+	if err := C.snd_device_name_hint(-1, iface, &hints); err < 0 {
+		return nil, fmt.Errorf("failed to list devices: %w", alsaError(err))
+	}
+	defer C.snd_device_name_free_hint(hints)
+
+	var devices []Device
+	for _, hint := range unsafe.Slice(hints, hintCount(hints)) {
+		name := deviceHint(hint, "NAME")
+		// IOID is missing for devices that do both input and output.
+		if io := deviceHint(hint, "IOID"); name == "" || name == "null" || (io != "" && io != "Output") {
+			continue
+		}
+		description := strings.Join(strings.Fields(strings.ReplaceAll(deviceHint(hint, "DESC"), "\n", ", ")), " ")
+		devices = append(devices, Device{Name: name, Description: description})
+	}
+	return devices, nil
+}
+
+func hintCount(hints *unsafe.Pointer) int {
+	n := 0
+	for hint := hints; *hint != nil; hint = (*unsafe.Pointer)(unsafe.Add(unsafe.Pointer(hint), unsafe.Sizeof(*hint))) {
+		n++
+	}
+	return n
+}
+
+func deviceHint(hint unsafe.Pointer, id string) string {
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+
+	value := C.snd_device_name_get_hint(hint, cid)
+	if value == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(value))
+	return C.GoString(value)
+}
+
+func alsaError(err C.int) error {
+	return errors.New(C.GoString(C.snd_strerror(err)))
+}
@@ -0,0 +1,15 @@
+//go:build !linux || !cgo
+
+package audio
+
+import "fmt"
+
+var errNoDevices = fmt.Errorf("choosing an output device needs ALSA, which is only available on Linux")
+
+func NewDeviceOutput(device string) (DeviceOutput, error) {
+	return nil, errNoDevices
+}
+
+func Devices() ([]Device, error) {
+	return nil, errNoDevices
+}
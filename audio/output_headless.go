@@ -0,0 +1,213 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// softwareOutput mixes the playing streamers itself instead of handing
+// them to a sound card. Nothing is read while nothing is playing, so
+// pauses don't show up in what the sink receives.
+type softwareOutput struct {
+	mu         sync.Mutex
+	mixer      beep.Mixer
+	realtime   bool
+	sampleRate beep.SampleRate
+	bufferSize int
+	clock      time.Time
+
+	done    chan struct{}
+	stopped chan struct{}
+	// err is why the output stopped by itself, and onFail is told of it.
+	err    error
+	onFail func(error)
+}
+
+func (o *softwareOutput) Play(s ...beep.Streamer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.mixer.Add(s...)
+}
+
+func (o *softwareOutput) Clear() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.mixer.Clear()
+}
+
+func (o *softwareOutput) Lock() {
+	o.mu.Lock()
+}
+
+func (o *softwareOutput) Unlock() {
+	o.mu.Unlock()
+}
+
+// start runs consume on its own goroutine until the output is closed or
+// consume fails.
+func (o *softwareOutput) start(sampleRate beep.SampleRate, bufferSize int, consume func() error) error {
+	if o.done != nil {
+		return fmt.Errorf("output is already running")
+	}
+	o.sampleRate = sampleRate
+	o.bufferSize = bufferSize
+	o.clock = time.Now()
+	o.done = make(chan struct{})
+	o.stopped = make(chan struct{})
+	o.mu.Lock()
+	o.err = nil
+	o.mu.Unlock()
+
+	go func() {
+		defer close(o.stopped)
+		if err := consume(); err != nil {
+			o.mu.Lock()
+			o.err = err
+			onFail := o.onFail
+			o.mu.Unlock()
+			// The handler may stop or replace the output, which waits for
+			// this goroutine, so it runs on its own.
+			if onFail != nil {
+				go onFail(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Err reports why the output stopped playing, if it failed.
+func (o *softwareOutput) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
+
+func (o *softwareOutput) setFailHandler(onFail func(error)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.onFail = onFail
+}
+
+func (o *softwareOutput) stop() {
+	if o.done == nil {
+		return
+	}
+	close(o.done)
+	<-o.stopped
+	o.done = nil
+}
+
+// read fills samples from the mixer, waiting while nothing is playing.
+// It returns false once the output is closed.
+func (o *softwareOutput) read(samples [][2]float64) (int, bool) {
+	for {
+		select {
+		case <-o.done:
+			return 0, false
+		default:
+		}
+
+		o.mu.Lock()
+		playing := o.mixer.Len() > 0
+		if playing {
+			o.mixer.Stream(samples)
+		}
+		o.mu.Unlock()
+
+		if !playing {
+			time.Sleep(o.sampleRate.D(o.bufferSize))
+			o.clock = time.Now()
+			continue
+		}
+
+		if o.realtime {
+			o.clock = o.clock.Add(o.sampleRate.D(len(samples)))
+			if wait := time.Until(o.clock); wait > 0 {
+				time.Sleep(wait)
+			} else if wait < -time.Second {
+				// Fell far behind, e.g. after a suspend. Don't race to
+				// catch up.
+				o.clock = time.Now()
+			}
+		}
+		return len(samples), true
+	}
+}
+
+// nullOutput discards everything it plays.
+type nullOutput struct {
+	softwareOutput
+}
+
+func NewNullOutput(realtime bool) Output {
+	return &nullOutput{softwareOutput{realtime: realtime}}
+}
+
+func (o *nullOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	return o.start(sampleRate, bufferSize, func() error {
+		samples := make([][2]float64, bufferSize)
+		for {
+			if _, ok := o.read(samples); !ok {
+				return nil
+			}
+		}
+	})
+}
+
+func (o *nullOutput) Close() error {
+	o.stop()
+	return nil
+}
+
+// wavOutput records everything it plays to a 16-bit WAV file. The header
+// is finished when the output is closed.
+type wavOutput struct {
+	softwareOutput
+	path string
+	file *os.File
+}
+
+func NewWAVOutput(path string, realtime bool) Output {
+	return &wavOutput{softwareOutput: softwareOutput{realtime: realtime}, path: path}
+}
+
+func (o *wavOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	file, err := os.Create(o.path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	format := beep.Format{SampleRate: sampleRate, NumChannels: 2, Precision: 2}
+	err = o.start(sampleRate, bufferSize, func() error {
+		return wav.Encode(file, beep.StreamerFunc(o.read), format)
+	})
+	if err != nil {
+		file.Close()
+		os.Remove(o.path)
+		return err
+	}
+	o.file = file
+	return nil
+}
+
+func (o *wavOutput) Close() error {
+	o.stop()
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.Err()
+	if closeErr := o.file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	o.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", o.path, err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package audio
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"sync"
@@ -10,32 +11,58 @@ import (
 
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/effects"
-	"github.com/gopxl/beep/v2/mp3"
-	"github.com/gopxl/beep/v2/speaker"
-	"github.com/gopxl/beep/v2/wav"
+)
+
+const (
+	defaultSampleRate      = beep.SampleRate(44100)
+	defaultOutputBuffer    = 25 * time.Millisecond
+	defaultResampleQuality = 4
+	maxSampleRate          = 384000
 )
 
 type Player struct {
-	mu             sync.RWMutex
-	streamer       beep.StreamSeekCloser
-	ctrl           *beep.Ctrl
-	volume         *effects.Volume
-	format         beep.Format
-	speakerFormat  beep.Format
-	isInitialized  bool
-	isPlaying      bool
-	currentFile    string
-	totalLength    time.Duration
-	startTime      time.Time
-	pausedPosition time.Duration
-	sampleOffset   int
-	volumeLevel    float64
+	mu            sync.RWMutex
+	streamer      *positionStreamer
+	ctrl          *beep.Ctrl
+	volume        *effects.Volume
+	output        Output
+	eq            *Equalizer
+	tap           *sampleTap
+	speed         *speedStreamer
+	fader         *fader
+	declick       *fader
+	source        *gaplessSource
+	track         *preparedTrack
+	format        beep.Format
+	speakerFormat beep.Format
+	isInitialized bool
+	isPlaying     bool
+	currentFile   string
+	totalLength   time.Duration
+	volumeLevel   float64
+	speedLevel    float64
+	speedMode     SpeedMode
+	crossfade     time.Duration
+	transportFade time.Duration
+	fadeCurve     FadeCurve
+	replayGain    ReplayGainConfig
+
+	// The output format is fixed once the output is opened. Tracks at
+	// other rates are resampled at the resampling quality.
+	outputRate   beep.SampleRate
+	outputBuffer time.Duration
+	bufferSize   int
+	resampling   int
+	// completion is what the output plays, kept so it can be handed to a
+	// new output when the device changes.
+	completion beep.Streamer
 
 	loadingMu      sync.Mutex
 	switchingTrack int32
 	isClosed       int32
 	lastError      error
 	errorCallback  func(error)
+	events         eventBus
 
 	playbackDone chan struct{}
 	playbackMu   sync.Mutex
@@ -45,19 +72,172 @@ type Player struct {
 
 	trackLoadCount int
 	lastDeepClean  time.Time
-
-	lastPositionUpdate time.Time
-	cachedPosition     time.Duration
 }
 
 func NewPlayer() *Player {
 	return &Player{
 		volumeLevel:  0.5,
+		speedLevel:   1,
+		outputRate:   defaultSampleRate,
+		outputBuffer: defaultOutputBuffer,
+		resampling:   defaultResampleQuality,
+		output:       NewSpeakerOutput(),
+		eq:           NewEqualizer(),
+		tap:          newSampleTap(),
+		speed:        newSpeedStreamer(),
+		fader:        newFader(),
+		declick:      newFader(),
 		playbackDone: make(chan struct{}, 1),
 		loadThrottle: 50 * time.Millisecond,
 	}
 }
 
+// SetOutput replaces the sound card with another output. It has to be
+// called before the first track is loaded.
+func (p *Player) SetOutput(output Output) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isInitialized {
+		return fmt.Errorf("audio output is already initialized")
+	}
+	p.output = output
+	return nil
+}
+
+// SetOutputFormat sets the sample rate the output runs at, zero meaning
+// the rate of the first track played, and how much audio it buffers. It
+// has to be called before the first track is loaded.
+func (p *Player) SetOutputFormat(sampleRate int, buffer time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isInitialized {
+		return fmt.Errorf("audio output is already initialized")
+	}
+	if sampleRate != 0 && (sampleRate < 8000 || sampleRate > maxSampleRate) {
+		return fmt.Errorf("sample rate %d Hz is out of range (8000 to %d)", sampleRate, maxSampleRate)
+	}
+	if buffer <= 0 {
+		return fmt.Errorf("output buffer must be positive, got %s", buffer)
+	}
+	p.outputRate = beep.SampleRate(sampleRate)
+	p.outputBuffer = buffer
+	return nil
+}
+
+// SampleRate is the rate the output runs at, or zero before it is opened.
+func (p *Player) SampleRate() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return int(p.speakerFormat.SampleRate)
+}
+
+// SetResampleQuality sets how well tracks at a different sample rate than
+// the output are converted, from 1 (fastest) to 64. It applies to tracks
+// loaded from then on.
+func (p *Player) SetResampleQuality(quality int) error {
+	if quality < 1 || quality > 64 {
+		return fmt.Errorf("resample quality must be between 1 and 64, got %d", quality)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resampling = quality
+	return nil
+}
+
+// Device is the name of the device being played through, or empty for the
+// system default of the speaker output.
+func (p *Player) Device() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if output, ok := p.output.(DeviceOutput); ok {
+		return output.Device()
+	}
+	return ""
+}
+
+// SetDevice moves playback to another device without stopping it. The
+// speaker output can't change devices, so the first switch replaces it
+// with an ALSA output. Closing the speaker doesn't release the sound card,
+// as its driver keeps the device open until the program exits, so a hw:
+// device on the same card will be busy; starting with the alsa output, or
+// with a device configured, avoids this.
+func (p *Player) SetDevice(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	output, ok := p.output.(DeviceOutput)
+	if !ok {
+		if _, isSpeaker := p.output.(speakerOutput); !isSpeaker {
+			return fmt.Errorf("this output doesn't play through a device")
+		}
+		var err error
+		if output, err = NewDeviceOutput(name); err != nil {
+			return err
+		}
+		if !p.isInitialized {
+			p.output = output
+			return nil
+		}
+		if err := output.Init(p.speakerFormat.SampleRate, p.bufferSize); err != nil {
+			return fmt.Errorf("%w (the speaker output keeps its card open; set output.backend to alsa to switch cards)", err)
+		}
+	}
+
+	playing := p.isPlaying
+	if playing {
+		p.declickOutUnsafe()
+	}
+	if output == p.output {
+		if err := output.SetDevice(name); err != nil {
+			p.declickInUnsafe(playing)
+			return err
+		}
+	} else {
+		p.output.Clear()
+		p.output.Close()
+		p.output = output
+		p.watchOutputUnsafe()
+		if playing {
+			p.output.Play(p.completion)
+		}
+	}
+	p.declickInUnsafe(playing)
+	return nil
+}
+
+// watchOutputUnsafe has the output tell the player if it stops by itself.
+func (p *Player) watchOutputUnsafe() {
+	output, ok := p.output.(failableOutput)
+	if !ok {
+		return
+	}
+	current := p.output
+	output.setFailHandler(func(err error) {
+		p.outputFailed(current, err)
+	})
+}
+
+// outputFailed pauses playback when the output dies, since nothing pulls
+// the streamers any more, and reports why.
+func (p *Player) outputFailed(output Output, err error) {
+	p.mu.Lock()
+	if p.output != output || atomic.LoadInt32(&p.isClosed) == 1 {
+		p.mu.Unlock()
+		return
+	}
+	wasPlaying := p.isPlaying
+	p.isPlaying = false
+	event := Event{Type: EventPaused, Path: p.currentFile, Position: p.getCurrentPositionUnsafe(), Length: p.totalLength}
+	p.mu.Unlock()
+
+	p.reportError(fmt.Errorf("audio output stopped: %w", err))
+	if wasPlaying {
+		p.events.publish(event)
+	}
+}
+
 func (p *Player) SetErrorCallback(callback func(error)) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -73,6 +253,13 @@ func (p *Player) reportError(err error) {
 	if callback != nil {
 		callback(err)
 	}
+	p.events.publish(Event{Type: EventError, Err: err})
+}
+
+// Subscribe returns a channel of player events and a function that ends
+// the subscription. The channel is closed when the player is.
+func (p *Player) Subscribe() (<-chan Event, func()) {
+	return p.events.subscribe()
 }
 
 func (p *Player) GetLastError() error {
@@ -81,7 +268,7 @@ func (p *Player) GetLastError() error {
 	return p.lastError
 }
 
-func (p *Player) Load(filePath string) error {
+func (p *Player) Load(filePath string, loudness Loudness) error {
 	p.loadingMu.Lock()
 	defer p.loadingMu.Unlock()
 
@@ -113,15 +300,18 @@ func (p *Player) Load(filePath string) error {
 	}
 
 	if p.isPlaying {
-		speaker.Clear()
+		p.declickOutUnsafe()
+		p.output.Clear()
 		p.isPlaying = false
 
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	speaker.Clear()
+	p.output.Clear()
 	time.Sleep(2 * time.Millisecond)
-	speaker.Clear()
+	p.output.Clear()
+
+	p.releaseSourceUnsafe()
 
 	if p.streamer != nil {
 		if err := p.streamer.Close(); err != nil {
@@ -144,13 +334,104 @@ func (p *Player) Load(filePath string) error {
 
 	runtime.GC()
 
+	if p.isInitialized {
+		p.output.Clear()
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	if err := p.initSpeakerUnsafe(filePath); err != nil {
+		return err
+	}
+
+	track, err := openTrack(filePath, p.speakerFormat, p.resampling)
+	if err != nil {
+		return err
+	}
+	track.loudness = loudness
+	track.gain.setScale(p.replayGain.Scale(loudness))
+	if track.stream != nil {
+		track.stream.onTitle = func(title string) {
+			p.events.publish(Event{Type: EventMetadata, Path: filePath, Title: title})
+		}
+		track.stream.onFail = func(err error) {
+			p.reportError(fmt.Errorf("can't play %s: %w", filePath, err))
+		}
+	}
+
+	p.track = track
+	p.streamer = track.streamer
+	p.source = newGaplessSource(track, p.speakerFormat.SampleRate.N(p.crossfade), p.fadeCurve)
+	p.source.onAdvance = func(next *preparedTrack) {
+		p.events.publish(Event{Type: EventTrackLoaded, Path: next.path, Length: next.length, Continued: true})
+	}
+	p.format = track.format
+	p.currentFile = filePath
+	p.isPlaying = false
+	p.totalLength = track.length
+	p.lastError = nil
+
+	p.speed.setStreamer(p.source)
+	p.ctrl = &beep.Ctrl{Streamer: p.speed}
+	p.eq.setStreamer(p.ctrl)
+	p.tap.setStreamer(p.eq)
+	p.volume = &effects.Volume{Streamer: p.tap, Base: 2}
+	p.fader.setStreamer(p.volume)
+	p.declick.setStreamer(p.fader)
+
+	if err := p.setVolumeUnsafe(p.volumeLevel); err != nil {
+		p.reportError(fmt.Errorf("failed to set volume: %w", err))
+	}
+
+	p.events.publish(Event{Type: EventTrackLoaded, Path: filePath, Length: track.length, Volume: p.volumeLevel})
+	return nil
+}
+
+// initSpeakerUnsafe opens the output. Without a configured sample rate
+// it runs at the rate of filePath, the first track played.
+func (p *Player) initSpeakerUnsafe(filePath string) error {
+	if p.isInitialized {
+		return nil
+	}
+
+	speakerSampleRate := p.outputRate
+	if speakerSampleRate == 0 {
+		speakerSampleRate = defaultSampleRate
+		if info, err := Probe(filePath); err == nil && info.SampleRate > 0 && info.SampleRate <= maxSampleRate {
+			speakerSampleRate = beep.SampleRate(info.SampleRate)
+		}
+	}
+	bufferSize := max(speakerSampleRate.N(p.outputBuffer), 256)
+
+	if err := p.output.Init(speakerSampleRate, bufferSize); err != nil {
+		return fmt.Errorf("failed to initialize audio output: %w", err)
+	}
+	p.watchOutputUnsafe()
+	p.isInitialized = true
+	p.bufferSize = bufferSize
+	p.speakerFormat = beep.Format{
+		SampleRate:  speakerSampleRate,
+		NumChannels: 2,
+		Precision:   2,
+	}
+	p.eq.setSampleRate(speakerSampleRate)
+	p.speed.setSampleRate(speakerSampleRate)
+	return nil
+}
+
+// openTrack decodes filePath and resamples it, at the given quality, to
+// the speaker format when needed. A URL opens as a live stream.
+func openTrack(filePath string, speakerFormat beep.Format, quality int) (*preparedTrack, error) {
+	if IsStreamURL(filePath) {
+		return openStream(filePath, speakerFormat, quality), nil
+	}
+
 	if _, err := os.Stat(filePath); err != nil {
-		return fmt.Errorf("file not accessible: %w", err)
+		return nil, fmt.Errorf("file not accessible: %w", err)
 	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	var fileToClose *os.File = file
 	defer func() {
@@ -159,107 +440,328 @@ func (p *Player) Load(filePath string) error {
 		}
 	}()
 
-	var streamer beep.StreamSeekCloser
-	var format beep.Format
-	ext := getFileExtension(filePath)
-
-	switch ext {
-	case ".mp3":
-		streamer, format, err = mp3.Decode(file)
-		if err != nil {
-			return fmt.Errorf("failed to decode MP3: %w", err)
-		}
-	case ".wav":
-		streamer, format, err = wav.Decode(file)
-		if err != nil {
-			return fmt.Errorf("failed to decode WAV: %w", err)
-		}
-	default:
-		return fmt.Errorf("unsupported file format: %s", ext)
+	streamer, format, err := decodeFile(file, filePath)
+	if err != nil {
+		return nil, err
 	}
 
 	if streamer == nil {
-		return fmt.Errorf("failed to create audio streamer")
+		return nil, fmt.Errorf("failed to create audio streamer")
 	}
 
 	totalSamples := streamer.Len()
 	if totalSamples <= 0 {
 		streamer.Close()
-		return fmt.Errorf("file contains no audio data or is corrupted")
-	}
-
-	shouldReinitSpeaker := !p.isInitialized
-	if p.isInitialized {
-		speaker.Clear()
-		time.Sleep(15 * time.Millisecond)
-	}
-
-	if shouldReinitSpeaker {
-		speakerSampleRate := beep.SampleRate(44100)
-		bufferSize := max(speakerSampleRate.N(time.Second/40), 256)
-
-		err = speaker.Init(speakerSampleRate, bufferSize)
-		if err != nil {
-			streamer.Close()
-			return fmt.Errorf("failed to initialize speaker: %w", err)
-		}
-		p.isInitialized = true
-		p.speakerFormat = beep.Format{
-			SampleRate:  speakerSampleRate,
-			NumChannels: 2,
-			Precision:   2,
-		}
+		return nil, fmt.Errorf("file contains no audio data or is corrupted")
 	}
 
-	var finalStreamer beep.Streamer = streamer
 	finalFormat := format
+	var finalStreamSeekCloser beep.StreamSeekCloser = streamer
 
-	if format.SampleRate != p.speakerFormat.SampleRate {
-		quality := 1
-		resampler := beep.Resample(quality, format.SampleRate, p.speakerFormat.SampleRate, streamer)
+	if format.SampleRate != speakerFormat.SampleRate {
+		resampler := beep.Resample(quality, format.SampleRate, speakerFormat.SampleRate, streamer)
 
-		finalStreamer = resampler
-		finalFormat.SampleRate = p.speakerFormat.SampleRate
+		finalFormat.SampleRate = speakerFormat.SampleRate
 
 		originalLength := format.SampleRate.D(totalSamples)
-		totalSamples = p.speakerFormat.SampleRate.N(originalLength)
-	}
+		totalSamples = speakerFormat.SampleRate.N(originalLength)
 
-	var finalStreamSeekCloser beep.StreamSeekCloser
-	if format.SampleRate != p.speakerFormat.SampleRate {
 		finalStreamSeekCloser = &seekWrapper{
-			Streamer:       finalStreamer,
+			Streamer:       resampler,
 			original:       streamer,
 			length:         totalSamples,
 			originalFormat: format,
 			targetFormat:   finalFormat,
-			quality:        1,
+			quality:        quality,
 		}
-	} else {
-		finalStreamSeekCloser = streamer
 	}
 
-	p.streamer = finalStreamSeekCloser
-	p.format = finalFormat
-	p.currentFile = filePath
-	p.isPlaying = false
-	p.pausedPosition = 0
-	p.sampleOffset = 0
-	p.totalLength = finalFormat.SampleRate.D(totalSamples)
-	p.lastError = nil
+	fileToClose = nil
 
-	p.ctrl = &beep.Ctrl{Streamer: finalStreamSeekCloser}
-	p.volume = &effects.Volume{Streamer: p.ctrl, Base: 2}
+	_, viaFFmpeg := streamer.(*ffmpegStreamer)
+	gain := newGainStreamer(finalStreamSeekCloser)
+	return &preparedTrack{
+		path:     filePath,
+		ffmpeg:   viaFFmpeg,
+		streamer: newPositionStreamer(gain),
+		gain:     gain,
+		format:   finalFormat,
+		length:   finalFormat.SampleRate.D(totalSamples),
+	}, nil
+}
 
-	if err := p.setVolumeUnsafe(p.volumeLevel); err != nil {
-		p.reportError(fmt.Errorf("failed to set volume: %w", err))
+// SetReplayGain changes how loudness tags are applied. It takes effect
+// immediately for the playing and the prepared track.
+func (p *Player) SetReplayGain(config ReplayGainConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.replayGain = config
+	if p.track != nil {
+		p.track.gain.setScale(config.Scale(p.track.loudness))
 	}
+	if p.source != nil {
+		if next := p.source.nextTrack(); next != nil {
+			next.gain.setScale(config.Scale(next.loudness))
+		}
+	}
+}
 
-	fileToClose = nil
+func (p *Player) ReplayGain() ReplayGainConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.replayGain
+}
+
+// Equalizer returns the player's EQ. Changes to it apply live and carry
+// over between tracks.
+func (p *Player) Equalizer() *Equalizer {
+	return p.eq
+}
+
+// SetSpeed changes the playback speed. Positions and lengths are still
+// reported in track time.
+func (p *Player) SetSpeed(speed float64) error {
+	if speed < MinSpeed || speed > MaxSpeed || math.IsNaN(speed) {
+		return fmt.Errorf("speed must be between %.1fx and %.1fx, got: %.2fx", MinSpeed, MaxSpeed, speed)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if speed == p.speedLevel {
+		return nil
+	}
+	p.speedLevel = speed
+	p.speed.setSpeed(speed)
+	p.events.publish(Event{Type: EventSpeedChanged, Speed: speed})
+	return nil
+}
+
+func (p *Player) Speed() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.speedLevel
+}
+
+// SetSpeedMode chooses whether speed changes keep the pitch.
+func (p *Player) SetSpeedMode(mode SpeedMode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speedMode = mode
+	p.speed.setMode(mode)
+}
+
+func (p *Player) SpeedMode() SpeedMode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.speedMode
+}
+
+// FadeOut brings the output down to silence over duration without
+// touching the volume setting. It stays silent until ResetFade.
+func (p *Player) FadeOut(duration time.Duration) {
+	p.mu.RLock()
+	sampleRate := p.speakerFormat.SampleRate
+	p.mu.RUnlock()
+	p.fader.fadeTo(0, sampleRate.N(duration))
+}
+
+func (p *Player) ResetFade() {
+	p.fader.fadeTo(1, 0)
+}
+
+// Spectrum returns the levels of bands frequency bands, from 0 to 1, in
+// what was played last. The bands are spaced evenly in pitch.
+func (p *Player) Spectrum(bands int) []float64 {
+	p.mu.RLock()
+	sampleRate := p.speakerFormat.SampleRate
+	p.mu.RUnlock()
 
+	if sampleRate == 0 {
+		return make([]float64, max(bands, 0))
+	}
+	samples := make([]float64, SpectrumSize)
+	p.tap.latest(samples)
+	return spectrum(samples, sampleRate, bands)
+}
+
+// Waveform returns the last n samples played, mixed down to mono. n is
+// capped at SpectrumSize.
+func (p *Player) Waveform(n int) []float64 {
+	samples := make([]float64, max(min(n, SpectrumSize), 0))
+	p.tap.latest(samples)
+	return samples
+}
+
+// SetTransportFade sets how long pausing, resuming, seeking, stopping and
+// switching tracks fade over, so the sound never cuts off mid-waveform.
+// Zero turns the fades off.
+func (p *Player) SetTransportFade(duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transportFade = max(duration, 0)
+}
+
+// declickOutUnsafe fades the output down before it is cut, and returns
+// once the fade has been streamed. The timeout covers an output that
+// stopped pulling samples.
+func (p *Player) declickOutUnsafe() {
+	if p.transportFade <= 0 {
+		return
+	}
+	reached := p.declick.fadeTo(0, p.speakerFormat.SampleRate.N(p.transportFade))
+	select {
+	case <-reached:
+	case <-time.After(p.transportFade + 100*time.Millisecond):
+	}
+}
+
+// declickInUnsafe brings the output back up, from silence when fade is
+// set and instantly otherwise.
+func (p *Player) declickInUnsafe(fade bool) {
+	if !fade || p.transportFade <= 0 {
+		p.declick.fadeTo(1, 0)
+		return
+	}
+	p.declick.fadeTo(0, 0)
+	p.declick.fadeTo(1, p.speakerFormat.SampleRate.N(p.transportFade))
+}
+
+// SetCrossfade blends the end of each track into the next over duration.
+// Zero turns crossfading off.
+func (p *Player) SetCrossfade(duration time.Duration, curve FadeCurve) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.crossfade = max(duration, 0)
+	p.fadeCurve = curve
+	if p.source != nil {
+		p.source.setCrossfade(p.speakerFormat.SampleRate.N(p.crossfade), curve)
+	}
+}
+
+// SetNext decodes filePath ahead of time so it follows the current track
+// without a gap. Unless gapless is set, it is crossfaded in when a
+// crossfade is configured. It replaces any track set before.
+func (p *Player) SetNext(filePath string, loudness Loudness, gapless bool) error {
+	if atomic.LoadInt32(&p.isClosed) == 1 {
+		return fmt.Errorf("player is closed")
+	}
+
+	p.mu.RLock()
+	source := p.source
+	speakerFormat := p.speakerFormat
+	quality := p.resampling
+	replayGain := p.replayGain
+	p.mu.RUnlock()
+
+	if source == nil {
+		return fmt.Errorf("no file loaded")
+	}
+	if IsStreamURL(filePath) {
+		return fmt.Errorf("a live stream can't be prepared ahead")
+	}
+
+	track, err := openTrack(filePath, speakerFormat, quality)
+	if err != nil {
+		return err
+	}
+	track.gapless = gapless
+	track.loudness = loudness
+	track.gain.setScale(replayGain.Scale(loudness))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.source != source {
+		track.streamer.Close()
+		return fmt.Errorf("track changed while preparing %s", filePath)
+	}
+
+	if previous := source.setNext(track); previous != nil {
+		previous.streamer.Close()
+	}
 	return nil
 }
 
+func (p *Player) ClearNext() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.source == nil {
+		return
+	}
+	if previous := p.source.setNext(nil); previous != nil {
+		previous.streamer.Close()
+	}
+}
+
+func (p *Player) GetNextFile() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.source == nil {
+		return ""
+	}
+	return p.source.nextPath()
+}
+
+// syncTrack catches the player's state up with track changes the gapless
+// source made on the speaker goroutine.
+func (p *Player) syncTrack() {
+	p.mu.RLock()
+	source := p.source
+	p.mu.RUnlock()
+
+	if source == nil {
+		return
+	}
+
+	changes := source.takeChanges()
+	if len(changes) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, change := range changes {
+		change.previous.Close()
+		if p.source != source {
+			continue
+		}
+		p.applyChangeUnsafe(change)
+	}
+}
+
+func (p *Player) applyChangeUnsafe(change trackChange) {
+	p.track = change.track
+	p.streamer = change.track.streamer
+	p.format = change.track.format
+	p.currentFile = change.track.path
+	p.totalLength = change.track.length
+}
+
+// releaseSourceUnsafe applies pending changes and closes the queued track
+// so the current streamer is the only one left to close. The speaker must
+// already be cleared.
+func (p *Player) releaseSourceUnsafe() {
+	if p.source == nil {
+		return
+	}
+
+	for _, change := range p.source.takeChanges() {
+		change.previous.Close()
+		p.applyChangeUnsafe(change)
+	}
+	if next := p.source.setNext(nil); next != nil {
+		next.streamer.Close()
+	}
+	p.source = nil
+	p.track = nil
+}
+
 type seekWrapper struct {
 	beep.Streamer
 	original       beep.StreamSeekCloser
@@ -319,6 +821,8 @@ func (s *seekWrapper) Stream(samples [][2]float64) (n int, ok bool) {
 }
 
 func (p *Player) Play() error {
+	p.syncTrack()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -333,23 +837,22 @@ func (p *Player) Play() error {
 	if p.isPlaying {
 		return nil
 	}
-
-	speaker.Clear()
-	time.Sleep(2 * time.Millisecond)
-
-	if p.pausedPosition > 0 {
-		samplePos := p.format.SampleRate.N(p.pausedPosition)
-		if err := p.streamer.Seek(samplePos); err != nil {
-			p.pausedPosition = 0
-			if err := p.streamer.Seek(0); err != nil {
-				return fmt.Errorf("failed to reset to beginning: %w", err)
-			}
+	if output, ok := p.output.(failableOutput); ok {
+		if err := output.Err(); err != nil {
+			return fmt.Errorf("audio output has stopped: %w", err)
 		}
-		p.sampleOffset = samplePos
 	}
 
-	p.ctrl = &beep.Ctrl{Streamer: p.streamer}
-	p.volume = &effects.Volume{Streamer: p.ctrl, Base: 2}
+	p.output.Clear()
+	time.Sleep(2 * time.Millisecond)
+
+	p.speed.setStreamer(p.source)
+	p.ctrl = &beep.Ctrl{Streamer: p.speed}
+	p.eq.setStreamer(p.ctrl)
+	p.tap.setStreamer(p.eq)
+	p.volume = &effects.Volume{Streamer: p.tap, Base: 2}
+	p.fader.setStreamer(p.volume)
+	p.declick.setStreamer(p.fader)
 
 	if err := p.setVolumeUnsafe(p.volumeLevel); err != nil {
 		return fmt.Errorf("failed to set volume: %w", err)
@@ -362,22 +865,29 @@ func (p *Player) Play() error {
 	}
 	p.playbackMu.Unlock()
 
-	completion := beep.Seq(p.volume, beep.Callback(func() {
+	source := p.source
+	p.completion = beep.Seq(p.declick, beep.Callback(func() {
 		select {
 		case p.playbackDone <- struct{}{}:
 		default:
 		}
+		p.events.publish(Event{Type: EventFinished, Path: source.currentPath()})
 	}))
 
-	speaker.Play(completion)
+	// A track starting from the top begins as it was mastered; only
+	// resuming mid-track fades in.
+	p.declickInUnsafe(p.streamer.Position() > 0)
 	p.ctrl.Paused = false
+	p.output.Play(p.completion)
 	p.isPlaying = true
-	p.startTime = time.Now()
+	p.events.publish(Event{Type: EventStarted, Path: p.currentFile, Position: p.getCurrentPositionUnsafe(), Length: p.totalLength})
 
 	return nil
 }
 
 func (p *Player) Pause() error {
+	p.syncTrack()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -389,15 +899,18 @@ func (p *Player) Pause() error {
 		return fmt.Errorf("not currently playing")
 	}
 
-	p.pausedPosition = p.getCurrentPositionUnsafe()
-	speaker.Clear()
+	p.declickOutUnsafe()
+	p.output.Clear()
 	time.Sleep(1 * time.Millisecond)
 	p.isPlaying = false
+	p.events.publish(Event{Type: EventPaused, Path: p.currentFile, Position: p.getCurrentPositionUnsafe(), Length: p.totalLength})
 
 	return nil
 }
 
 func (p *Player) Stop() error {
+	p.syncTrack()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -409,11 +922,12 @@ func (p *Player) Stop() error {
 		return fmt.Errorf("no file loaded")
 	}
 
-	speaker.Clear()
+	if p.isPlaying {
+		p.declickOutUnsafe()
+	}
+	p.output.Clear()
 	time.Sleep(1 * time.Millisecond)
 	p.isPlaying = false
-	p.pausedPosition = 0
-	p.sampleOffset = 0
 
 	p.playbackMu.Lock()
 	select {
@@ -422,14 +936,18 @@ func (p *Player) Stop() error {
 	}
 	p.playbackMu.Unlock()
 
+	p.source.cancelFade()
 	if err := p.streamer.Seek(0); err != nil {
 		return nil
 	}
 
+	p.events.publish(Event{Type: EventStopped, Path: p.currentFile, Length: p.totalLength})
 	return nil
 }
 
 func (p *Player) Seek(position time.Duration) error {
+	p.syncTrack()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -441,25 +959,124 @@ func (p *Player) Seek(position time.Duration) error {
 		return fmt.Errorf("no file loaded")
 	}
 
+	if p.track != nil && p.track.stream != nil {
+		return fmt.Errorf("can't seek in a live stream")
+	}
+
 	if position < 0 || position > p.totalLength {
 		return fmt.Errorf("position out of bounds: %v (max: %v)", position, p.totalLength)
 	}
 
+	if p.isPlaying {
+		p.declickOutUnsafe()
+	}
+	p.source.cancelFade()
+
 	samplePos := p.format.SampleRate.N(position)
-	if err := p.streamer.Seek(samplePos); err != nil {
+	p.output.Lock()
+	err := p.streamer.Seek(samplePos)
+	p.speed.reset()
+	p.output.Unlock()
+	p.declickInUnsafe(p.isPlaying)
+	if err != nil {
 		return fmt.Errorf("failed to seek to position %v: %w", position, err)
 	}
 
-	p.sampleOffset = samplePos
-	p.pausedPosition = position
+	p.events.publish(Event{Type: EventSeeked, Path: p.currentFile, Position: position, Length: p.totalLength})
+
+	return nil
+}
+
+// SetLoop repeats the section of the current track from start to end
+// until the loop is cleared or another track plays. Playback already past
+// end jumps back to start.
+func (p *Player) SetLoop(start, end time.Duration) error {
+	p.syncTrack()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if atomic.LoadInt32(&p.isClosed) == 1 {
+		return fmt.Errorf("player is closed")
+	}
+
+	if p.streamer == nil {
+		return fmt.Errorf("no file loaded")
+	}
+
+	if start < 0 || end > p.totalLength || end-start < minLoopLength {
+		return fmt.Errorf("invalid loop %v-%v (length: %v)", start, end, p.totalLength)
+	}
+
+	// Seeking restarts ffmpeg, which is too slow to do on every pass.
+	if p.track != nil && p.track.ffmpeg {
+		return fmt.Errorf("A-B loops need a format kanade decodes itself, not one played through ffmpeg")
+	}
+
+	streamer := p.streamer
+	path, length, sampleRate := p.currentFile, p.totalLength, p.format.SampleRate
+	startSample, endSample := sampleRate.N(start), sampleRate.N(end)
+
+	// Decoding the loop's start moves the decoder, so it is faded out
+	// meanwhile like a seek.
 	if p.isPlaying {
-		p.startTime = time.Now()
+		p.declickOutUnsafe()
+	}
+	defer p.declickInUnsafe(p.isPlaying)
+
+	p.output.Lock()
+	defer p.output.Unlock()
+
+	streamer.onLoop = func(start int) {
+		p.events.publish(Event{Type: EventSeeked, Path: path, Position: sampleRate.D(start), Length: length})
+	}
+	if err := streamer.setLoop(startSample, endSample, sampleRate.N(loopSpliceLength)); err != nil {
+		return fmt.Errorf("failed to prepare loop %v-%v: %w", start, end, err)
+	}
+	if streamer.Position() < endSample {
+		return nil
 	}
 
+	p.source.cancelFade()
+	if err := streamer.Seek(startSample); err != nil {
+		return fmt.Errorf("failed to seek to position %v: %w", start, err)
+	}
+	p.speed.reset()
+	p.events.publish(Event{Type: EventSeeked, Path: path, Position: start, Length: length})
 	return nil
 }
 
+func (p *Player) ClearLoop() {
+	p.syncTrack()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.streamer != nil {
+		p.streamer.clearLoop()
+	}
+}
+
+// Loop returns the current track's A-B section, if one is set.
+func (p *Player) Loop() (start, end time.Duration, ok bool) {
+	p.syncTrack()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.streamer == nil {
+		return 0, 0, false
+	}
+	loop := p.streamer.loop.Load()
+	if loop == nil {
+		return 0, 0, false
+	}
+	return p.format.SampleRate.D(loop.start), p.format.SampleRate.D(loop.end), true
+}
+
 func (p *Player) IsAtEnd() bool {
+	p.syncTrack()
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -467,6 +1084,12 @@ func (p *Player) IsAtEnd() bool {
 		return false
 	}
 
+	// With a track queued the source carries on by itself, so the end of
+	// this one is not the end of playback.
+	if p.source != nil && p.source.hasNext() {
+		return false
+	}
+
 	currentPos := p.getCurrentPositionUnsafe()
 	return currentPos >= p.totalLength-time.Millisecond*100
 }
@@ -481,29 +1104,21 @@ func (p *Player) HasPlaybackFinished() bool {
 }
 
 func (p *Player) GetPlaybackPosition() time.Duration {
+	p.syncTrack()
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	return p.getCurrentPositionUnsafe()
 }
 
+// getCurrentPositionUnsafe reports how far into the current track the
+// samples handed to the speaker have got.
 func (p *Player) getCurrentPositionUnsafe() time.Duration {
-	if !p.isPlaying {
-		return p.pausedPosition
-	}
-
-	now := time.Now()
-	if now.Sub(p.lastPositionUpdate) < 50*time.Millisecond {
-		return p.cachedPosition
+	if p.streamer == nil {
+		return 0
 	}
-
-	elapsed := time.Since(p.startTime)
-	currentPos := min(p.pausedPosition+elapsed, p.totalLength)
-
-	p.lastPositionUpdate = now
-	p.cachedPosition = currentPos
-
-	return currentPos
+	return min(p.format.SampleRate.D(p.streamer.Position()), p.totalLength)
 }
 
 func (p *Player) IsPlaying() bool {
@@ -517,7 +1132,23 @@ func (p *Player) IsPlaying() bool {
 	return p.isPlaying
 }
 
+// StreamStatus reports on the live stream playing. ok is false when the
+// current track is a file.
+func (p *Player) StreamStatus() (status StreamStatus, ok bool) {
+	p.syncTrack()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.track == nil || p.track.stream == nil {
+		return StreamStatus{}, false
+	}
+	return p.track.stream.Status(), true
+}
+
 func (p *Player) GetTotalLength() time.Duration {
+	p.syncTrack()
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -525,6 +1156,8 @@ func (p *Player) GetTotalLength() time.Duration {
 }
 
 func (p *Player) GetCurrentFile() string {
+	p.syncTrack()
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -535,7 +1168,14 @@ func (p *Player) SetVolume(volume float64) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	return p.setVolumeUnsafe(volume)
+	previous := p.volumeLevel
+	if err := p.setVolumeUnsafe(volume); err != nil {
+		return err
+	}
+	if volume != previous {
+		p.events.publish(Event{Type: EventVolumeChanged, Volume: volume})
+	}
+	return nil
 }
 
 func (p *Player) setVolumeUnsafe(volume float64) error {
@@ -566,12 +1206,13 @@ func (p *Player) Close() error {
 	defer p.mu.Unlock()
 
 	if p.isPlaying {
-		speaker.Clear()
+		p.output.Clear()
 		time.Sleep(10 * time.Millisecond)
 		p.isPlaying = false
 	}
 
-	speaker.Clear()
+	p.output.Clear()
+	p.releaseSourceUnsafe()
 
 	var err error
 	if p.streamer != nil {
@@ -580,12 +1221,23 @@ func (p *Player) Close() error {
 	}
 
 	p.ctrl = nil
+	p.speed.setStreamer(nil)
+	p.eq.setStreamer(nil)
+	p.tap.setStreamer(nil)
 	p.volume = nil
+	p.fader.setStreamer(nil)
+	p.declick.setStreamer(nil)
+	p.completion = nil
+
+	if p.isInitialized {
+		if closeErr := p.output.Close(); err == nil {
+			err = closeErr
+		}
+		p.isInitialized = false
+	}
 
 	p.currentFile = ""
 	p.totalLength = 0
-	p.pausedPosition = 0
-	p.sampleOffset = 0
 
 	p.playbackMu.Lock()
 	if p.playbackDone != nil {
@@ -598,6 +1250,8 @@ func (p *Player) Close() error {
 	}
 	p.playbackMu.Unlock()
 
+	p.events.close()
+
 	return err
 }
 
@@ -611,7 +1265,7 @@ func (p *Player) DeepCleanup() {
 	defer p.mu.Unlock()
 
 	for i := 0; i < 2; i++ {
-		speaker.Clear()
+		p.output.Clear()
 		time.Sleep(5 * time.Millisecond)
 	}
 
@@ -623,15 +1277,3 @@ func (p *Player) DeepCleanup() {
 	p.trackLoadCount = 0
 	p.lastDeepClean = time.Now()
 }
-
-func getFileExtension(filePath string) string {
-	for i := len(filePath) - 1; i >= 0; i-- {
-		if filePath[i] == '.' {
-			return filePath[i:]
-		}
-		if filePath[i] == '/' || filePath[i] == '\\' {
-			break
-		}
-	}
-	return ""
-}
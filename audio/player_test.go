@@ -0,0 +1,263 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+const testSampleRate = beep.SampleRate(44100)
+
+// writeTestWAV writes a 16-bit stereo sine tone of the given length.
+func writeTestWAV(t *testing.T, name string, length time.Duration) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	samples := testSampleRate.N(length)
+	phase := 0
+	tone := beep.StreamerFunc(func(buf [][2]float64) (int, bool) {
+		n := min(len(buf), samples-phase)
+		for i := range buf[:n] {
+			value := 0.5 * math.Sin(2*math.Pi*440*float64(phase)/float64(testSampleRate))
+			buf[i] = [2]float64{value, value}
+			phase++
+		}
+		return n, n > 0
+	})
+	format := beep.Format{SampleRate: testSampleRate, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(file, tone, format); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestPlayer(t *testing.T, output Output) *Player {
+	t.Helper()
+
+	p := NewPlayer()
+	p.loadThrottle = 0
+	if err := p.SetOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetOutputFormat(int(testSampleRate), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// waitFor reads events until one matches, failing after a timeout.
+func waitFor(t *testing.T, events <-chan Event, match func(Event) bool) Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("event channel closed")
+			}
+			if match(event) {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestPlayerFinishesAndAdvances(t *testing.T) {
+	first := writeTestWAV(t, "first.wav", 200*time.Millisecond)
+	second := writeTestWAV(t, "second.wav", 300*time.Millisecond)
+
+	p := newTestPlayer(t, NewNullOutput(false))
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Load(first, Loudness{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetNext(second, Loudness{}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := waitFor(t, events, func(e Event) bool { return e.Type == EventTrackLoaded && e.Continued })
+	if loaded.Path != second {
+		t.Errorf("advanced to %q, want %q", loaded.Path, second)
+	}
+	if loaded.Length != 300*time.Millisecond {
+		t.Errorf("next track length = %v, want 300ms", loaded.Length)
+	}
+
+	finished := waitFor(t, events, func(e Event) bool { return e.Type == EventFinished })
+	if finished.Path != second {
+		t.Errorf("finished %q, want %q", finished.Path, second)
+	}
+	if !p.HasPlaybackFinished() {
+		t.Error("HasPlaybackFinished is false after the Finished event")
+	}
+	if got := p.GetCurrentFile(); got != second {
+		t.Errorf("current file = %q, want %q", got, second)
+	}
+
+	// Loading the next song after the end starts over cleanly.
+	if err := p.Load(first, Loudness{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	finished = waitFor(t, events, func(e Event) bool { return e.Type == EventFinished })
+	if finished.Path != first {
+		t.Errorf("finished %q, want %q", finished.Path, first)
+	}
+}
+
+func TestPlayerSeekReportsPosition(t *testing.T) {
+	path := writeTestWAV(t, "seek.wav", 2*time.Second)
+
+	p := newTestPlayer(t, NewNullOutput(true))
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Load(path, Loudness{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetTotalLength(); got != 2*time.Second {
+		t.Fatalf("length = %v, want 2s", got)
+	}
+
+	// Seeking while stopped moves the position straight away.
+	if err := p.Seek(500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetPlaybackPosition(); got != 500*time.Millisecond {
+		t.Errorf("position after seek = %v, want 500ms", got)
+	}
+	seeked := waitFor(t, events, func(e Event) bool { return e.Type == EventSeeked })
+	if seeked.Position != 500*time.Millisecond {
+		t.Errorf("Seeked event position = %v, want 500ms", seeked.Position)
+	}
+
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := p.Seek(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := p.GetPlaybackPosition(); got < time.Second || got > 1500*time.Millisecond {
+		t.Errorf("position 100ms after seeking to 1s = %v", got)
+	}
+
+	if err := p.Seek(3 * time.Second); err == nil {
+		t.Error("seeking past the end succeeded")
+	}
+}
+
+func TestWAVOutputLength(t *testing.T) {
+	path := writeTestWAV(t, "input.wav", 500*time.Millisecond)
+	outputPath := filepath.Join(t.TempDir(), "output.wav")
+
+	p := newTestPlayer(t, NewWAVOutput(outputPath, false))
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Load(path, Loudness{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, func(e Event) bool { return e.Type == EventFinished })
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	streamer, format, err := wav.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != testSampleRate || format.NumChannels != 2 {
+		t.Errorf("output format = %+v", format)
+	}
+
+	// The encoder reads 512 samples at a time, so the last read is padded
+	// with silence.
+	want := testSampleRate.N(500 * time.Millisecond)
+	if got := streamer.Len(); got < want || got >= want+512 {
+		t.Errorf("output has %d samples, want %d to %d", got, want, want+511)
+	}
+}
+
+// failingOutput plays a few buffers and then fails, like a device that
+// was unplugged.
+type failingOutput struct {
+	softwareOutput
+}
+
+func (o *failingOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	return o.start(sampleRate, bufferSize, func() error {
+		samples := make([][2]float64, bufferSize)
+		for range 3 {
+			if _, ok := o.read(samples); !ok {
+				return nil
+			}
+		}
+		return errors.New("device unplugged")
+	})
+}
+
+func (o *failingOutput) Close() error {
+	o.stop()
+	return o.Err()
+}
+
+func TestPlayerPausesWhenOutputFails(t *testing.T) {
+	path := writeTestWAV(t, "input.wav", 2*time.Second)
+
+	p := newTestPlayer(t, &failingOutput{softwareOutput{realtime: true}})
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Load(path, Loudness{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := waitFor(t, events, func(e Event) bool { return e.Type == EventError })
+	if failed.Err == nil || !strings.Contains(failed.Err.Error(), "device unplugged") {
+		t.Errorf("error event = %v", failed.Err)
+	}
+	waitFor(t, events, func(e Event) bool { return e.Type == EventPaused })
+	if p.IsPlaying() {
+		t.Error("still playing after the output failed")
+	}
+	if err := p.Play(); err == nil {
+		t.Error("Play succeeded on a dead output")
+	}
+}
@@ -0,0 +1,224 @@
+package audio
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var playlistTypes = []string{
+	"audio/x-scpls",
+	"application/pls+xml",
+	"audio/x-mpegurl",
+	"audio/mpegurl",
+	"application/x-mpegurl",
+	"application/vnd.apple.mpegurl",
+}
+
+// PlaylistEntry is one stream or file listed in a playlist.
+type PlaylistEntry struct {
+	URL   string
+	Title string
+}
+
+// IsPlaylist reports whether path, a file or URL, names a .pls or .m3u
+// playlist.
+func IsPlaylist(path string) bool {
+	if IsStreamURL(path) {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pls", ".m3u", ".m3u8":
+		return true
+	}
+	return false
+}
+
+// isPlaylistResponse decides from the content type whether a server sent a
+// playlist, going by the URL only when the type says nothing useful.
+func isPlaylistResponse(contentType, rawURL string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if slices.Contains(playlistTypes, mediaType) {
+		return true
+	}
+	if mediaType != "" && mediaType != "text/plain" && mediaType != "application/octet-stream" {
+		return false
+	}
+	return IsPlaylist(rawURL)
+}
+
+// LoadPlaylist reads a playlist from a file or downloads it from a URL.
+func LoadPlaylist(path string) ([]PlaylistEntry, error) {
+	if !IsStreamURL(path) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open playlist: %w", err)
+		}
+		defer file.Close()
+		return ParsePlaylist(io.LimitReader(file, maxPlaylistSize), path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamConnectTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL: %w", err)
+	}
+	req.Header.Set("User-Agent", "kanade")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download playlist: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download playlist: %w", &httpStatusError{code: resp.StatusCode, status: resp.Status})
+	}
+	return ParsePlaylist(io.LimitReader(resp.Body, maxPlaylistSize), path)
+}
+
+// ParsePlaylist reads a PLS or M3U playlist. Relative entries are resolved
+// against base, the URL or path the playlist came from.
+func ParsePlaylist(r io.Reader, base string) ([]PlaylistEntry, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("playlist is empty")
+	}
+
+	var entries []PlaylistEntry
+	if strings.EqualFold(lines[0], "[playlist]") {
+		entries = parsePLS(lines[1:])
+	} else {
+		var err error
+		if entries, err = parseM3U(lines); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range entries {
+		entries[i].URL = resolveEntry(entries[i].URL, base)
+	}
+	return entries, nil
+}
+
+// parsePLS reads FileN= and TitleN= keys, ordered by N.
+func parsePLS(lines []string) []PlaylistEntry {
+	type numbered struct {
+		n     int
+		entry PlaylistEntry
+	}
+	byNumber := make(map[int]*numbered)
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var number string
+		switch {
+		case strings.HasPrefix(key, "file"):
+			number = strings.TrimPrefix(key, "file")
+		case strings.HasPrefix(key, "title"):
+			number = strings.TrimPrefix(key, "title")
+		default:
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			continue
+		}
+		item := byNumber[n]
+		if item == nil {
+			item = &numbered{n: n}
+			byNumber[n] = item
+		}
+		if strings.HasPrefix(key, "file") {
+			item.entry.URL = value
+		} else {
+			item.entry.Title = value
+		}
+	}
+
+	var items []*numbered
+	for _, item := range byNumber {
+		if item.entry.URL != "" {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b *numbered) int {
+		return cmp.Compare(a.n, b.n)
+	})
+
+	entries := make([]PlaylistEntry, len(items))
+	for i, item := range items {
+		entries[i] = item.entry
+	}
+	return entries
+}
+
+// parseM3U reads plain and extended M3U, taking titles from #EXTINF.
+// HLS playlists look the same but list segments rather than streams.
+func parseM3U(lines []string) ([]PlaylistEntry, error) {
+	var entries []PlaylistEntry
+	var title string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-"):
+			return nil, fmt.Errorf("HLS playlists are not supported")
+		case strings.HasPrefix(line, "#EXTINF:"):
+			if _, name, ok := strings.Cut(line, ","); ok {
+				title = strings.TrimSpace(name)
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			entries = append(entries, PlaylistEntry{URL: line, Title: title})
+			title = ""
+		}
+	}
+	return entries, nil
+}
+
+func resolveEntry(entry, base string) string {
+	if IsStreamURL(entry) || base == "" {
+		return entry
+	}
+	if IsStreamURL(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return entry
+		}
+		ref, err := url.Parse(entry)
+		if err != nil {
+			return entry
+		}
+		return baseURL.ResolveReference(ref).String()
+	}
+	if strings.Contains(entry, "://") || filepath.IsAbs(entry) {
+		return entry
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(entry))
+}
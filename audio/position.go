@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	// minLoopLength keeps A-B loops long enough to be heard as a section.
+	minLoopLength = 100 * time.Millisecond
+	// loopSpliceLength is how long the end of a loop is crossfaded into its
+	// start, which is enough to hide the jump without being heard as a fade.
+	loopSpliceLength = 8 * time.Millisecond
+)
+
+// loopRange is an A-B section of a track in samples. head holds the
+// section's first samples, decoded ahead, to fade into as its end plays.
+type loopRange struct {
+	start, end int
+	head       [][2]float64
+}
+
+// positionStreamer counts the samples a track hands to the speaker. The
+// count is what has actually been played, give or take the speaker
+// buffer, and can be read while the speaker goroutine streams from it.
+//
+// It also plays the track's A-B loop: the end of the section fades into
+// its start, and the decoder then seeks to just past the part already
+// played, within the same buffer, so the loop has no gap or click and the
+// count stays the position in the track.
+type positionStreamer struct {
+	beep.StreamSeekCloser
+	position atomic.Int64
+	loop     atomic.Pointer[loopRange]
+	// onLoop is called on the speaker goroutine each time the loop jumps
+	// back to its start.
+	onLoop func(start int)
+}
+
+func newPositionStreamer(s beep.StreamSeekCloser) *positionStreamer {
+	return &positionStreamer{StreamSeekCloser: s}
+}
+
+func (s *positionStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		position := int(s.position.Load())
+		loop := s.loop.Load()
+		if loop == nil || position >= loop.end {
+			streamed, ok := s.StreamSeekCloser.Stream(samples[n:])
+			s.position.Add(int64(streamed))
+			n += streamed
+			return n, ok || n > 0
+		}
+
+		chunk := samples[n:]
+		chunk = chunk[:min(len(chunk), loop.end-position)]
+		streamed, _ := s.StreamSeekCloser.Stream(chunk)
+		loop.splice(chunk[:streamed], position)
+		s.position.Add(int64(streamed))
+		n += streamed
+		if streamed == len(chunk) && position+streamed < loop.end {
+			continue
+		}
+
+		// At the end of the section, or the track ran out before it.
+		resume := loop.start + len(loop.head)
+		if streamed == 0 && position == resume {
+			return n, n > 0
+		}
+		if err := s.StreamSeekCloser.Seek(resume); err != nil {
+			return n, n > 0
+		}
+		s.position.Store(int64(resume))
+		if s.onLoop != nil {
+			s.onLoop(loop.start)
+		}
+	}
+	return n, true
+}
+
+func (s *positionStreamer) Seek(p int) error {
+	if err := s.StreamSeekCloser.Seek(p); err != nil {
+		return err
+	}
+	s.position.Store(int64(p))
+	return nil
+}
+
+func (s *positionStreamer) Position() int {
+	return int(s.position.Load())
+}
+
+// setLoop starts looping from start to end, fading over splice samples.
+// It decodes the start of the section ahead, so the speaker must be
+// locked.
+func (s *positionStreamer) setLoop(start, end, splice int) error {
+	loop := &loopRange{start: start, end: end}
+	splice = min(splice, (end-start)/2)
+	if splice > 0 {
+		position := s.Position()
+		if err := s.StreamSeekCloser.Seek(start); err != nil {
+			return err
+		}
+		loop.head = make([][2]float64, splice)
+		n, _ := s.StreamSeekCloser.Stream(loop.head)
+		loop.head = loop.head[:n]
+		if err := s.StreamSeekCloser.Seek(position); err != nil {
+			return err
+		}
+	}
+	s.loop.Store(loop)
+	return nil
+}
+
+// splice fades the samples at the end of the loop, which start at
+// position in the track, into its head.
+func (l *loopRange) splice(samples [][2]float64, position int) {
+	fadeStart := l.end - len(l.head)
+	for i := range samples {
+		k := position + i - fadeStart
+		if k < 0 {
+			continue
+		}
+		x := (float64(k) + 0.5) / float64(len(l.head))
+		in, out := FadeEqualPower.gain(x), FadeEqualPower.gain(1-x)
+		samples[i][0] = samples[i][0]*out + l.head[k][0]*in
+		samples[i][1] = samples[i][1]*out + l.head[k][1]*in
+	}
+}
+
+func (s *positionStreamer) clearLoop() {
+	s.loop.Store(nil)
+}
+
+// looping reports whether the loop will still come around, i.e. playback
+// hasn't been moved past its end.
+func (s *positionStreamer) looping() bool {
+	loop := s.loop.Load()
+	return loop != nil && int(s.position.Load()) < loop.end
+}
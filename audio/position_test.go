@@ -0,0 +1,75 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// rampStreamer plays samples whose value is their index, so any jump in
+// the output shows up as a jump in value.
+type rampStreamer struct {
+	position, length int
+}
+
+func (r *rampStreamer) Stream(samples [][2]float64) (int, bool) {
+	n := min(len(samples), r.length-r.position)
+	for i := range samples[:n] {
+		value := float64(r.position + i)
+		samples[i] = [2]float64{value, value}
+	}
+	r.position += n
+	return n, n > 0
+}
+
+func (r *rampStreamer) Err() error    { return nil }
+func (r *rampStreamer) Len() int      { return r.length }
+func (r *rampStreamer) Position() int { return r.position }
+func (r *rampStreamer) Close() error  { return nil }
+
+func (r *rampStreamer) Seek(p int) error {
+	if p < 0 || p > r.length {
+		return fmt.Errorf("seek to %d out of range", p)
+	}
+	r.position = p
+	return nil
+}
+
+func TestLoopCrossfadesIntoStart(t *testing.T) {
+	const start, end, splice = 1000, 2000, 100
+
+	s := newPositionStreamer(&rampStreamer{length: 10000})
+	if err := s.Seek(1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setLoop(start, end, splice); err != nil {
+		t.Fatal(err)
+	}
+	if s.Position() != 1500 {
+		t.Fatalf("position after setting loop = %d, want 1500", s.Position())
+	}
+
+	loops := 0
+	s.onLoop = func(int) { loops++ }
+
+	samples := make([][2]float64, 3000)
+	n, ok := s.Stream(samples)
+	if n != len(samples) || !ok {
+		t.Fatalf("streamed %d samples, ok %v", n, ok)
+	}
+	if loops != 3 {
+		t.Errorf("looped %d times, want 3", loops)
+	}
+
+	// Unfaded, the jump from 1999 back to 1000 would be a step of 999.
+	largest := 0.0
+	for i := 1; i < n; i++ {
+		largest = math.Max(largest, math.Abs(samples[i][0]-samples[i-1][0]))
+	}
+	if largest > 50 {
+		t.Errorf("largest step between samples = %v, want a crossfade", largest)
+	}
+	if pos := s.Position(); pos < start || pos >= end {
+		t.Errorf("position %d is outside the loop", pos)
+	}
+}
@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+type StreamInfo struct {
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+	Bitrate    int
+}
+
+// ErrNoStreamInfo is returned by ReadStreamInfo for formats whose headers
+// it cannot read.
+var ErrNoStreamInfo = errors.New("no stream info in headers")
+
+// ReadStreamInfo reads a file's stream info from its headers, which is
+// cheap enough to do for every file in a library scan.
+func ReadStreamInfo(filePath string) (StreamInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	codec, err := detectCodec(file, filePath)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	return readStreamInfo(file, codec)
+}
+
+func readStreamInfo(file *os.File, codec *Codec) (StreamInfo, error) {
+	if codec.Info == nil {
+		return StreamInfo{}, fmt.Errorf("%s: %w", codec.Name, ErrNoStreamInfo)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	info, err := codec.Info(file, stat.Size())
+	if errors.Is(err, ErrNoStreamInfo) {
+		return StreamInfo{}, fmt.Errorf("%s: %w", codec.Name, err)
+	}
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to read %s headers: %w", codec.Name, err)
+	}
+	return info, nil
+}
+
+// Probe reads a file's stream info from its headers, and failing that by
+// opening a decoder or running ffmpeg on it.
+func Probe(filePath string) (StreamInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	codec, err := detectCodec(file, filePath)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	if info, err := readStreamInfo(file, codec); err == nil {
+		return info, nil
+	}
+
+	if codec.Decode == nil {
+		if !FFmpegAvailable() {
+			return StreamInfo{}, fmt.Errorf("no decoder available for %s", codec.Name)
+		}
+		return probeWithFFmpeg(FFmpegPath(), filePath)
+	}
+
+	streamer, format, err := codec.Decode(file)
+	if err != nil {
+		if FFmpegAvailable() {
+			return probeWithFFmpeg(FFmpegPath(), filePath)
+		}
+		return StreamInfo{}, fmt.Errorf("failed to decode %s: %w", codec.Name, err)
+	}
+	defer streamer.Close()
+
+	// The decoder knows nothing of the bitrate, and the file size would
+	// count tags and cover art, so it is left unknown.
+	return StreamInfo{
+		Duration:   format.SampleRate.D(streamer.Len()),
+		SampleRate: int(format.SampleRate),
+		Channels:   format.NumChannels,
+	}, nil
+}
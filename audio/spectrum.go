@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	// SpectrumSize is how many of the latest samples the tap keeps, and the
+	// length of the FFT window. It has to be a power of two.
+	SpectrumSize = 2048
+
+	minSpectrumFreq = 40.0
+	maxSpectrumFreq = 16000.0
+	// Levels are mapped from spectrumFloor dB up to full scale.
+	spectrumFloor = -60.0
+	// Music has less energy the higher it goes, so the bands are tilted up
+	// by this many dB per octave around 1 kHz to keep the bars even.
+	spectrumTilt = 3.0
+)
+
+// sampleTap passes samples through unchanged and keeps the latest ones,
+// mixed down to mono, for the visualizer.
+type sampleTap struct {
+	mu       sync.Mutex
+	streamer beep.Streamer
+
+	ringMu sync.Mutex
+	ring   [SpectrumSize]float64
+	pos    int
+}
+
+func newSampleTap() *sampleTap {
+	return &sampleTap{}
+}
+
+func (t *sampleTap) setStreamer(streamer beep.Streamer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.streamer = streamer
+}
+
+// latest fills dst with the most recent samples, oldest first.
+func (t *sampleTap) latest(dst []float64) {
+	t.ringMu.Lock()
+	defer t.ringMu.Unlock()
+
+	n := min(len(dst), len(t.ring))
+	start := t.pos - n + len(t.ring)
+	for i := range dst[:n] {
+		dst[i] = t.ring[(start+i)%len(t.ring)]
+	}
+}
+
+func (t *sampleTap) Stream(samples [][2]float64) (n int, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.streamer == nil {
+		return 0, false
+	}
+	n, ok = t.streamer.Stream(samples)
+
+	t.ringMu.Lock()
+	for _, sample := range samples[:n] {
+		t.ring[t.pos] = (sample[0] + sample[1]) / 2
+		t.pos = (t.pos + 1) % len(t.ring)
+	}
+	t.ringMu.Unlock()
+	return n, ok
+}
+
+func (t *sampleTap) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.streamer == nil {
+		return nil
+	}
+	return t.streamer.Err()
+}
+
+// spectrum splits samples into bands on a log frequency scale between
+// minSpectrumFreq and maxSpectrumFreq, and gives each a level from 0 to 1.
+func spectrum(samples []float64, sampleRate beep.SampleRate, bands int) []float64 {
+	levels := make([]float64, bands)
+	n := len(samples)
+	if bands <= 0 || n < 2 || n&(n-1) != 0 {
+		return levels
+	}
+
+	// A Hann window keeps loud bands from leaking into their neighbours.
+	bins := make([]complex128, n)
+	var windowSum float64
+	for i, sample := range samples {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		windowSum += w
+		bins[i] = complex(sample*w, 0)
+	}
+	fft(bins)
+
+	binWidth := float64(sampleRate) / float64(n)
+	maxFreq := min(maxSpectrumFreq, float64(sampleRate)/2)
+	ratio := maxFreq / minSpectrumFreq
+	for band := range levels {
+		low := minSpectrumFreq * math.Pow(ratio, float64(band)/float64(bands))
+		high := minSpectrumFreq * math.Pow(ratio, float64(band+1)/float64(bands))
+
+		first := max(int(math.Round(low/binWidth)), 1)
+		last := max(int(math.Round(high/binWidth))-1, first)
+		var peak float64
+		for bin := first; bin <= min(last, n/2); bin++ {
+			peak = max(peak, cmplx.Abs(bins[bin]))
+		}
+
+		// Scaled so a full scale sine reads 0 dB.
+		amplitude := 2 * peak / windowSum
+		if amplitude <= 0 {
+			continue
+		}
+		db := 20*math.Log10(amplitude) + spectrumTilt*math.Log2(math.Sqrt(low*high)/1000)
+		levels[band] = max(min(1-db/spectrumFloor, 1), 0)
+	}
+	return levels
+}
+
+// fft is an in-place radix-2 Cooley-Tukey transform. len(x) has to be a
+// power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 2.0
+
+	speedResampleQuality = 4
+)
+
+type SpeedMode int
+
+const (
+	// SpeedStretch keeps the pitch when the speed changes.
+	SpeedStretch SpeedMode = iota
+	// SpeedResample plays faster or slower like a tape, changing pitch.
+	SpeedResample
+)
+
+func (m SpeedMode) String() string {
+	switch m {
+	case SpeedResample:
+		return "resample"
+	default:
+		return "stretch"
+	}
+}
+
+func ParseSpeedMode(s string) (SpeedMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "stretch", "time-stretch":
+		return SpeedStretch, nil
+	case "resample", "tape":
+		return SpeedResample, nil
+	default:
+		return SpeedStretch, fmt.Errorf("unknown speed mode %q (want stretch or resample)", s)
+	}
+}
+
+// speedStreamer sits between the gapless source and the Ctrl and changes
+// the playback speed. The source is still read in track time, so the
+// position the player reports stays correct at any speed.
+type speedStreamer struct {
+	mu        sync.Mutex
+	streamer  beep.Streamer
+	speed     float64
+	mode      SpeedMode
+	resampler *beep.Resampler
+	stretcher *timeStretcher
+	// pending holds what the stretcher read ahead from the streamer when
+	// it was stopped; it plays before anything more is read.
+	pending [][2]float64
+}
+
+func newSpeedStreamer() *speedStreamer {
+	return &speedStreamer{speed: 1}
+}
+
+func (s *speedStreamer) setStreamer(streamer beep.Streamer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streamer = streamer
+	s.resetUnsafe()
+}
+
+func (s *speedStreamer) setSampleRate(sampleRate beep.SampleRate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stretcher = newTimeStretcher(sampleRate)
+}
+
+func (s *speedStreamer) setSpeed(speed float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.speed = speed
+	if speed == 1 {
+		s.releaseUnsafe()
+	} else if s.resampler != nil {
+		s.resampler.SetRatio(speed)
+	}
+}
+
+func (s *speedStreamer) setMode(mode SpeedMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mode != mode {
+		s.mode = mode
+		s.releaseUnsafe()
+	}
+}
+
+// reset drops samples buffered ahead, which are stale after a seek.
+func (s *speedStreamer) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetUnsafe()
+}
+
+func (s *speedStreamer) resetUnsafe() {
+	s.resampler = nil
+	if s.stretcher != nil {
+		s.stretcher.reset()
+	}
+	s.pending = nil
+}
+
+// releaseUnsafe stops resampling or stretching, keeping the samples the
+// stretcher has already taken from the streamer so none are skipped.
+func (s *speedStreamer) releaseUnsafe() {
+	s.resampler = nil
+	if s.stretcher != nil {
+		s.pending = append(s.stretcher.drain(), s.pending...)
+	}
+}
+
+// readUnsafe plays the pending samples, then the streamer.
+func (s *speedStreamer) readUnsafe(samples [][2]float64) (n int, ok bool) {
+	n = copy(samples, s.pending)
+	s.pending = s.pending[n:]
+	if len(s.pending) == 0 {
+		s.pending = nil
+	}
+	if n == len(samples) {
+		return n, true
+	}
+	m, ok := s.streamer.Stream(samples[n:])
+	return n + m, ok || n > 0
+}
+
+func (s *speedStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streamer == nil {
+		return 0, false
+	}
+	if s.speed == 1 {
+		return s.readUnsafe(samples)
+	}
+
+	source := beep.StreamerFunc(s.readUnsafe)
+	if s.mode == SpeedResample {
+		if s.resampler == nil {
+			s.resampler = beep.ResampleRatio(speedResampleQuality, s.speed, source)
+		}
+		return s.resampler.Stream(samples)
+	}
+	if s.stretcher == nil {
+		return s.readUnsafe(samples)
+	}
+	return s.stretcher.stream(source, s.speed, samples)
+}
+
+func (s *speedStreamer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamer == nil {
+		return nil
+	}
+	return s.streamer.Err()
+}
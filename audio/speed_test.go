@@ -0,0 +1,54 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestSpeedChangeKeepsStretcherInput(t *testing.T) {
+	for _, change := range []struct {
+		name  string
+		apply func(s *speedStreamer)
+	}{
+		{"back to normal speed", func(s *speedStreamer) { s.setSpeed(1) }},
+		{"to resampling", func(s *speedStreamer) { s.setMode(SpeedResample); s.setSpeed(1) }},
+	} {
+		t.Run(change.name, func(t *testing.T) {
+			source := &rampStreamer{length: 200000}
+			s := newSpeedStreamer()
+			s.setSampleRate(testSampleRate)
+			s.setStreamer(source)
+			s.setSpeed(1.5)
+
+			samples := make([][2]float64, 4096)
+			for range 5 {
+				s.Stream(samples)
+			}
+			read := source.position
+			change.apply(s)
+
+			// What follows the last stretched frame is the source read
+			// straight through, starting from audio the stretcher had
+			// already taken rather than from where the source is now.
+			var after []float64
+			for len(after) < 20000 {
+				n, ok := s.Stream(samples)
+				if !ok {
+					t.Fatal("stream ended early")
+				}
+				for _, sample := range samples[:n] {
+					after = append(after, sample[0])
+				}
+			}
+			start := len(after) - 1
+			for start > 0 && after[start-1] == after[start]-1 {
+				start--
+			}
+			if first := int(after[start]); first >= read {
+				t.Errorf("normal speed resumed at sample %d, skipping what the stretcher read up to %d", first, read)
+			}
+			if start > s.stretcher.hop {
+				t.Errorf("%d samples before the source plays straight through, want at most %d", start, s.stretcher.hop)
+			}
+		})
+	}
+}
@@ -0,0 +1,798 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/mp3"
+	"github.com/gopxl/beep/v2/vorbis"
+)
+
+const (
+	// StreamPrebuffer is how much of a live stream is buffered before it
+	// plays, both at first and whenever the buffer runs dry.
+	StreamPrebuffer = 2 * time.Second
+	// streamBuffer is how far the download can get ahead of playback.
+	streamBuffer         = 10 * time.Second
+	streamConnectTimeout = 15 * time.Second
+	// A connection that sends nothing for this long is dropped and made
+	// again.
+	streamStallTimeout = 15 * time.Second
+	streamRetries      = 8
+	streamMaxBackoff   = 30 * time.Second
+	// Playlists can point at mirrors and further playlists; this caps how
+	// many URLs one connection attempt goes through.
+	maxStreamURLs   = 16
+	maxPlaylistSize = 1 << 20
+)
+
+var (
+	errStreamEnded   = errors.New("the server ended the stream")
+	errStreamStalled = errors.New("the server stopped sending audio")
+)
+
+// streamDecoders decode the codecs with a native decoder from a network
+// stream. Anything else goes through ffmpeg.
+var streamDecoders = map[string]func(io.ReadCloser) (beep.StreamSeekCloser, beep.Format, error){
+	"MP3":        mp3.Decode,
+	"Ogg Vorbis": vorbis.Decode,
+}
+
+type StreamState int
+
+const (
+	StreamConnecting StreamState = iota
+	StreamBuffering
+	StreamPlaying
+	StreamReconnecting
+	StreamFailed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamConnecting:
+		return "connecting"
+	case StreamBuffering:
+		return "buffering"
+	case StreamPlaying:
+		return "playing"
+	case StreamReconnecting:
+		return "reconnecting"
+	case StreamFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// StreamStatus describes a live stream as it plays.
+type StreamStatus struct {
+	State StreamState
+	// Station is the name the server gives the stream and Title what it
+	// says is on now. Either can be empty.
+	Station string
+	Title   string
+	// Buffered is how much audio is waiting to be played.
+	Buffered time.Duration
+	// Attempt counts the tries since audio last came through, and Err is
+	// why the last connection ended.
+	Attempt int
+	Err     error
+}
+
+// IsStreamURL reports whether path is an http(s) URL rather than a file.
+func IsStreamURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// httpStream plays an internet radio station or another live HTTP stream.
+// Once it is first streamed from, a goroutine downloads and decodes it into
+// a buffer ahead of playback, so the speaker never waits on the network;
+// while the buffer fills, or after it runs dry, it plays silence. Dropped
+// connections are made again with a growing delay, and playback only ends
+// once streamRetries attempts in a row have failed.
+type httpStream struct {
+	url        string
+	sampleRate beep.SampleRate
+	quality    int
+	// onTitle is called from Stream when playback reaches a new title,
+	// and onFail on the download goroutine when the stream gives up.
+	onTitle func(title string)
+	onFail  func(err error)
+
+	mu        sync.Mutex
+	space     *sync.Cond
+	buffer    [][2]float64
+	start     int
+	size      int
+	prebuffer int
+	buffering bool
+	// written and played count the samples that went in and out of the
+	// buffer since it was last emptied. A title announced while the
+	// buffer is ahead waits in titles until playback catches up with it.
+	written int
+	played  int
+	titles  []streamTitle
+	// session identifies the running download. Stopping moves it on, which
+	// tells the goroutine its writes are no longer wanted.
+	session int
+	cancel  context.CancelFunc
+	status  StreamStatus
+	failed  bool
+	closed  bool
+}
+
+// openStream prepares a live stream. Nothing is downloaded until it is
+// first streamed from.
+func openStream(rawURL string, speakerFormat beep.Format, quality int) *preparedTrack {
+	stream := newHTTPStream(rawURL, speakerFormat.SampleRate, quality)
+	gain := newGainStreamer(stream)
+	return &preparedTrack{
+		path:     rawURL,
+		streamer: newPositionStreamer(gain),
+		gain:     gain,
+		format:   speakerFormat,
+		stream:   stream,
+	}
+}
+
+func newHTTPStream(rawURL string, sampleRate beep.SampleRate, quality int) *httpStream {
+	s := &httpStream{
+		url:        rawURL,
+		sampleRate: sampleRate,
+		quality:    quality,
+		buffer:     make([][2]float64, sampleRate.N(streamBuffer)),
+		prebuffer:  sampleRate.N(StreamPrebuffer),
+		buffering:  true,
+	}
+	s.space = sync.NewCond(&s.mu)
+	return s
+}
+
+// streamTitle is a title and the sample it was announced at.
+type streamTitle struct {
+	at    int
+	title string
+}
+
+func (s *httpStream) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	n, ok = s.streamUnsafe(samples)
+	title, changed := s.takeTitleUnsafe()
+	s.mu.Unlock()
+
+	if changed && s.onTitle != nil {
+		s.onTitle(title)
+	}
+	return n, ok
+}
+
+func (s *httpStream) streamUnsafe(samples [][2]float64) (n int, ok bool) {
+	if s.closed {
+		return 0, false
+	}
+	if s.failed {
+		// Play out what was buffered before giving up.
+		n = s.readUnsafe(samples)
+		return n, n > 0
+	}
+	if s.cancel == nil {
+		s.startUnsafe()
+	}
+
+	if s.buffering && s.size >= s.prebuffer {
+		s.buffering = false
+	}
+	if !s.buffering {
+		n = s.readUnsafe(samples)
+		if n < len(samples) {
+			s.buffering = true
+		}
+	}
+	clear(samples[n:])
+	return len(samples), true
+}
+
+func (s *httpStream) readUnsafe(samples [][2]float64) int {
+	n := min(len(samples), s.size)
+	for i := range samples[:n] {
+		samples[i] = s.buffer[(s.start+i)%len(s.buffer)]
+	}
+	s.start = (s.start + n) % len(s.buffer)
+	s.size -= n
+	s.played += n
+	if n > 0 {
+		s.space.Signal()
+	}
+	return n
+}
+
+// write adds decoded audio to the buffer, waiting while it is full. It
+// returns false once the download has been stopped.
+func (s *httpStream) write(session int, samples [][2]float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(samples) > 0 {
+		if session != s.session || s.closed {
+			return false
+		}
+		room := len(s.buffer) - s.size
+		if room == 0 {
+			s.space.Wait()
+			continue
+		}
+		n := min(room, len(samples))
+		end := s.start + s.size
+		for i, sample := range samples[:n] {
+			s.buffer[(end+i)%len(s.buffer)] = sample
+		}
+		s.size += n
+		s.written += n
+		samples = samples[n:]
+	}
+	return true
+}
+
+// takeTitleUnsafe moves on to the last title playback has reached, and
+// reports it if it differs from the one shown.
+func (s *httpStream) takeTitleUnsafe() (string, bool) {
+	due := 0
+	for due < len(s.titles) && s.titles[due].at <= s.played {
+		due++
+	}
+	if due == 0 {
+		return "", false
+	}
+	title := s.titles[due-1].title
+	s.titles = s.titles[due:]
+	if title == s.status.Title {
+		return "", false
+	}
+	s.status.Title = title
+	return title, true
+}
+
+func (s *httpStream) startUnsafe() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.session++
+	go s.run(ctx, s.session)
+}
+
+// stopUnsafe drops the connection and what was buffered. The next call to
+// Stream connects again.
+func (s *httpStream) stopUnsafe() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.session++
+	s.space.Broadcast()
+	s.start, s.size = 0, 0
+	s.written, s.played = 0, 0
+	s.titles = nil
+	s.buffering = true
+	s.failed = false
+	s.status = StreamStatus{State: StreamConnecting, Station: s.status.Station, Title: s.status.Title}
+}
+
+func (s *httpStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed {
+		return s.status.Err
+	}
+	return nil
+}
+
+func (s *httpStream) Len() int {
+	return 0
+}
+
+func (s *httpStream) Position() int {
+	return 0
+}
+
+// Seek can only go back to the start, which stops the download, so that
+// playing again picks the stream up live rather than where it was left.
+func (s *httpStream) Seek(p int) error {
+	if p != 0 {
+		return fmt.Errorf("can't seek in a live stream")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopUnsafe()
+	return nil
+}
+
+func (s *httpStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopUnsafe()
+	s.closed = true
+	return nil
+}
+
+// Status reports on the stream, with the buffer's state folded in.
+func (s *httpStream) Status() StreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	if status.State == StreamPlaying && s.buffering {
+		status.State = StreamBuffering
+	}
+	status.Buffered = s.sampleRate.D(s.size)
+	return status
+}
+
+// update changes the status if session is still the running download.
+func (s *httpStream) update(session int, change func(status *StreamStatus)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session != s.session || s.closed {
+		return false
+	}
+	change(&s.status)
+	return true
+}
+
+// setTitle queues a title to be shown once the audio written so far has
+// played, since the buffer holds several seconds that came before it.
+func (s *httpStream) setTitle(session int, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session != s.session || s.closed {
+		return
+	}
+	// Servers repeat the title in every block.
+	last := s.status.Title
+	if len(s.titles) > 0 {
+		last = s.titles[len(s.titles)-1].title
+	}
+	if title != last {
+		s.titles = append(s.titles, streamTitle{at: s.written, title: title})
+	}
+}
+
+func (s *httpStream) fail(session int, err error) {
+	s.mu.Lock()
+	current := session == s.session && !s.closed
+	if current {
+		s.failed = true
+		s.status.State = StreamFailed
+		s.status.Err = err
+	}
+	s.mu.Unlock()
+
+	if current && s.onFail != nil {
+		s.onFail(err)
+	}
+}
+
+// run keeps the stream connected until it is stopped or gives up.
+func (s *httpStream) run(ctx context.Context, session int) {
+	connected := false
+	for attempt := 0; ; {
+		received, err := s.download(ctx, session)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			connected = true
+			attempt = 0
+		}
+		attempt++
+
+		// A stream that never played and is refused outright won't be
+		// any different a moment later.
+		var statusErr *httpStatusError
+		refused := errors.As(err, &statusErr) && statusErr.permanent()
+		if attempt > streamRetries || (!connected && refused) {
+			s.fail(session, err)
+			return
+		}
+
+		state := StreamConnecting
+		if connected {
+			state = StreamReconnecting
+		}
+		s.update(session, func(status *StreamStatus) {
+			status.State = state
+			status.Attempt = attempt
+			status.Err = err
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(time.Second<<(attempt-1), streamMaxBackoff)):
+		}
+	}
+}
+
+// download connects and fills the buffer until the connection ends. It
+// reports whether any audio came through.
+func (s *httpStream) download(ctx context.Context, session int) (received bool, err error) {
+	conn, err := s.connect(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	defer conn.close()
+
+	s.update(session, func(status *StreamStatus) {
+		status.State = StreamPlaying
+		if conn.station != "" {
+			status.Station = conn.station
+		}
+		status.Attempt = 0
+		status.Err = nil
+	})
+
+	samples := make([][2]float64, 4096)
+	for {
+		n, ok := conn.streamer.Stream(samples)
+		if n > 0 {
+			received = true
+			if !s.write(session, samples[:n]) {
+				return received, ctx.Err()
+			}
+		}
+		if !ok {
+			if err := conn.streamer.Err(); err != nil {
+				return received, err
+			}
+			return received, errStreamEnded
+		}
+	}
+}
+
+// streamConn is one open connection to the stream.
+type streamConn struct {
+	body     io.ReadCloser
+	decoder  beep.StreamSeekCloser
+	streamer beep.Streamer
+	station  string
+	cancel   context.CancelFunc
+}
+
+func (c *streamConn) close() {
+	// Cancelling first unblocks anything still reading from the body.
+	c.cancel()
+	c.decoder.Close()
+	c.body.Close()
+}
+
+// connect opens the stream, following playlists to the streams they list
+// and trying each in turn.
+func (s *httpStream) connect(ctx context.Context, session int) (*streamConn, error) {
+	urls := []string{s.url}
+	var lastErr error
+	for i := 0; i < len(urls) && i < maxStreamURLs; i++ {
+		conn, entries, err := s.open(ctx, session, urls[i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if conn != nil {
+			return conn, nil
+		}
+		if len(entries) == 0 {
+			lastErr = fmt.Errorf("playlist %s lists no streams", urls[i])
+		}
+		urls = append(urls, entries...)
+	}
+	return nil, lastErr
+}
+
+// open requests rawURL. A playlist comes back as the stream URLs it lists,
+// anything else as a connection ready to decode.
+func (s *httpStream) open(ctx context.Context, session int, rawURL string) (*streamConn, []string, error) {
+	connCtx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(connCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("invalid stream URL: %w", err)
+	}
+	req.Header.Set("Icy-MetaData", "1")
+	req.Header.Set("User-Agent", "kanade")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, &httpStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if isPlaylistResponse(contentType, rawURL) {
+		defer cancel()
+		defer resp.Body.Close()
+		entries, err := ParsePlaylist(io.LimitReader(resp.Body, maxPlaylistSize), rawURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read playlist %s: %w", rawURL, err)
+		}
+		var urls []string
+		for _, entry := range entries {
+			if IsStreamURL(entry.URL) {
+				urls = append(urls, entry.URL)
+			}
+		}
+		return nil, urls, nil
+	}
+
+	var body io.Reader = newStallReader(resp.Body, cancel)
+	if metaint, err := strconv.Atoi(resp.Header.Get("Icy-Metaint")); err == nil && metaint > 0 {
+		body = newICYReader(body, metaint, func(title string) {
+			s.setTitle(session, title)
+		})
+	}
+
+	decoder, format, err := decodeStream(body, contentType, rawURL)
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, err
+	}
+
+	var streamer beep.Streamer = decoder
+	if format.SampleRate != s.sampleRate {
+		streamer = beep.Resample(s.quality, format.SampleRate, s.sampleRate, decoder)
+	}
+	return &streamConn{
+		body:     resp.Body,
+		decoder:  decoder,
+		streamer: streamer,
+		station:  toUTF8(strings.TrimSpace(resp.Header.Get("Icy-Name"))),
+		cancel:   cancel,
+	}, nil, nil
+}
+
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return "server returned " + e.status
+}
+
+// permanent reports whether the request itself was refused, as opposed to
+// the server being busy or failing.
+func (e *httpStatusError) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
+
+// decodeStream picks a decoder by sniffing the start of the stream.
+func decodeStream(body io.Reader, contentType, rawURL string) (beep.StreamSeekCloser, beep.Format, error) {
+	reader := bufio.NewReader(body)
+	// A short or failed peek just leaves less to match; the decoder will
+	// report the error.
+	header, _ := reader.Peek(sniffSize)
+
+	codec := streamCodec(header, contentType, rawURL)
+	if codec != nil {
+		if decode, ok := streamDecoders[codec.Name]; ok {
+			streamer, format, err := decode(io.NopCloser(reader))
+			if err != nil {
+				return nil, beep.Format{}, fmt.Errorf("failed to decode %s stream: %w", codec.Name, err)
+			}
+			return streamer, format, nil
+		}
+	}
+	if FFmpegAvailable() {
+		return decodeReaderWithFFmpeg(reader)
+	}
+	if codec != nil {
+		return nil, beep.Format{}, fmt.Errorf("no decoder available for %s", codec.Name)
+	}
+	return nil, beep.Format{}, fmt.Errorf("unsupported stream format %q", contentType)
+}
+
+// streamCodec works out a stream's codec from its first bytes, then its
+// content type and then the extension in its URL.
+func streamCodec(header []byte, contentType, rawURL string) *Codec {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	codecs.mu.RLock()
+	var byType *Codec
+	for _, codec := range codecs.list {
+		if codec.Match != nil && codec.Match(header) {
+			codecs.mu.RUnlock()
+			return codec
+		}
+		if byType == nil && slices.Contains(codec.MimeTypes, mediaType) {
+			byType = codec
+		}
+	}
+	codecs.mu.RUnlock()
+
+	if byType != nil {
+		return byType
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		return CodecForExtension(u.Path)
+	}
+	return nil
+}
+
+// streamClient has no overall timeout, since a stream never finishes;
+// stalls are caught by stallReader instead.
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialICY,
+		TLSHandshakeTimeout:   streamConnectTimeout,
+		ResponseHeaderTimeout: streamConnectTimeout,
+	},
+}
+
+var streamDialer = &net.Dialer{Timeout: streamConnectTimeout, KeepAlive: 30 * time.Second}
+
+// dialICY connects like the default transport, but lets net/http read the
+// "ICY 200 OK" status line older SHOUTcast servers answer with.
+func dialICY(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := streamDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &icyConn{Conn: conn}, nil
+}
+
+// icyConn rewrites an ICY status line to HTTP/1.0. Over TLS it only sees
+// the handshake, which is left alone.
+type icyConn struct {
+	net.Conn
+	checked bool
+	pending []byte
+}
+
+func (c *icyConn) Read(p []byte) (int, error) {
+	if !c.checked {
+		c.checked = true
+		head := make([]byte, 4)
+		n, err := io.ReadFull(c.Conn, head)
+		if n == 0 {
+			return 0, err
+		}
+		c.pending = head[:n]
+		if bytes.Equal(c.pending, []byte("ICY ")) {
+			c.pending = []byte("HTTP/1.0 ")
+		}
+	}
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// stallReader cancels the connection when a read waits longer than
+// streamStallTimeout. Only time spent waiting on the network counts, so a
+// full buffer holding up the reads doesn't trip it.
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newStallReader(r io.Reader, cancel func()) *stallReader {
+	s := &stallReader{r: r}
+	s.timer = time.AfterFunc(streamStallTimeout, func() {
+		s.stalled.Store(true)
+		cancel()
+	})
+	s.timer.Stop()
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	s.timer.Reset(streamStallTimeout)
+	n, err := s.r.Read(p)
+	s.timer.Stop()
+	if err != nil && s.stalled.Load() {
+		err = errStreamStalled
+	}
+	return n, err
+}
+
+// icyReader strips the metadata blocks a server sends every metaint bytes
+// of audio when asked with Icy-MetaData, and passes on the titles in them.
+type icyReader struct {
+	r         io.Reader
+	metaint   int
+	remaining int
+	onTitle   func(title string)
+}
+
+func newICYReader(r io.Reader, metaint int, onTitle func(title string)) *icyReader {
+	return &icyReader{r: r, metaint: metaint, remaining: metaint, onTitle: onTitle}
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.remaining == 0 {
+		if err := r.readMetadata(); err != nil {
+			return 0, err
+		}
+		r.remaining = r.metaint
+	}
+	n, err := r.r.Read(p[:min(len(p), r.remaining)])
+	r.remaining -= n
+	return n, err
+}
+
+// readMetadata reads one block: a length byte counting 16-byte units, then
+// fields like StreamTitle='...'; padded with zeros.
+func (r *icyReader) readMetadata() error {
+	var length [1]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return err
+	}
+	if length[0] == 0 {
+		return nil
+	}
+	block := make([]byte, int(length[0])*16)
+	if _, err := io.ReadFull(r.r, block); err != nil {
+		return err
+	}
+	if title, ok := parseStreamTitle(string(bytes.TrimRight(block, "\x00"))); ok {
+		r.onTitle(title)
+	}
+	return nil
+}
+
+// parseStreamTitle finds the StreamTitle field. Titles can contain quotes,
+// so the value runs to the "';" that ends the field.
+func parseStreamTitle(metadata string) (string, bool) {
+	const key = "StreamTitle='"
+	start := strings.Index(metadata, key)
+	if start < 0 {
+		return "", false
+	}
+	value := metadata[start+len(key):]
+	if end := strings.Index(value, "';"); end >= 0 {
+		value = value[:end]
+	} else {
+		value = strings.TrimSuffix(value, "'")
+	}
+	return toUTF8(strings.TrimSpace(value)), true
+}
+
+// toUTF8 reads text that isn't valid UTF-8 as Latin-1, which is what older
+// servers send.
+func toUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, len(s))
+	for i := range len(s) {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,304 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// byteDecoder plays each byte of a stream as one sample of that value, so
+// tests can tell which response the audio came from.
+type byteDecoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *byteDecoder) Stream(samples [][2]float64) (int, bool) {
+	buf := make([]byte, len(samples))
+	n, err := d.r.Read(buf)
+	for i, b := range buf[:n] {
+		samples[i] = [2]float64{float64(b), float64(b)}
+	}
+	if n == 0 && err != nil {
+		if err != io.EOF {
+			d.err = err
+		}
+		return 0, false
+	}
+	return n, true
+}
+
+func (d *byteDecoder) Err() error     { return d.err }
+func (d *byteDecoder) Len() int       { return 0 }
+func (d *byteDecoder) Position() int  { return 0 }
+func (d *byteDecoder) Seek(int) error { return nil }
+func (d *byteDecoder) Close() error   { return nil }
+
+func useByteDecoder(t *testing.T) {
+	t.Helper()
+	previous := streamDecoders["MP3"]
+	streamDecoders["MP3"] = func(r io.ReadCloser) (beep.StreamSeekCloser, beep.Format, error) {
+		return &byteDecoder{r: r}, beep.Format{SampleRate: testSampleRate, NumChannels: 2, Precision: 2}, nil
+	}
+	t.Cleanup(func() { streamDecoders["MP3"] = previous })
+}
+
+// playStream streams from s until done is satisfied, failing after a
+// timeout.
+func playStream(t *testing.T, s *httpStream, done func(samples [][2]float64) bool) {
+	t.Helper()
+
+	samples := make([][2]float64, 4096)
+	timeout := time.After(5 * time.Second)
+	for {
+		n, _ := s.Stream(samples)
+		if done(samples[:n]) {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("timed out, stream status %+v", s.Status())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestStreamReconnectsAfterDrop(t *testing.T) {
+	useByteDecoder(t)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live.m3u":
+			w.Header().Set("Content-Type", "audio/x-mpegurl")
+			io.WriteString(w, "#EXTM3U\n#EXTINF:-1,Live\nstream.mp3\n")
+		case "/stream.mp3":
+			w.Header().Set("Content-Type", "audio/mpeg")
+			if requests.Add(1) == 1 {
+				w.Write(bytes.Repeat([]byte{1}, 20000))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Write(bytes.Repeat([]byte{2}, 200000))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := newHTTPStream(server.URL+"/live.m3u", testSampleRate, 1)
+	failed := make(chan error, 1)
+	s.onFail = func(err error) { failed <- err }
+	defer s.Close()
+
+	var first, second int
+	playStream(t, s, func(samples [][2]float64) bool {
+		for _, sample := range samples {
+			switch sample[0] {
+			case 1:
+				if second > 0 {
+					t.Fatal("audio from the dropped connection played after the new one")
+				}
+				first++
+			case 2:
+				second++
+			}
+		}
+		return second > 0
+	})
+
+	if first != 20000 {
+		t.Errorf("played %d samples from before the drop, want 20000", first)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("stream was requested %d times, want 2", n)
+	}
+	if status := s.Status(); status.State != StreamPlaying || status.Err != nil {
+		t.Errorf("status after reconnecting = %+v", status)
+	}
+	select {
+	case err := <-failed:
+		t.Errorf("stream failed: %v", err)
+	default:
+	}
+}
+
+func TestStreamGivesUpWhenRefused(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "no such mount", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	s := newHTTPStream(server.URL+"/missing", testSampleRate, 1)
+	failed := make(chan error, 1)
+	s.onFail = func(err error) { failed <- err }
+	defer s.Close()
+
+	playStream(t, s, func([][2]float64) bool { return s.Err() != nil })
+
+	var statusErr *httpStatusError
+	if err := <-failed; !errors.As(err, &statusErr) || statusErr.code != http.StatusNotFound {
+		t.Errorf("failed with %v, want a 404", err)
+	}
+	if state := s.Status().State; state != StreamFailed {
+		t.Errorf("state = %v, want failed", state)
+	}
+	if n, ok := s.Stream(make([][2]float64, 512)); n != 0 || ok {
+		t.Errorf("failed stream returned %d, %v", n, ok)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("refused stream was requested %d times, want 1", n)
+	}
+}
+
+// icyBlock encodes metadata as a length byte and zero padding.
+func icyBlock(metadata string) []byte {
+	length := (len(metadata) + 15) / 16
+	block := make([]byte, 1+length*16)
+	block[0] = byte(length)
+	copy(block[1:], metadata)
+	return block
+}
+
+func TestICYReader(t *testing.T) {
+	var raw []byte
+	raw = append(raw, "abcd"...)
+	raw = append(raw, icyBlock("StreamTitle='Guns N' Roses - Don't Cry';StreamUrl='';")...)
+	raw = append(raw, "efgh"...)
+	raw = append(raw, 0)
+	raw = append(raw, "ijkl"...)
+	raw = append(raw, icyBlock("StreamTitle='Beyonc\xe9 - Halo';")...)
+	raw = append(raw, "mn"...)
+
+	var titles []string
+	r := newICYReader(bytes.NewReader(raw), 4, func(title string) {
+		titles = append(titles, title)
+	})
+	audio, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(audio) != "abcdefghijklmn" {
+		t.Errorf("audio = %q, want the metadata stripped", audio)
+	}
+	want := []string{"Guns N' Roses - Don't Cry", "Beyoncé - Halo"}
+	if !slices.Equal(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+}
+
+func TestParseStreamTitle(t *testing.T) {
+	tests := []struct {
+		metadata string
+		title    string
+		ok       bool
+	}{
+		{"StreamTitle='Artist - Song';", "Artist - Song", true},
+		{"StreamTitle='It's a 'quoted' title';StreamUrl='http://x/';", "It's a 'quoted' title", true},
+		{"StreamTitle='No terminator'", "No terminator", true},
+		{"StreamTitle='';", "", true},
+		{"StreamTitle='Mot\xf6rhead - Ace of Spades';", "Motörhead - Ace of Spades", true},
+		{"StreamTitle='Motörhead';", "Motörhead", true},
+		{"StreamUrl='http://x/';", "", false},
+	}
+	for _, test := range tests {
+		title, ok := parseStreamTitle(test.metadata)
+		if title != test.title || ok != test.ok {
+			t.Errorf("parseStreamTitle(%q) = %q, %v, want %q, %v", test.metadata, title, ok, test.title, test.ok)
+		}
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	pls := `[playlist]
+File2=http://backup.example/stream
+Title2=Backup
+File1=http://main.example/stream
+Title1=Main
+NumberOfEntries=2
+Version=2
+`
+	entries, err := ParsePlaylist(strings.NewReader(pls), "http://radio.example/listen.pls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PlaylistEntry{
+		{URL: "http://main.example/stream", Title: "Main"},
+		{URL: "http://backup.example/stream", Title: "Backup"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("PLS entries = %+v, want %+v", entries, want)
+	}
+
+	m3u := "\ufeff#EXTM3U\n#EXTINF:-1,Jazz, live\nhttp://jazz.example/live\n\n/mounts/news.mp3\nlow/stream.aac\n"
+	entries, err = ParsePlaylist(strings.NewReader(m3u), "http://radio.example/lists/all.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []PlaylistEntry{
+		{URL: "http://jazz.example/live", Title: "Jazz, live"},
+		{URL: "http://radio.example/mounts/news.mp3"},
+		{URL: "http://radio.example/lists/low/stream.aac"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("M3U entries = %+v, want %+v", entries, want)
+	}
+
+	entries, err = ParsePlaylist(strings.NewReader("song.mp3\n../other.flac\n"), "/music/lists/mix.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []PlaylistEntry{{URL: "/music/lists/song.mp3"}, {URL: "/music/other.flac"}}
+	if !slices.Equal(entries, want) {
+		t.Errorf("local entries = %+v, want %+v", entries, want)
+	}
+
+	hls := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nsegment0.ts\n"
+	if _, err := ParsePlaylist(strings.NewReader(hls), "http://radio.example/live.m3u8"); err == nil {
+		t.Error("parsed an HLS playlist")
+	}
+	if _, err := ParsePlaylist(strings.NewReader("\n\n"), ""); err == nil {
+		t.Error("parsed an empty playlist")
+	}
+}
+
+func TestStreamTitleWaitsForPlayback(t *testing.T) {
+	s := newHTTPStream("http://radio.example/live", testSampleRate, 1)
+	// Stand in for the download goroutine.
+	s.cancel = func() {}
+	var shown []string
+	s.onTitle = func(title string) { shown = append(shown, title) }
+
+	second := make([][2]float64, testSampleRate.N(StreamPrebuffer))
+	s.setTitle(s.session, "First")
+	s.write(s.session, second)
+	s.setTitle(s.session, "Second")
+	s.setTitle(s.session, "Second")
+	s.write(s.session, second)
+
+	samples := make([][2]float64, len(second)*3/4)
+	s.Stream(samples)
+	if len(shown) != 1 || shown[0] != "First" {
+		t.Fatalf("second title shown before its audio played: %q", shown)
+	}
+	s.Stream(samples)
+	if len(shown) != 2 || shown[1] != "Second" {
+		t.Fatalf("titles shown = %q, want [First Second]", shown)
+	}
+	if title := s.Status().Title; title != "Second" {
+		t.Errorf("status title = %q, want Second", title)
+	}
+}
@@ -0,0 +1,215 @@
+package audio
+
+import (
+	"math"
+	"slices"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const (
+	stretchFrame     = 46 * 1e-3
+	stretchTolerance = 12 * 1e-3
+	// Only every stretchStride-th sample is compared when searching for
+	// the best overlap, which is plenty for finding a matching phase.
+	stretchStride = 4
+)
+
+// timeStretcher changes tempo without changing pitch using WSOLA: Hann
+// windowed frames are taken from the input at speed times the output
+// hop, each shifted by up to the tolerance so its waveform lines up with
+// what the previous frame would have continued with.
+type timeStretcher struct {
+	frame     int
+	hop       int
+	tolerance int
+	window    []float64
+
+	input   [][2]float64
+	drained bool
+	// pos is where the next frame would start without any shift and prev
+	// where the last one actually started, both relative to input[0].
+	pos     float64
+	prev    int
+	started bool
+
+	overlap  [][2]float64
+	ready    [][2]float64
+	out      [][2]float64
+	finished bool
+}
+
+func newTimeStretcher(sampleRate beep.SampleRate) *timeStretcher {
+	hop := max(int(float64(sampleRate)*stretchFrame)/2, 64)
+	frame := hop * 2
+
+	window := make([]float64, frame)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+	}
+
+	t := &timeStretcher{
+		frame:     frame,
+		hop:       hop,
+		tolerance: int(float64(sampleRate) * stretchTolerance),
+		window:    window,
+		overlap:   make([][2]float64, frame),
+		out:       make([][2]float64, hop),
+	}
+	t.reset()
+	return t
+}
+
+// reset drops everything buffered, e.g. after the source was seeked.
+func (t *timeStretcher) reset() {
+	t.input = t.input[:0]
+	t.drained = false
+	t.pos = 0
+	t.prev = 0
+	t.started = false
+	clear(t.overlap)
+	t.ready = nil
+	t.finished = false
+}
+
+// drain returns what has been read but not played: the rest of the last
+// frame put out, then the input from where the next frame would carry on.
+// It leaves the stretcher reset.
+func (t *timeStretcher) drain() [][2]float64 {
+	from := int(t.pos)
+	if t.started {
+		from = t.prev + t.hop
+	}
+	pending := slices.Clone(t.ready)
+	pending = append(pending, t.input[min(from, len(t.input)):]...)
+	t.reset()
+	return pending
+}
+
+func (t *timeStretcher) stream(source beep.Streamer, speed float64, samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		if len(t.ready) > 0 {
+			copied := copy(samples[n:], t.ready)
+			t.ready = t.ready[copied:]
+			n += copied
+			continue
+		}
+		if !t.nextFrame(source, speed) {
+			break
+		}
+	}
+	return n, n > 0
+}
+
+func (t *timeStretcher) nextFrame(source beep.Streamer, speed float64) bool {
+	if t.finished {
+		return false
+	}
+
+	nominal := int(t.pos)
+	t.fill(source, nominal+t.tolerance+t.frame)
+
+	if t.drained && nominal >= len(t.input) {
+		// Past the end of the input; let the last frame ring out.
+		copy(t.out, t.overlap[:t.hop])
+		t.ready = t.out
+		t.finished = true
+		return true
+	}
+
+	start := nominal
+	if t.started {
+		start = t.bestStart(t.prev+t.hop, nominal)
+	}
+
+	for i, w := range t.window {
+		x := t.at(start + i)
+		t.overlap[i][0] += x[0] * w
+		t.overlap[i][1] += x[1] * w
+	}
+	copy(t.out, t.overlap[:t.hop])
+	t.ready = t.out
+	copy(t.overlap, t.overlap[t.hop:])
+	clear(t.overlap[t.frame-t.hop:])
+
+	t.prev = start
+	t.started = true
+	t.pos += float64(t.hop) * speed
+	t.trim()
+	return true
+}
+
+// bestStart searches around nominal for the frame start whose waveform
+// matches the natural continuation of the previous frame best.
+func (t *timeStretcher) bestStart(natural, nominal int) int {
+	lo := max(nominal-t.tolerance, 0)
+	hi := nominal + t.tolerance
+
+	best, bestScore := nominal, math.Inf(-1)
+	for start := lo; start <= hi; start += 2 {
+		if score := t.similarity(natural, start); score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	for _, start := range []int{best - 1, best + 1} {
+		if start < lo || start > hi {
+			continue
+		}
+		if score := t.similarity(natural, start); score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	return best
+}
+
+// similarity is the cross-correlation of the two overlap regions,
+// normalized by the candidate's energy.
+func (t *timeStretcher) similarity(a, b int) float64 {
+	var corr, energy float64
+	for i := 0; i < t.hop; i += stretchStride {
+		x, y := t.at(a+i), t.at(b+i)
+		xm, ym := x[0]+x[1], y[0]+y[1]
+		corr += xm * ym
+		energy += ym * ym
+	}
+	if energy == 0 {
+		return 0
+	}
+	return corr / math.Sqrt(energy)
+}
+
+func (t *timeStretcher) at(i int) [2]float64 {
+	if i < 0 || i >= len(t.input) {
+		return [2]float64{}
+	}
+	return t.input[i]
+}
+
+func (t *timeStretcher) fill(source beep.Streamer, need int) {
+	for !t.drained && len(t.input) < need {
+		have := len(t.input)
+		want := need - have
+		if cap(t.input) < need {
+			grown := make([][2]float64, have, need+t.frame)
+			copy(grown, t.input)
+			t.input = grown
+		}
+		t.input = t.input[:need]
+		n, ok := source.Stream(t.input[have : have+want])
+		t.input = t.input[:have+n]
+		if !ok || n < want {
+			t.drained = true
+		}
+	}
+}
+
+// trim drops input that no later frame can reach.
+func (t *timeStretcher) trim() {
+	drop := min(t.prev+t.hop, int(t.pos)-t.tolerance, len(t.input))
+	if drop <= 0 {
+		return
+	}
+	t.input = t.input[:copy(t.input, t.input[drop:])]
+	t.prev -= drop
+	t.pos -= float64(drop)
+}
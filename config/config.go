@@ -0,0 +1,183 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dirName  = ".kanade"
+	fileName = "config.json"
+)
+
+type LibraryConfig struct {
+	Roots          []string `json:"roots"`
+	MaxDepth       int      `json:"max_depth"`
+	FollowSymlinks string   `json:"follow_symlinks"`
+	Watch          bool     `json:"watch"`
+}
+
+type PlaybackConfig struct {
+	// Crossfade is in seconds; zero plays tracks back to back.
+	Crossfade      float64 `json:"crossfade"`
+	CrossfadeCurve string  `json:"crossfade_curve"`
+
+	// TransportFade is how many milliseconds pausing, resuming, seeking,
+	// stopping and switching tracks fade over. Zero cuts instantly.
+	TransportFade int `json:"transport_fade_ms"`
+
+	// ReplayGain is off, track or album. Preamp and the default gain for
+	// untagged files are in dB.
+	ReplayGain                string  `json:"replaygain"`
+	ReplayGainPreamp          float64 `json:"replaygain_preamp"`
+	ReplayGainDefault         float64 `json:"replaygain_default"`
+	ReplayGainPreventClipping bool    `json:"replaygain_prevent_clipping"`
+
+	// Speed is from 0.5 to 2. SpeedMode is stretch, which keeps the pitch,
+	// or resample, which changes it along with the speed.
+	Speed     float64 `json:"speed"`
+	SpeedMode string  `json:"speed_mode"`
+
+	// SleepFade is how many seconds the sleep timer fades out over before
+	// it pauses. SleepQuit also closes kanade afterwards.
+	SleepFade float64 `json:"sleep_fade"`
+	SleepQuit bool    `json:"sleep_quit"`
+}
+
+type EqualizerConfig struct {
+	// Preset is applied at startup. Bands, when set, override it with ten
+	// gains in dB from 31 Hz to 16 kHz.
+	Preset  string               `json:"preset"`
+	Bands   []float64            `json:"bands"`
+	Presets map[string][]float64 `json:"presets"`
+}
+
+// OutputConfig picks where audio goes: the speaker, an ALSA device, a
+// null sink that discards it, or a WAV file. Realtime paces the null and
+// WAV outputs like a sound card instead of running as fast as possible.
+// A SampleRate of 0 follows the first track played.
+type OutputConfig struct {
+	Backend  string `json:"backend"`
+	Device   string `json:"device"`
+	File     string `json:"file"`
+	Realtime bool   `json:"realtime"`
+
+	SampleRate      int `json:"sample_rate"`
+	BufferSize      int `json:"buffer_ms"`
+	ResampleQuality int `json:"resample_quality"`
+}
+
+type Config struct {
+	Library   LibraryConfig   `json:"library"`
+	Playback  PlaybackConfig  `json:"playback"`
+	Equalizer EqualizerConfig `json:"equalizer"`
+	Output    OutputConfig    `json:"output"`
+}
+
+func Default() *Config {
+	return &Config{
+		Library: LibraryConfig{
+			Roots:          []string{},
+			MaxDepth:       -1,
+			FollowSymlinks: "files",
+			Watch:          true,
+		},
+		Playback: PlaybackConfig{
+			CrossfadeCurve:            "equal-power",
+			TransportFade:             60,
+			ReplayGain:                "track",
+			ReplayGainPreventClipping: true,
+			Speed:                     1,
+			SpeedMode:                 "stretch",
+			SleepFade:                 30,
+		},
+		Equalizer: EqualizerConfig{
+			Preset: "flat",
+		},
+		Output: OutputConfig{
+			Backend:         "speaker",
+			Realtime:        true,
+			SampleRate:      44100,
+			BufferSize:      25,
+			ResampleQuality: 4,
+		},
+	}
+}
+
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, dirName), nil
+}
+
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+func Load() (*Config, error) {
+	cfg := Default()
+
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return Default(), fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	for i, root := range cfg.Library.Roots {
+		cfg.Library.Roots[i] = ExpandHome(root)
+	}
+	cfg.Output.File = ExpandHome(cfg.Output.File)
+
+	return cfg, nil
+}
+
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
+// WriteFileAtomic replaces path with data by writing it to a temporary
+// file alongside and renaming that over path, so an interrupted write
+// never leaves a truncated file behind.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
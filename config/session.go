@@ -0,0 +1,55 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Session is what kanade remembers between runs so it can pick up where
+// it left off. Modes and the view are stored by name.
+type Session struct {
+	Song     string        `json:"song"`
+	Position time.Duration `json:"position"`
+	Volume   float64       `json:"volume"`
+
+	Queue        []string `json:"queue"`
+	QueueCurrent int      `json:"queue_current"`
+	Shuffle      string   `json:"shuffle"`
+	Repeat       string   `json:"repeat"`
+
+	Grouping       string   `json:"grouping"`
+	ExpandedGroups []string `json:"expanded_groups"`
+	View           string   `json:"view"`
+}
+
+// LoadSession reads the saved session. A missing file is not an error and
+// gives a nil session.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", path, err)
+	}
+	return &session, nil
+}
+
+func (s *Session) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
@@ -23,17 +23,14 @@ type ffbinariesResponse struct {
 	} `json:"bin"`
 }
 
-func (m *DownloadManager) ensureFFmpeg(ctx context.Context, item *DownloadItem) (string, error) {
+func FindFFmpeg(downloadDir string) (string, bool) {
 	if path, err := exec.LookPath("ffmpeg"); err == nil {
-		return path, nil
+		return path, true
 	}
 
-	installDir, err := m.ffmpegInstallDir()
+	installDir, err := ffmpegInstallDir(downloadDir)
 	if err != nil {
-		return "", err
-	}
-	if err := os.MkdirAll(installDir, 0o755); err != nil {
-		return "", fmt.Errorf("failed to create ffmpeg dir: %w", err)
+		return "", false
 	}
 
 	exeName := "ffmpeg"
@@ -42,7 +39,22 @@ func (m *DownloadManager) ensureFFmpeg(ctx context.Context, item *DownloadItem)
 	}
 	localPath := filepath.Join(installDir, exeName)
 	if st, err := os.Stat(localPath); err == nil && st.Size() > 0 {
-		return localPath, nil
+		return localPath, true
+	}
+	return "", false
+}
+
+func (m *DownloadManager) ensureFFmpeg(ctx context.Context, item *DownloadItem) (string, error) {
+	if path, ok := FindFFmpeg(m.downloadDir); ok {
+		return path, nil
+	}
+
+	installDir, err := ffmpegInstallDir(m.downloadDir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(installDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create ffmpeg dir: %w", err)
 	}
 
 	url, size, derr := m.ffbinariesURL()
@@ -67,14 +79,14 @@ func (m *DownloadManager) ensureFFmpeg(ctx context.Context, item *DownloadItem)
 	return ffmpegPath, nil
 }
 
-func (m *DownloadManager) ffmpegInstallDir() (string, error) {
+func ffmpegInstallDir(downloadDir string) (string, error) {
 	cacheRoot, err := os.UserCacheDir()
 	if err != nil || cacheRoot == "" {
 		exeDir, derr := os.Executable()
 		if derr == nil {
 			return filepath.Join(filepath.Dir(exeDir), "ffmpeg"), nil
 		}
-		return filepath.Join(m.downloadDir, "ffmpeg"), nil
+		return filepath.Join(downloadDir, "ffmpeg"), nil
 	}
 	return filepath.Join(cacheRoot, "kanade", "ffmpeg"), nil
 }
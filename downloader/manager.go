@@ -12,10 +12,10 @@ import (
 	"sync"
 	"time"
 
+	"kanade/audio"
 	lib "kanade/library"
 	"kanade/metadata"
 
-	"github.com/dhowden/tag"
 	"github.com/kkdai/youtube/v2"
 )
 
@@ -130,6 +130,7 @@ func (m *DownloadManager) Start() {
 		} else {
 			m.ffmpegPath = path
 			m.ffmpegReady = true
+			audio.SetFFmpegPath(path)
 			m.updateStatus(setupID, Completed, "")
 		}
 		close(m.ffmpegDone)
@@ -743,13 +744,16 @@ func (m *DownloadManager) extractMetadataAndCreateSong(filePath string) (*lib.So
 		baseName := filepath.Base(filePath)
 		name := strings.TrimSuffix(baseName, filepath.Ext(baseName))
 
-		return &lib.Song{
+		song := &lib.Song{
 			Title:  name,
 			Artist: "Unknown",
 			Album:  name,
 			Genre:  "Unknown",
 			Path:   filePath,
-		}, nil
+			Root:   m.downloadDir,
+		}
+		song.LoadStreamInfo()
+		return song, nil
 	}
 
 	title := meta.Title()
@@ -773,19 +777,23 @@ func (m *DownloadManager) extractMetadataAndCreateSong(filePath string) (*lib.So
 		genre = "Unknown"
 	}
 
-	var picture *tag.Picture
-	if pic := meta.Picture(); pic != nil {
-		picture = pic
-	}
-
-	return &lib.Song{
-		Title:   title,
-		Artist:  artist,
-		Album:   album,
-		Genre:   genre,
-		Picture: picture,
-		Path:    filePath,
-	}, nil
+	song := &lib.Song{
+		Title:       title,
+		Artist:      artist,
+		Album:       album,
+		Genre:       genre,
+		AlbumArtist: meta.AlbumArtist(),
+		Composer:    meta.Composer(),
+		Year:        meta.Year(),
+		HasPicture:  meta.Picture() != nil,
+		Path:        filePath,
+		Root:        m.downloadDir,
+	}
+	song.TrackNumber, _ = meta.Track()
+	song.DiscNumber, _ = meta.Disc()
+	song.SetReplayGain(metadata.ReadReplayGain(meta))
+	song.LoadStreamInfo()
+	return song, nil
 }
 
 func (m *DownloadManager) updateStatus(id string, status Status, errorMsg string) {
@@ -8,8 +8,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
+	"kanade/audio"
 	lib "kanade/library"
 	"kanade/tui"
 
@@ -23,6 +23,7 @@ const mprisBaseInterface = "org.mpris.MediaPlayer2"
 
 type MediaPlayer struct {
 	model       *tui.Model
+	conn        *dbus.Conn
 	props       *prop.Properties
 	lastTrackID string
 }
@@ -52,28 +53,24 @@ func (p *MediaPlayer) Previous() *dbus.Error {
 func (p *MediaPlayer) Play() *dbus.Error {
 	log.Println("D-Bus: Play called")
 	p.model.ControlPlayback(tui.Play)
-	p.Update(p.model.SelectedSong, true)
 	return nil
 }
 
 func (p *MediaPlayer) Pause() *dbus.Error {
 	log.Println("D-Bus: Pause called")
 	p.model.ControlPlayback(tui.Pause)
-	p.Update(p.model.SelectedSong, false)
 	return nil
 }
 
 func (p *MediaPlayer) PlayPause() *dbus.Error {
 	log.Println("D-Bus: PlayPause called")
 	p.model.ControlPlayback(tui.PlayPause)
-	p.Update(p.model.SelectedSong, p.model.AudioPlayer.IsPlaying())
 	return nil
 }
 
 func (p *MediaPlayer) Stop() *dbus.Error {
 	log.Println("D-Bus: Stop called")
 	p.model.ControlPlayback(tui.Stop)
-	p.Update(nil, false)
 	return nil
 }
 
@@ -99,31 +96,47 @@ func (p *MediaPlayer) Update(song *lib.Song, isPlaying bool) {
 			p.setMetadata(metadata)
 		}
 	}
-
-	if p.model != nil && p.model.AudioPlayer != nil {
-		pos := p.model.AudioPlayer.GetPlaybackPosition().Microseconds()
-		if err := p.props.Set(mprisPlayerInterface, "Position", dbus.MakeVariant(int64(pos))); err != nil {
-			log.Printf("D-Bus: failed updating Position: %v", err)
-		}
-	}
 }
 
+// The properties below are read-only to clients, so they are changed
+// with SetMust; Set is the D-Bus method and refuses to write them.
+
 func (p *MediaPlayer) setMetadata(metadata map[string]dbus.Variant) {
-	if err := p.props.Set(mprisPlayerInterface, "Metadata", dbus.MakeVariant(metadata)); err != nil {
-		log.Printf("D-Bus: failed updating Metadata: %v", err)
-		return
-	}
+	p.props.SetMust(mprisPlayerInterface, "Metadata", metadata)
 	log.Println("D-Bus: Metadata updated")
 }
 
 func (p *MediaPlayer) setPlaybackStatus(status string) {
-	if err := p.props.Set(mprisPlayerInterface, "PlaybackStatus", dbus.MakeVariant(status)); err != nil {
-		log.Printf("D-Bus: failed updating PlaybackStatus: %v", err)
-		return
-	}
+	p.props.SetMust(mprisPlayerInterface, "PlaybackStatus", status)
 	log.Println("D-Bus: PlaybackStatus updated to", status)
 }
 
+// mprisProperties answers reads of Position from the player, since MPRIS
+// clients expect it to be current without being told of every change.
+type mprisProperties struct {
+	*prop.Properties
+	player *audio.Player
+}
+
+func (p *mprisProperties) position() dbus.Variant {
+	return dbus.MakeVariant(p.player.GetPlaybackPosition().Microseconds())
+}
+
+func (p *mprisProperties) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	if iface == mprisPlayerInterface && property == "Position" {
+		return p.position(), nil
+	}
+	return p.Properties.Get(iface, property)
+}
+
+func (p *mprisProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	props, err := p.Properties.GetAll(iface)
+	if err == nil && iface == mprisPlayerInterface {
+		props["Position"] = p.position()
+	}
+	return props, err
+}
+
 func (p *MediaPlayer) createMetadata(song *lib.Song) (map[string]dbus.Variant, string) {
 	meta := make(map[string]dbus.Variant)
 
@@ -134,22 +147,30 @@ func (p *MediaPlayer) createMetadata(song *lib.Song) (map[string]dbus.Variant, s
 	meta["xesam:title"] = dbus.MakeVariant(song.Title)
 	meta["xesam:album"] = dbus.MakeVariant(song.Album)
 	meta["xesam:artist"] = dbus.MakeVariant([]string{song.Artist})
-	meta["xesam:url"] = dbus.MakeVariant("file://" + song.Path)
+	if audio.IsStreamURL(song.Path) {
+		meta["xesam:url"] = dbus.MakeVariant(song.Path)
+	} else {
+		meta["xesam:url"] = dbus.MakeVariant("file://" + song.Path)
+	}
 
 	if p.model != nil && p.model.AudioPlayer != nil {
+		// A live stream is titled by what the station says is on.
+		if status, ok := p.model.AudioPlayer.StreamStatus(); ok && status.Title != "" {
+			meta["xesam:title"] = dbus.MakeVariant(status.Title)
+		}
 		lengthUS := p.model.AudioPlayer.GetTotalLength().Microseconds()
 		if lengthUS > 0 {
 			meta["mpris:length"] = dbus.MakeVariant(int64(lengthUS))
 		}
 	}
 
-	if song.Picture != nil && len(song.Picture.Data) > 0 {
-		hash := md5.Sum(song.Picture.Data)
+	if picture := song.LoadPicture(); picture != nil && len(picture.Data) > 0 {
+		hash := md5.Sum(picture.Data)
 		filename := fmt.Sprintf("kanade-art-%x.jpg", hash)
 		artPath := filepath.Join(os.TempDir(), filename)
 
 		if _, err := os.Stat(artPath); os.IsNotExist(err) {
-			if err := os.WriteFile(artPath, song.Picture.Data, 0644); err != nil {
+			if err := os.WriteFile(artPath, picture.Data, 0644); err != nil {
 				log.Printf("Failed to write album art to temp file: %v", err)
 			}
 		}
@@ -168,7 +189,7 @@ func InitMediaKeys(m *tui.Model) {
 		}
 		defer conn.Close()
 
-		player := &MediaPlayer{model: m}
+		player := &MediaPlayer{model: m, conn: conn}
 
 		reply, err := conn.RequestName("org.mpris.MediaPlayer2.kanade", dbus.NameFlagDoNotQueue)
 		if err != nil {
@@ -197,7 +218,10 @@ func InitMediaKeys(m *tui.Model) {
 				"CanControl":     {Value: true, Writable: false, Emit: prop.EmitTrue},
 				"PlaybackStatus": {Value: "Stopped", Writable: false, Emit: prop.EmitTrue},
 				"Metadata":       {Value: map[string]dbus.Variant{}, Writable: false, Emit: prop.EmitTrue},
-				"Position":       {Value: int64(0), Writable: false, Emit: prop.EmitTrue},
+				"Position":       {Value: int64(0), Writable: false, Emit: prop.EmitFalse},
+				"Rate":           {Value: m.AudioPlayer.Speed(), Writable: true, Emit: prop.EmitTrue, Callback: player.setRate},
+				"MinimumRate":    {Value: audio.MinSpeed, Writable: false, Emit: prop.EmitTrue},
+				"MaximumRate":    {Value: audio.MaxSpeed, Writable: false, Emit: prop.EmitTrue},
 			},
 			"org.mpris.MediaPlayer2": {
 				"CanQuit":             {Value: true, Writable: false, Emit: prop.EmitTrue},
@@ -206,7 +230,7 @@ func InitMediaKeys(m *tui.Model) {
 				"Identity":            {Value: "Kanade", Writable: false, Emit: prop.EmitTrue},
 				"DesktopEntry":        {Value: "kanade", Writable: false, Emit: prop.EmitTrue},
 				"SupportedUriSchemes": {Value: []string{"file"}, Writable: false, Emit: prop.EmitTrue},
-				"SupportedMimeTypes":  {Value: []string{"audio/mpeg", "audio/flac", "audio/x-wav"}, Writable: false, Emit: prop.EmitTrue},
+				"SupportedMimeTypes":  {Value: audio.MimeTypes(), Writable: false, Emit: prop.EmitTrue},
 			},
 		}
 
@@ -217,6 +241,13 @@ func InitMediaKeys(m *tui.Model) {
 		}
 		player.props = props
 
+		// Replace the plain export with one that serves a live Position.
+		live := &mprisProperties{Properties: props, player: m.AudioPlayer}
+		if err := conn.Export(live, mprisPath, "org.freedesktop.DBus.Properties"); err != nil {
+			log.Printf("Failed to export D-Bus properties: %v", err)
+			return
+		}
+
 		if err := conn.Export(&mprisRoot{model: m}, mprisPath, "org.mpris.MediaPlayer2"); err != nil {
 			log.Printf("Failed to export base interface: %v", err)
 			return
@@ -224,16 +255,61 @@ func InitMediaKeys(m *tui.Model) {
 
 		log.Println("Linux (D-Bus/MPRIS) media key handler started.")
 
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
+		events, unsubscribe := m.AudioPlayer.Subscribe()
+		defer unsubscribe()
 
-		player.Update(m.SelectedSong, m.AudioPlayer != nil && m.AudioPlayer.IsPlaying())
+		player.Update(m.SelectedSong, m.AudioPlayer.IsPlaying())
 
-		for {
-			select {
-			case <-ticker.C:
-				player.Update(m.SelectedSong, m.AudioPlayer != nil && m.AudioPlayer.IsPlaying())
-			}
+		for event := range events {
+			player.handleEvent(event)
 		}
 	}()
 }
+
+func (p *MediaPlayer) handleEvent(event audio.Event) {
+	switch event.Type {
+	case audio.EventTrackLoaded, audio.EventStarted, audio.EventPaused:
+		p.Update(p.model.Song(event.Path), p.model.AudioPlayer.IsPlaying())
+
+	case audio.EventSeeked:
+		p.Update(p.model.Song(event.Path), p.model.AudioPlayer.IsPlaying())
+		if err := p.conn.Emit(mprisPath, mprisPlayerInterface+".Seeked", event.Position.Microseconds()); err != nil {
+			log.Printf("D-Bus: failed emitting Seeked: %v", err)
+		}
+
+	case audio.EventMetadata:
+		// The track stays the same, so the metadata has to be sent again
+		// by hand.
+		if song := p.model.Song(event.Path); song != nil && p.props != nil {
+			metadata, _ := p.createMetadata(song)
+			p.setMetadata(metadata)
+		}
+
+	case audio.EventStopped, audio.EventFinished:
+		p.Update(nil, false)
+
+	case audio.EventSpeedChanged:
+		p.props.SetMust(mprisPlayerInterface, "Rate", event.Speed)
+	}
+}
+
+// setRate handles clients writing the Rate property. MPRIS treats a rate
+// of zero as a pause.
+func (p *MediaPlayer) setRate(change *prop.Change) *dbus.Error {
+	rate, ok := change.Value.(float64)
+	if !ok {
+		return prop.ErrInvalidArg
+	}
+	log.Println("D-Bus: Rate set to", rate)
+	if rate == 0 {
+		p.model.ControlPlayback(tui.Pause)
+		// The property lock is held until the zero is stored, so this
+		// puts the real speed back right after.
+		go p.props.SetMust(mprisPlayerInterface, "Rate", p.model.AudioPlayer.Speed())
+		return nil
+	}
+	if err := p.model.AudioPlayer.SetSpeed(rate); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
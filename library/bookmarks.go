@@ -0,0 +1,91 @@
+package library
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Bookmark struct {
+	Name     string        `json:"name"`
+	Position time.Duration `json:"position"`
+}
+
+// Bookmarks holds named positions per track.
+type Bookmarks struct {
+	mu sync.Mutex
+	jsonFile
+	marks map[string][]Bookmark
+}
+
+func OpenBookmarks(path string) (*Bookmarks, error) {
+	b := &Bookmarks{
+		jsonFile: jsonFile{path: path, name: "bookmarks"},
+		marks:    make(map[string][]Bookmark),
+	}
+	if err := b.load(&b.marks); err != nil {
+		b.marks = make(map[string][]Bookmark)
+		return b, err
+	}
+	return b, nil
+}
+
+// List returns the bookmarks of a track in playback order.
+func (b *Bookmarks) List(track string) []Bookmark {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.marks[track])
+}
+
+// Get finds a bookmark by name, ignoring case.
+func (b *Bookmarks) Get(track, name string) (Bookmark, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, mark := range b.marks[track] {
+		if strings.EqualFold(mark.Name, name) {
+			return mark, true
+		}
+	}
+	return Bookmark{}, false
+}
+
+// Set adds a bookmark, replacing one with the same name.
+func (b *Bookmarks) Set(track string, mark Bookmark) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	marks := slices.DeleteFunc(b.marks[track], func(m Bookmark) bool {
+		return strings.EqualFold(m.Name, mark.Name)
+	})
+	marks = append(marks, mark)
+	slices.SortStableFunc(marks, func(a, b Bookmark) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+	b.marks[track] = marks
+	return b.save(b.marks)
+}
+
+func (b *Bookmarks) Remove(track, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	marks := b.marks[track]
+	i := slices.IndexFunc(marks, func(m Bookmark) bool {
+		return strings.EqualFold(m.Name, name)
+	})
+	if i < 0 {
+		return fmt.Errorf("no bookmark named %q", name)
+	}
+
+	marks = slices.Delete(marks, i, i+1)
+	if len(marks) == 0 {
+		delete(b.marks, track)
+	} else {
+		b.marks[track] = marks
+	}
+	return b.save(b.marks)
+}
@@ -0,0 +1,56 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBookmarksKeepUnreadableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	corrupt := []byte(`{"song.mp3": [{"name": "chorus"`)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := OpenBookmarks(path)
+	if err == nil {
+		t.Fatal("opening a corrupt file succeeded")
+	}
+	if err := b.Set("song.mp3", Bookmark{Name: "intro", Position: time.Second}); err == nil {
+		t.Error("saving over a corrupt file succeeded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(corrupt) {
+		t.Errorf("file was overwritten with %q", data)
+	}
+}
+
+func TestBookmarksRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+
+	b, err := OpenBookmarks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("song.mp3", Bookmark{Name: "outro", Position: 3 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("song.mp3", Bookmark{Name: "intro", Position: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenBookmarks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marks := reopened.List("song.mp3")
+	if len(marks) != 2 || marks[0].Name != "intro" || marks[1].Name != "outro" {
+		t.Errorf("reopened bookmarks = %+v", marks)
+	}
+}
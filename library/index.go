@@ -0,0 +1,267 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"kanade/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexVersion = 4
+
+type indexEntry struct {
+	Path        string        `json:"path"`
+	Root        string        `json:"root"`
+	ModTime     int64         `json:"mtime"`
+	Size        int64         `json:"size"`
+	Title       string        `json:"title"`
+	Artist      string        `json:"artist"`
+	Genre       string        `json:"genre"`
+	Album       string        `json:"album"`
+	AlbumArtist string        `json:"album_artist,omitempty"`
+	Composer    string        `json:"composer,omitempty"`
+	Year        int           `json:"year,omitempty"`
+	TrackNumber int           `json:"track,omitempty"`
+	DiscNumber  int           `json:"disc,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	SampleRate  int           `json:"sample_rate,omitempty"`
+	Channels    int           `json:"channels,omitempty"`
+	Bitrate     int           `json:"bitrate,omitempty"`
+	HasPicture  bool          `json:"has_picture"`
+	Gapless     bool          `json:"gapless,omitempty"`
+	TrackGain   *float64      `json:"track_gain,omitempty"`
+	TrackPeak   float64       `json:"track_peak,omitempty"`
+	AlbumGain   *float64      `json:"album_gain,omitempty"`
+	AlbumPeak   float64       `json:"album_peak,omitempty"`
+	// GainAnalyzed marks gains that were measured rather than read from
+	// tags, so they survive the file being re-read.
+	GainAnalyzed bool `json:"gain_analyzed,omitempty"`
+}
+
+type indexFile struct {
+	Version int          `json:"version"`
+	Songs   []indexEntry `json:"songs"`
+}
+
+type Index struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]indexEntry
+	dirty   bool
+}
+
+func OpenIndex(path string) (*Index, error) {
+	idx := &Index{
+		path:    path,
+		entries: make(map[string]indexEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+		return idx, fmt.Errorf("failed to read library index: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return idx, fmt.Errorf("failed to parse library index %s: %w", path, err)
+	}
+
+	if file.Version != indexVersion {
+		idx.dirty = true
+		return idx, nil
+	}
+
+	for _, entry := range file.Songs {
+		idx.entries[entry.Path] = entry
+	}
+
+	return idx, nil
+}
+
+func (i *Index) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.entries)
+}
+
+func (i *Index) Lookup(path string, info os.FileInfo) (Song, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry, ok := i.entries[path]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return Song{}, false
+	}
+
+	return Song{
+		Title:        entry.Title,
+		Artist:       entry.Artist,
+		Genre:        entry.Genre,
+		Album:        entry.Album,
+		AlbumArtist:  entry.AlbumArtist,
+		Composer:     entry.Composer,
+		Year:         entry.Year,
+		TrackNumber:  entry.TrackNumber,
+		DiscNumber:   entry.DiscNumber,
+		Duration:     entry.Duration,
+		SampleRate:   entry.SampleRate,
+		Channels:     entry.Channels,
+		Bitrate:      entry.Bitrate,
+		HasPicture:   entry.HasPicture,
+		Gapless:      entry.Gapless,
+		TrackGain:    derefGain(entry.TrackGain),
+		TrackPeak:    entry.TrackPeak,
+		AlbumGain:    derefGain(entry.AlbumGain),
+		AlbumPeak:    entry.AlbumPeak,
+		HasTrackGain: entry.TrackGain != nil,
+		HasAlbumGain: entry.AlbumGain != nil,
+		GainAnalyzed: entry.GainAnalyzed,
+		Path:         entry.Path,
+		Root:         entry.Root,
+	}, true
+}
+
+// AnalyzedGain returns the measured gains stored for path, even when the
+// file has changed since.
+func (i *Index) AnalyzedGain(path string) (Song, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry, ok := i.entries[path]
+	if !ok || !entry.GainAnalyzed {
+		return Song{}, false
+	}
+	return Song{
+		TrackGain:    derefGain(entry.TrackGain),
+		TrackPeak:    entry.TrackPeak,
+		AlbumGain:    derefGain(entry.AlbumGain),
+		AlbumPeak:    entry.AlbumPeak,
+		HasTrackGain: entry.TrackGain != nil,
+		HasAlbumGain: entry.AlbumGain != nil,
+		GainAnalyzed: true,
+	}, true
+}
+
+func (i *Index) Store(song Song, info os.FileInfo) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.entries[song.Path] = indexEntry{
+		Path:        song.Path,
+		Root:        song.Root,
+		ModTime:     info.ModTime().UnixNano(),
+		Size:        info.Size(),
+		Title:       song.Title,
+		Artist:      song.Artist,
+		Genre:       song.Genre,
+		Album:       song.Album,
+		AlbumArtist: song.AlbumArtist,
+		Composer:    song.Composer,
+		Year:        song.Year,
+		TrackNumber: song.TrackNumber,
+		DiscNumber:  song.DiscNumber,
+		Duration:    song.Duration,
+		SampleRate:  song.SampleRate,
+		Channels:    song.Channels,
+		Bitrate:     song.Bitrate,
+		HasPicture:  song.HasPicture,
+		Gapless:     song.Gapless,
+		TrackGain:   gainPtr(song.TrackGain, song.HasTrackGain),
+		TrackPeak:   song.TrackPeak,
+		AlbumGain:   gainPtr(song.AlbumGain, song.HasAlbumGain),
+		AlbumPeak:   song.AlbumPeak,
+
+		GainAnalyzed: song.GainAnalyzed,
+	}
+	i.dirty = true
+}
+
+func (i *Index) Remove(path string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.entries[path]; ok {
+		delete(i.entries, path)
+		i.dirty = true
+	}
+}
+
+// Prune drops entries below any of the given roots that were not seen in
+// the latest scan, so deleted files don't accumulate in the index.
+func (i *Index) Prune(roots []string, seen map[string]bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for path := range i.entries {
+		if seen[path] {
+			continue
+		}
+		for _, root := range roots {
+			if isWithinRoot(path, root) {
+				delete(i.entries, path)
+				i.dirty = true
+				break
+			}
+		}
+	}
+}
+
+func (i *Index) Save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+
+	file := indexFile{
+		Version: indexVersion,
+		Songs:   make([]indexEntry, 0, len(i.entries)),
+	}
+	for _, entry := range i.entries {
+		file.Songs = append(file.Songs, entry)
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode library index: %w", err)
+	}
+
+	if err := config.WriteFileAtomic(i.path, data); err != nil {
+		return fmt.Errorf("failed to save library index: %w", err)
+	}
+
+	i.dirty = false
+	return nil
+}
+
+func isWithinRoot(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Gains are stored as pointers so a missing tag and a gain of 0 dB stay
+// distinct in the index.
+func gainPtr(gain float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	return &gain
+}
+
+func derefGain(gain *float64) float64 {
+	if gain == nil {
+		return 0
+	}
+	return *gain
+}
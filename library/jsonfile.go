@@ -0,0 +1,53 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"kanade/config"
+	"os"
+)
+
+// jsonFile is a small hand-edited list kept as JSON, such as the bookmarks
+// or the radio stations. Every change is written to disk straight away,
+// since these lists are short and change rarely.
+type jsonFile struct {
+	path string
+	name string
+	// loadErr keeps a file that failed to load from being overwritten
+	// with only the entries added since.
+	loadErr error
+}
+
+// load decodes the file into v. A missing file is not an error.
+func (f *jsonFile) load(v any) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		f.loadErr = fmt.Errorf("failed to read %s: %w", f.name, err)
+		return f.loadErr
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		f.loadErr = fmt.Errorf("failed to parse %s %s: %w", f.name, f.path, err)
+		return f.loadErr
+	}
+	return nil
+}
+
+func (f *jsonFile) save(v any) error {
+	if f.loadErr != nil {
+		return fmt.Errorf("not saving %s over a file that could not be loaded: %w", f.name, f.loadErr)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", f.name, err)
+	}
+
+	if err := config.WriteFileAtomic(f.path, data); err != nil {
+		return fmt.Errorf("failed to save %s: %w", f.name, err)
+	}
+	return nil
+}
@@ -1,128 +1,234 @@
 package library
 
 import (
+	"errors"
 	"fmt"
+	"kanade/audio"
 	"kanade/metadata"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dhowden/tag"
 )
 
 type Song struct {
-	Title   string
-	Artist  string
-	Genre   string
-	Album   string
-	Picture *tag.Picture
-	Path    string
+	Title       string
+	Artist      string
+	Genre       string
+	Album       string
+	AlbumArtist string
+	Composer    string
+	Year        int
+	TrackNumber int
+	DiscNumber  int
+	Duration    time.Duration
+	SampleRate  int
+	Channels    int
+	Bitrate     int
+	HasPicture  bool
+	Gapless     bool
+	// ReplayGain values: gains in dB, peaks linear.
+	TrackGain    float64
+	TrackPeak    float64
+	AlbumGain    float64
+	AlbumPeak    float64
+	HasTrackGain bool
+	HasAlbumGain bool
+	// GainAnalyzed is set when the gains come from loudness analysis and
+	// are kept only in the index, not in the file's tags.
+	GainAnalyzed bool
+	Path         string
+	Root         string
 }
 
 type Library struct {
+	mu    sync.RWMutex
 	Songs []Song
+	Roots []string
+
+	index *Index
+}
+
+func (l *Library) SetIndex(index *Index) {
+	l.index = index
+}
+
+func (l *Library) SaveIndex() error {
+	if l.index == nil {
+		return nil
+	}
+	return l.index.Save()
 }
 
 func (l *Library) AddSong(song Song) {
-	l.Songs = append(l.Songs, song)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if i := l.indexOfUnsafe(song.Path); i >= 0 {
+		l.Songs[i] = song
+	} else {
+		l.Songs = append(l.Songs, song)
+	}
+	l.storeInIndex(song)
 }
 
 func (l *Library) RemoveSong(songPath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.removeSongUnsafe(songPath)
+}
+
+func (l *Library) removeSongUnsafe(songPath string) {
+	if i := l.indexOfUnsafe(songPath); i >= 0 {
+		l.Songs = append(l.Songs[:i], l.Songs[i+1:]...)
+	}
+	if l.index != nil {
+		l.index.Remove(songPath)
+	}
+	forgetPicture(songPath)
+}
+
+func (l *Library) indexOfUnsafe(songPath string) int {
 	for i, song := range l.Songs {
 		if song.Path == songPath {
-			l.Songs = append(l.Songs[:i], l.Songs[i+1:]...)
-			break
+			return i
 		}
 	}
+	return -1
+}
+
+func (l *Library) storeInIndex(song Song) {
+	if l.index == nil {
+		return
+	}
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return
+	}
+	l.index.Store(song, info)
 }
 
 func (l *Library) GetSong(songPath string) *Song {
-	for _, song := range l.Songs {
-		if song.Path == songPath {
-			return &song
-		}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if i := l.indexOfUnsafe(songPath); i >= 0 {
+		song := l.Songs[i]
+		return &song
 	}
 	return nil
 }
 
 func (l *Library) ListSongs() []Song {
-	return l.Songs
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	songs := make([]Song, len(l.Songs))
+	copy(songs, l.Songs)
+	return songs
+}
+
+func (l *Library) ListRoots() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	roots := make([]string, len(l.Roots))
+	copy(roots, l.Roots)
+	return roots
+}
+
+func (l *Library) RootFor(path string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	best := ""
+	for _, root := range l.Roots {
+		if isWithinRoot(path, root) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
 }
 
 func (l *Library) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.Songs = []Song{}
 }
 
 func (l *Library) Count() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return len(l.Songs)
 }
 
 func (l *Library) Contains(songPath string) bool {
-	for _, song := range l.Songs {
-		if song.Path == songPath {
-			return true
-		}
-	}
-	return false
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.indexOfUnsafe(songPath) >= 0
 }
 
 func (l *Library) UpdateSong(songPath string, updatedSong Song) {
-	for i, song := range l.Songs {
-		if song.Path == songPath {
-			l.Songs[i] = updatedSong
-			return
-		}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if i := l.indexOfUnsafe(songPath); i >= 0 {
+		l.Songs[i] = updatedSong
+		l.storeInIndex(updatedSong)
 	}
 }
 
-func (l *Library) FindByTitle(title string) []Song {
-	var results []Song
-	for _, song := range l.Songs {
-		if song.Title == title {
-			results = append(results, song)
-		}
+// SetDuration records the length the player found for a song whose
+// headers did not give one.
+func (l *Library) SetDuration(songPath string, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if i := l.indexOfUnsafe(songPath); i >= 0 && l.Songs[i].Duration == 0 {
+		l.Songs[i].Duration = duration
+		l.storeInIndex(l.Songs[i])
 	}
-	return results
 }
 
-func (l *Library) FindByArtist(artist string) []Song {
+func (l *Library) find(match func(Song) bool) []Song {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	var results []Song
 	for _, song := range l.Songs {
-		if song.Artist == artist {
+		if match(song) {
 			results = append(results, song)
 		}
 	}
 	return results
 }
 
+func (l *Library) FindByTitle(title string) []Song {
+	return l.find(func(song Song) bool { return song.Title == title })
+}
+
+func (l *Library) FindByArtist(artist string) []Song {
+	return l.find(func(song Song) bool { return song.Artist == artist })
+}
+
 func (l *Library) FindByAlbum(album string) []Song {
-	var results []Song
-	for _, song := range l.Songs {
-		if song.Album == album {
-			results = append(results, song)
-		}
-	}
-	return results
+	return l.find(func(song Song) bool { return song.Album == album })
 }
 
 func (l *Library) FindByGenre(genre string) []Song {
-	var results []Song
-	for _, song := range l.Songs {
-		if song.Genre == genre {
-			results = append(results, song)
-		}
-	}
-	return results
+	return l.find(func(song Song) bool { return song.Genre == genre })
 }
 
 func (l *Library) FindByPath(path string) []Song {
-	var results []Song
-	for _, song := range l.Songs {
-		if song.Path == path {
-			results = append(results, song)
-		}
-	}
-	return results
+	return l.find(func(song Song) bool { return song.Path == path })
 }
 
 func ValidateFile(filePath string) error {
@@ -144,123 +250,127 @@ func ValidateFile(filePath string) error {
 		return fmt.Errorf("file too small to be valid audio: %s (size: %d bytes)", filePath, info.Size())
 	}
 
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".mp3", ".wav":
-
-		break
-	default:
-		return fmt.Errorf("unsupported file format: %s", ext)
+	codec, err := audio.DetectCodec(filePath)
+	if err != nil {
+		return err
+	}
+	if !codec.CanDecode() {
+		return fmt.Errorf("no decoder available for %s: %s", codec.Name, filePath)
 	}
 
 	return nil
 }
 
-func isSupportedAudioFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	return ext == ".mp3" || ext == ".wav"
+func IsSupportedAudioFile(filename string) bool {
+	return audio.IsSupportedExtension(filename)
 }
 
-func (l *Library) ReadDir(dir string) ([]Song, error) {
-	if dir == "" {
-		return nil, fmt.Errorf("directory path cannot be empty")
+func newSongFromFile(filePath, root string) (Song, error) {
+	meta, err := metadata.ExtractMetadata(filePath)
+	if err != nil && !errors.Is(err, tag.ErrNoTagsFound) {
+		return Song{}, err
 	}
 
-	info, err := os.Stat(dir)
-	if err != nil {
-		return nil, fmt.Errorf("directory not accessible: %w", err)
+	song := Song{
+		Path: filePath,
+		Root: root,
 	}
 
-	if !info.IsDir() {
-		return nil, fmt.Errorf("path is not a directory: %s", dir)
+	if meta != nil {
+		song.Title = meta.Title()
+		song.Artist = meta.Artist()
+		song.Genre = meta.Genre()
+		song.Album = meta.Album()
+		song.AlbumArtist = meta.AlbumArtist()
+		song.Composer = meta.Composer()
+		song.Year = meta.Year()
+		song.TrackNumber, _ = meta.Track()
+		song.DiscNumber, _ = meta.Disc()
+		song.HasPicture = meta.Picture() != nil
+		song.Gapless = metadata.IsGapless(meta)
+		song.SetReplayGain(metadata.ReadReplayGain(meta))
 	}
 
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
+	if err := song.LoadStreamInfo(); err != nil && !errors.Is(err, audio.ErrNoStreamInfo) {
+		log.Printf("Warning: failed to read stream info for %s: %v", filePath, err)
 	}
 
-	var songs []Song
-	var errors []string
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filename := file.Name()
-
-		if strings.HasPrefix(filename, ".") || !isSupportedAudioFile(filename) {
-			continue
-		}
-
-		filePath := filepath.Join(dir, filename)
-
-		if err := ValidateFile(filePath); err != nil {
-			errors = append(errors, fmt.Sprintf("skipping %s: %v", filename, err))
-			continue
-		}
-
-		meta, err := metadata.ExtractMetadata(filePath)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("failed to extract metadata from %s: %v", filename, err))
-			continue
-		}
-
-		song := Song{
-			Path: filePath,
-		}
-
-		if meta != nil {
-			song.Title = meta.Title()
-			song.Artist = meta.Artist()
-			song.Genre = meta.Genre()
-			song.Album = meta.Album()
-			song.Picture = meta.Picture()
-		}
+	if song.Title == "" {
+		filename := filepath.Base(filePath)
+		song.Title = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	if song.Artist == "" {
+		song.Artist = "Unknown Artist"
+	}
+	if song.Album == "" {
+		song.Album = "Unknown Album"
+	}
+	if song.Genre == "" {
+		song.Genre = "Unknown Genre"
+	}
 
-		if song.Title == "" {
+	return song, nil
+}
 
-			song.Title = strings.TrimSuffix(filename, filepath.Ext(filename))
-		}
-		if song.Artist == "" {
-			song.Artist = "Unknown Artist"
-		}
-		if song.Album == "" {
-			song.Album = "Unknown Album"
-		}
-		if song.Genre == "" {
-			song.Genre = "Unknown Genre"
-		}
+func (s *Song) SetReplayGain(rg metadata.ReplayGain) {
+	s.TrackGain = rg.TrackGain
+	s.TrackPeak = rg.TrackPeak
+	s.AlbumGain = rg.AlbumGain
+	s.AlbumPeak = rg.AlbumPeak
+	s.HasTrackGain = rg.HasTrackGain
+	s.HasAlbumGain = rg.HasAlbumGain
+}
 
-		songs = append(songs, song)
+// keepAnalyzedGain carries measured gains over to a song re-read from a
+// file whose tags have none, so they are not lost when its tags change.
+func (s *Song) keepAnalyzedGain(previous Song) {
+	if !previous.GainAnalyzed || s.HasTrackGain || s.HasAlbumGain {
+		return
 	}
+	s.TrackGain = previous.TrackGain
+	s.TrackPeak = previous.TrackPeak
+	s.AlbumGain = previous.AlbumGain
+	s.AlbumPeak = previous.AlbumPeak
+	s.HasTrackGain = previous.HasTrackGain
+	s.HasAlbumGain = previous.HasAlbumGain
+	s.GainAnalyzed = true
+}
 
-	l.Songs = append(l.Songs, songs...)
-
-	if len(errors) > 0 && len(songs) > 0 {
-
-		fmt.Printf("Warning: encountered %d file processing errors:\n", len(errors))
-		for _, errMsg := range errors {
-			fmt.Printf("  - %s\n", errMsg)
-		}
-	} else if len(errors) > 0 && len(songs) == 0 {
+func (s Song) Loudness() audio.Loudness {
+	return audio.Loudness{
+		TrackGain:    s.TrackGain,
+		TrackPeak:    s.TrackPeak,
+		AlbumGain:    s.AlbumGain,
+		AlbumPeak:    s.AlbumPeak,
+		HasTrackGain: s.HasTrackGain,
+		HasAlbumGain: s.HasAlbumGain,
+	}
+}
 
-		return nil, fmt.Errorf("no valid audio files found. Errors encountered:\n%s", strings.Join(errors, "\n"))
+// LoadStreamInfo reads the stream info from the file's headers. Formats
+// without readable headers learn their duration once played, through
+// SetDuration.
+func (s *Song) LoadStreamInfo() error {
+	info, err := audio.ReadStreamInfo(s.Path)
+	if err != nil {
+		return err
 	}
 
-	return songs, nil
+	s.Duration = info.Duration
+	s.SampleRate = info.SampleRate
+	s.Channels = info.Channels
+	s.Bitrate = info.Bitrate
+	return nil
 }
 
 func (l *Library) RefreshSong(songPath string) error {
-
-	songIndex := -1
-	for i, song := range l.Songs {
-		if song.Path == songPath {
-			songIndex = i
-			break
-		}
+	l.mu.RLock()
+	songIndex := l.indexOfUnsafe(songPath)
+	var previous Song
+	if songIndex >= 0 {
+		previous = l.Songs[songIndex]
 	}
+	l.mu.RUnlock()
 
 	if songIndex == -1 {
 		return fmt.Errorf("song not found in library: %s", songPath)
@@ -272,20 +382,53 @@ func (l *Library) RefreshSong(songPath string) error {
 		return fmt.Errorf("song file is no longer valid, removed from library: %w", err)
 	}
 
-	meta, err := metadata.ExtractMetadata(songPath)
+	updatedSong, err := newSongFromFile(songPath, previous.Root)
 	if err != nil {
 		return fmt.Errorf("failed to refresh metadata: %w", err)
 	}
+	updatedSong.keepAnalyzedGain(previous)
 
-	updatedSong := l.Songs[songIndex]
-	if meta != nil {
-		updatedSong.Title = meta.Title()
-		updatedSong.Artist = meta.Artist()
-		updatedSong.Genre = meta.Genre()
-		updatedSong.Album = meta.Album()
-		updatedSong.Picture = meta.Picture()
-	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	l.Songs[songIndex] = updatedSong
+	if i := l.indexOfUnsafe(songPath); i >= 0 {
+		l.Songs[i] = updatedSong
+	}
+	l.storeInIndex(updatedSong)
+	forgetPicture(songPath)
 	return nil
 }
+
+func (l *Library) AddFile(filePath string) (Song, error) {
+	if !IsSupportedAudioFile(filePath) {
+		return Song{}, fmt.Errorf("unsupported file format: %s", filepath.Ext(filePath))
+	}
+
+	if err := ValidateFile(filePath); err != nil {
+		return Song{}, err
+	}
+
+	song, err := newSongFromFile(filePath, l.RootFor(filePath))
+	if err != nil {
+		return Song{}, fmt.Errorf("failed to extract metadata: %w", err)
+	}
+
+	l.AddSong(song)
+	return song, nil
+}
+
+func (l *Library) RemoveDir(dir string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var removed []string
+	for _, song := range l.Songs {
+		if isWithinRoot(song.Path, dir) {
+			removed = append(removed, song.Path)
+		}
+	}
+	for _, path := range removed {
+		l.removeSongUnsafe(path)
+	}
+	return removed
+}
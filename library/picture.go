@@ -0,0 +1,71 @@
+package library
+
+import (
+	"sync"
+
+	"kanade/metadata"
+
+	"github.com/dhowden/tag"
+)
+
+const pictureCacheSize = 8
+
+var pictureCache = struct {
+	mu      sync.Mutex
+	order   []string
+	entries map[string]*tag.Picture
+}{
+	entries: make(map[string]*tag.Picture),
+}
+
+// LoadPicture reads the embedded cover art for a song on demand. Pictures
+// are not kept on Song so that large libraries don't hold every cover in
+// memory; the few most recently used ones are cached instead.
+func (s Song) LoadPicture() *tag.Picture {
+	if !s.HasPicture || s.Path == "" {
+		return nil
+	}
+
+	pictureCache.mu.Lock()
+	if picture, ok := pictureCache.entries[s.Path]; ok {
+		pictureCache.mu.Unlock()
+		return picture
+	}
+	pictureCache.mu.Unlock()
+
+	meta, err := metadata.ExtractMetadata(s.Path)
+	if err != nil || meta == nil {
+		return nil
+	}
+	picture := meta.Picture()
+
+	pictureCache.mu.Lock()
+	defer pictureCache.mu.Unlock()
+
+	if _, ok := pictureCache.entries[s.Path]; !ok {
+		pictureCache.order = append(pictureCache.order, s.Path)
+		if len(pictureCache.order) > pictureCacheSize {
+			delete(pictureCache.entries, pictureCache.order[0])
+			pictureCache.order = pictureCache.order[1:]
+		}
+	}
+	pictureCache.entries[s.Path] = picture
+
+	return picture
+}
+
+func forgetPicture(path string) {
+	pictureCache.mu.Lock()
+	defer pictureCache.mu.Unlock()
+
+	if _, ok := pictureCache.entries[path]; !ok {
+		return
+	}
+	delete(pictureCache.entries, path)
+	for i, p := range pictureCache.order {
+		if p == path {
+			pictureCache.order = append(pictureCache.order[:i], pictureCache.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package library
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type SymlinkPolicy int
+
+const (
+	SkipSymlinks SymlinkPolicy = iota
+	FollowFileSymlinks
+	FollowAllSymlinks
+)
+
+func ParseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "files":
+		return FollowFileSymlinks, nil
+	case "skip", "none", "no":
+		return SkipSymlinks, nil
+	case "all", "yes":
+		return FollowAllSymlinks, nil
+	default:
+		return FollowFileSymlinks, fmt.Errorf("unknown symlink policy: %s (expected skip, files or all)", value)
+	}
+}
+
+type ScanOptions struct {
+	// MaxDepth limits how many directory levels below a root are scanned.
+	// Zero scans only the root itself, a negative value means no limit.
+	MaxDepth int
+	Symlinks SymlinkPolicy
+	// Rescan ignores the library index and re-reads every file's tags.
+	Rescan bool
+}
+
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{
+		MaxDepth: -1,
+		Symlinks: FollowFileSymlinks,
+	}
+}
+
+type scanState struct {
+	opts        ScanOptions
+	index       *Index
+	root        string
+	visitedDirs map[string]bool
+	seenFiles   map[string]bool
+	// seenTargets holds the resolved paths of the files seen, so a track
+	// reachable through a symlink as well is only listed once.
+	seenTargets map[string]bool
+	songs       []Song
+	errors      []string
+}
+
+func (l *Library) ReadDir(dir string) ([]Song, error) {
+	return l.ReadDirWithOptions(dir, DefaultScanOptions())
+}
+
+func (l *Library) ReadDirWithOptions(dir string, opts ScanOptions) ([]Song, error) {
+	return l.ReadRoots([]string{dir}, opts)
+}
+
+func (l *Library) ReadRoots(roots []string, opts ScanOptions) ([]Song, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no library directories specified")
+	}
+
+	state := l.newScanState(opts)
+
+	// A root that can't be read, such as an unmounted drive, is skipped so
+	// the others still load.
+	var scannedRoots, rootErrors []string
+	for _, root := range roots {
+		absRoot, err := checkRoot(root)
+		if err != nil {
+			log.Printf("Library: skipping %s: %v", root, err)
+			rootErrors = append(rootErrors, err.Error())
+			continue
+		}
+
+		state.root = absRoot
+		state.scanDir(absRoot, 0)
+		scannedRoots = append(scannedRoots, absRoot)
+	}
+	if len(scannedRoots) == 0 {
+		return nil, fmt.Errorf("no library directory is accessible:\n%s", strings.Join(rootErrors, "\n"))
+	}
+
+	l.mu.Lock()
+	for _, root := range scannedRoots {
+		if !containsString(l.Roots, root) {
+			l.Roots = append(l.Roots, root)
+		}
+	}
+	l.Songs = append(l.Songs, state.songs...)
+	l.mu.Unlock()
+
+	if l.index != nil {
+		l.index.Prune(scannedRoots, state.seenFiles)
+		if err := l.index.Save(); err != nil {
+			state.errors = append(state.errors, err.Error())
+		}
+	}
+
+	if len(state.errors) > 0 && len(state.songs) > 0 {
+
+		fmt.Printf("Warning: encountered %d file processing errors:\n", len(state.errors))
+		for _, errMsg := range state.errors {
+			fmt.Printf("  - %s\n", errMsg)
+		}
+	} else if len(state.errors) > 0 && len(state.songs) == 0 {
+
+		return nil, fmt.Errorf("no valid audio files found. Errors encountered:\n%s", strings.Join(state.errors, "\n"))
+	}
+
+	return state.songs, nil
+}
+
+func checkRoot(root string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("directory path cannot be empty")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid directory %s: %w", root, err)
+	}
+
+	info, err := os.Stat(absRoot)
+	if err != nil {
+		return "", fmt.Errorf("directory not accessible: %w", err)
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("path is not a directory: %s", root)
+	}
+	return absRoot, nil
+}
+
+func (l *Library) newScanState(opts ScanOptions) *scanState {
+	state := &scanState{
+		opts:        opts,
+		index:       l.index,
+		visitedDirs: make(map[string]bool),
+		seenFiles:   make(map[string]bool),
+		seenTargets: make(map[string]bool),
+	}
+
+	l.mu.RLock()
+	for _, song := range l.Songs {
+		state.seenFiles[song.Path] = true
+		state.seenTargets[song.Path] = true
+	}
+	l.mu.RUnlock()
+
+	return state
+}
+
+// AddDir scans a directory that appeared below one of the library roots and
+// adds any songs in it that the library doesn't know about yet.
+func (l *Library) AddDir(dir string, opts ScanOptions) []Song {
+	state := l.newScanState(opts)
+	state.root = l.RootFor(dir)
+
+	depth := 0
+	if rel, err := filepath.Rel(state.root, dir); err == nil && rel != "." {
+		depth = strings.Count(rel, string(filepath.Separator)) + 1
+	}
+	if opts.MaxDepth >= 0 && depth > opts.MaxDepth {
+		return nil
+	}
+	state.scanDir(dir, depth)
+
+	for _, song := range state.songs {
+		l.AddSong(song)
+	}
+
+	for _, errMsg := range state.errors {
+		log.Printf("Library: %s", errMsg)
+	}
+
+	return state.songs
+}
+
+func (s *scanState) scanDir(dir string, depth int) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		s.errors = append(s.errors, fmt.Sprintf("skipping %s: %v", dir, err))
+		return
+	}
+	if s.visitedDirs[realDir] {
+		return
+	}
+	s.visitedDirs[realDir] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.errors = append(s.errors, fmt.Sprintf("failed to read directory %s: %v", dir, err))
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		target := filepath.Join(realDir, name)
+		isDir := entry.IsDir()
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			if s.opts.Symlinks == SkipSymlinks {
+				continue
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				s.errors = append(s.errors, fmt.Sprintf("skipping %s: broken symlink: %v", name, err))
+				continue
+			}
+
+			isDir = info.IsDir()
+			if isDir && s.opts.Symlinks != FollowAllSymlinks {
+				continue
+			}
+		}
+
+		if isDir {
+			if s.opts.MaxDepth < 0 || depth < s.opts.MaxDepth {
+				s.scanDir(path, depth+1)
+			}
+			continue
+		}
+
+		if !IsSupportedAudioFile(name) || s.seenFiles[path] {
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			if resolved, err := filepath.EvalSymlinks(path); err == nil {
+				target = resolved
+			}
+		}
+		if s.seenTargets[target] {
+			continue
+		}
+		s.seenFiles[path] = true
+		s.seenTargets[target] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			s.errors = append(s.errors, fmt.Sprintf("skipping %s: %v", name, err))
+			continue
+		}
+
+		if s.index != nil && !s.opts.Rescan {
+			if song, ok := s.index.Lookup(path, info); ok {
+				song.Root = s.root
+				s.songs = append(s.songs, song)
+				continue
+			}
+		}
+
+		if err := ValidateFile(path); err != nil {
+			s.errors = append(s.errors, fmt.Sprintf("skipping %s: %v", name, err))
+			continue
+		}
+
+		song, err := newSongFromFile(path, s.root)
+		if err != nil {
+			s.errors = append(s.errors, fmt.Sprintf("failed to extract metadata from %s: %v", name, err))
+			continue
+		}
+
+		if s.index != nil {
+			if previous, ok := s.index.AnalyzedGain(path); ok {
+				song.keepAnalyzedGain(previous)
+			}
+			s.index.Store(song, info)
+		}
+		s.songs = append(s.songs, song)
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package library
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Station struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Song describes the station as a song, so it can be queued and shown like
+// one.
+func (s Station) Song() *Song {
+	song := &Song{
+		Title: s.Name,
+		Album: "Radio",
+		Path:  s.URL,
+	}
+	if u, err := url.Parse(s.URL); err == nil {
+		song.Artist = u.Host
+	}
+	return song
+}
+
+// Stations holds the internet radio stations, in the order they were
+// added.
+type Stations struct {
+	mu sync.Mutex
+	jsonFile
+	stations []Station
+}
+
+func OpenStations(path string) (*Stations, error) {
+	s := &Stations{jsonFile: jsonFile{path: path, name: "stations"}}
+	if err := s.load(&s.stations); err != nil {
+		s.stations = nil
+		return s, err
+	}
+	return s, nil
+}
+
+func (s *Stations) List() []Station {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.stations)
+}
+
+// Find looks a station up by URL, or by name ignoring case.
+func (s *Stations) Find(nameOrURL string) (Station, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.indexUnsafe(nameOrURL); i >= 0 {
+		return s.stations[i], true
+	}
+	return Station{}, false
+}
+
+// Add saves a station, replacing one with the same URL. Names have to be
+// unique, since stations are played and removed by name.
+func (s *Stations) Add(station Station) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.stations {
+		if existing.URL == station.URL {
+			if other := s.indexUnsafe(station.Name); other >= 0 && other != i {
+				return fmt.Errorf("a station named %q already exists", station.Name)
+			}
+			s.stations[i] = station
+			return s.save(s.stations)
+		}
+	}
+	if s.indexUnsafe(station.Name) >= 0 {
+		return fmt.Errorf("a station named %q already exists", station.Name)
+	}
+	s.stations = append(s.stations, station)
+	return s.save(s.stations)
+}
+
+func (s *Stations) Remove(nameOrURL string) (Station, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexUnsafe(nameOrURL)
+	if i < 0 {
+		return Station{}, fmt.Errorf("no station named %q", nameOrURL)
+	}
+	station := s.stations[i]
+	s.stations = slices.Delete(s.stations, i, i+1)
+	return station, s.save(s.stations)
+}
+
+func (s *Stations) indexUnsafe(nameOrURL string) int {
+	return slices.IndexFunc(s.stations, func(station Station) bool {
+		return station.URL == nameOrURL || strings.EqualFold(station.Name, nameOrURL)
+	})
+}
@@ -0,0 +1,58 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStationsKeepUnreadableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stations.json")
+	corrupt := []byte(`[{"name": "Jazz", "url": "http://jazz.example/stream"`)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenStations(path)
+	if err == nil {
+		t.Fatal("opening a corrupt file succeeded")
+	}
+	if err := s.Add(Station{Name: "News", URL: "http://news.example/stream"}); err == nil {
+		t.Error("saving over a corrupt file succeeded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(corrupt) {
+		t.Errorf("file was overwritten with %q", data)
+	}
+}
+
+func TestStationsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stations.json")
+
+	s, err := OpenStations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Station{Name: "Jazz", URL: "http://jazz.example/stream"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Station{Name: "News", URL: "http://news.example/stream"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Station{Name: "jazz", URL: "http://other.example/stream"}); err == nil {
+		t.Error("added a second station with the same name")
+	}
+
+	reopened, err := OpenStations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stations := reopened.List()
+	if len(stations) != 2 || stations[0].Name != "Jazz" || stations[1].Name != "News" {
+		t.Errorf("reopened stations = %+v", stations)
+	}
+}
@@ -0,0 +1,232 @@
+package loudness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"kanade/audio"
+	lib "kanade/library"
+	"kanade/metadata"
+)
+
+const analysisBufferSize = 4096
+
+type Options struct {
+	// All re-analyzes songs that already have loudness values.
+	All bool
+	// WriteTags stores the results as REPLAYGAIN_* tags in the files as
+	// well as in the library index. It needs ffmpeg.
+	WriteTags bool
+}
+
+type Progress struct {
+	Done  int
+	Total int
+	Path  string
+}
+
+type Result struct {
+	Analyzed int
+	Failed   int
+}
+
+// Measurement is the analysis of a single file.
+type Measurement struct {
+	Loudness float64
+	TruePeak float64
+	meter    *Meter
+}
+
+// AnalyzeFile decodes filePath and measures it.
+func AnalyzeFile(ctx context.Context, filePath string) (Measurement, error) {
+	streamer, format, err := audio.Decode(filePath)
+	if err != nil {
+		return Measurement{}, err
+	}
+	defer streamer.Close()
+
+	// Some decoders hand mono files over as two identical channels, which
+	// would meter 3 LU too loud, so the channel count comes from the file.
+	channels := format.NumChannels
+	if info, err := audio.Probe(filePath); err == nil && info.Channels > 0 {
+		channels = info.Channels
+	}
+	meter := NewMeter(int(format.SampleRate), channels)
+	buf := make([][2]float64, analysisBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Measurement{}, err
+		}
+		n, ok := streamer.Stream(buf)
+		meter.Write(buf[:n])
+		if !ok || n < len(buf) {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return Measurement{}, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+
+	loudness, err := meter.Integrated()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return Measurement{Loudness: loudness, TruePeak: meter.TruePeak(), meter: meter}, nil
+}
+
+// AnalyzeLibrary measures songs that lack loudness values and stores the
+// results. Albums are analyzed as a whole so every track gets an album
+// gain too, even when only some of them were missing values.
+func AnalyzeLibrary(ctx context.Context, library *lib.Library, opts Options, progress func(Progress)) (Result, error) {
+	var result Result
+
+	ffmpegPath := audio.FFmpegPath()
+	if opts.WriteTags && ffmpegPath == "" {
+		return result, fmt.Errorf("ffmpeg is required to write tags")
+	}
+
+	groups := pendingGroups(library.ListSongs(), opts.All)
+	total := 0
+	for _, group := range groups {
+		total += len(group.songs)
+	}
+
+	done := 0
+	for _, group := range groups {
+		var meters []*Meter
+		var measured []lib.Song
+
+		for _, song := range group.songs {
+			if progress != nil {
+				progress(Progress{Done: done, Total: total, Path: song.Path})
+			}
+
+			m, err := AnalyzeFile(ctx, song.Path)
+			done++
+			if err != nil {
+				if ctx.Err() != nil {
+					// Keep what the finished albums produced.
+					library.SaveIndex()
+					return result, ctx.Err()
+				}
+				log.Printf("Loudness analysis failed for %s: %v", song.Path, err)
+				result.Failed++
+				continue
+			}
+
+			song.TrackGain = Gain(m.Loudness)
+			song.TrackPeak = m.TruePeak
+			song.HasTrackGain = true
+			meters = append(meters, m.meter)
+			measured = append(measured, song)
+		}
+
+		if group.album && len(meters) > 0 {
+			albumLoudness, albumPeak, err := AlbumIntegrated(meters)
+			if err == nil {
+				for i := range measured {
+					measured[i].AlbumGain = Gain(albumLoudness)
+					measured[i].AlbumPeak = albumPeak
+					measured[i].HasAlbumGain = true
+				}
+			}
+		}
+
+		for _, song := range measured {
+			song.GainAnalyzed = true
+			if opts.WriteTags {
+				if err := metadata.WriteTags(ffmpegPath, song.Path, replayGainUpdate(song)); err != nil {
+					log.Printf("Failed to write loudness tags to %s: %v", song.Path, err)
+					result.Failed++
+				} else {
+					song.GainAnalyzed = false
+				}
+			}
+			library.UpdateSong(song.Path, song)
+			result.Analyzed++
+		}
+	}
+
+	if progress != nil {
+		progress(Progress{Done: done, Total: total})
+	}
+
+	if err := library.SaveIndex(); err != nil {
+		return result, err
+	}
+	if result.Analyzed == 0 && result.Failed > 0 {
+		return result, errors.New("no song could be analyzed")
+	}
+	return result, nil
+}
+
+type analysisGroup struct {
+	album bool
+	songs []lib.Song
+}
+
+// pendingGroups splits the library into albums and singles and keeps the
+// ones with at least one song that needs analyzing.
+func pendingGroups(songs []lib.Song, all bool) []analysisGroup {
+	var groups []analysisGroup
+	albums := make(map[string]int)
+
+	for _, song := range songs {
+		key := albumKey(song)
+		if key == "" {
+			if all || !song.HasTrackGain {
+				groups = append(groups, analysisGroup{songs: []lib.Song{song}})
+			}
+			continue
+		}
+
+		i, ok := albums[key]
+		if !ok {
+			i = len(groups)
+			albums[key] = i
+			groups = append(groups, analysisGroup{album: true})
+		}
+		groups[i].songs = append(groups[i].songs, song)
+	}
+
+	pending := groups[:0]
+	for _, group := range groups {
+		if !group.album {
+			pending = append(pending, group)
+			continue
+		}
+		for _, song := range group.songs {
+			if all || !song.HasTrackGain || !song.HasAlbumGain {
+				pending = append(pending, group)
+				break
+			}
+		}
+	}
+	return pending
+}
+
+func albumKey(song lib.Song) string {
+	if song.Album == "" || song.Album == "Unknown Album" {
+		return ""
+	}
+	artist := song.AlbumArtist
+	if artist == "" {
+		artist = song.Artist
+	}
+	return strings.ToLower(artist) + "\x00" + strings.ToLower(song.Album)
+}
+
+func replayGainUpdate(song lib.Song) metadata.TagUpdate {
+	update := metadata.TagUpdate{Fields: map[metadata.Field]string{
+		metadata.FieldTrackGain: fmt.Sprintf("%.2f dB", song.TrackGain),
+		metadata.FieldTrackPeak: fmt.Sprintf("%.6f", song.TrackPeak),
+	}}
+	if song.HasAlbumGain {
+		update.Fields[metadata.FieldAlbumGain] = fmt.Sprintf("%.2f dB", song.AlbumGain)
+		update.Fields[metadata.FieldAlbumPeak] = fmt.Sprintf("%.6f", song.AlbumPeak)
+	}
+	return update
+}
@@ -0,0 +1,197 @@
+package loudness
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// ReferenceLoudness is the ReplayGain 2.0 target in LUFS.
+	ReferenceLoudness = -18.0
+
+	absoluteGate = -70.0
+	relativeGate = -10.0
+)
+
+var ErrSilent = errors.New("no audible signal")
+
+// biquad is one second-order section of the K-weighting filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter and RLB high-pass for a
+// sample rate. The coefficients are derived the same way libebur128 does
+// so any rate works, not just 48 kHz.
+func kWeighting(sampleRate float64) [2]biquad {
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554196
+
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return [2]biquad{shelf, highPass}
+}
+
+// Meter measures EBU R128 integrated loudness and true peak.
+type Meter struct {
+	channels int
+	filters  [2][2]biquad
+	peak     [2]*truePeak
+
+	hopLength int
+	hopEnergy float64
+	hopFill   int
+	hops      []float64
+
+	// blocks holds the mean square of every 400 ms block, overlapping by
+	// 75%, ready for gating.
+	blocks []float64
+}
+
+func NewMeter(sampleRate, channels int) *Meter {
+	channels = max(min(channels, 2), 1)
+	rate := float64(sampleRate)
+
+	m := &Meter{
+		channels:  channels,
+		hopLength: max(sampleRate/10, 1),
+	}
+	for c := range channels {
+		m.filters[c] = kWeighting(rate)
+		m.peak[c] = newTruePeak(sampleRate)
+	}
+	return m
+}
+
+func (m *Meter) Write(samples [][2]float64) {
+	for _, frame := range samples {
+		for c := range m.channels {
+			x := frame[c]
+			m.peak[c].add(x)
+
+			y := m.filters[c][0].process(x)
+			y = m.filters[c][1].process(y)
+			m.hopEnergy += y * y
+		}
+
+		m.hopFill++
+		if m.hopFill == m.hopLength {
+			m.endHop()
+		}
+	}
+}
+
+func (m *Meter) endHop() {
+	m.hops = append(m.hops, m.hopEnergy)
+	m.hopEnergy = 0
+	m.hopFill = 0
+
+	if len(m.hops) < 4 {
+		return
+	}
+	last := m.hops[len(m.hops)-4:]
+	m.blocks = append(m.blocks, (last[0]+last[1]+last[2]+last[3])/float64(4*m.hopLength))
+	// Only the last three hops are needed for the next block.
+	m.hops = append(m.hops[:0], last[1:]...)
+}
+
+// Integrated returns the gated loudness of everything written, in LUFS.
+func (m *Meter) Integrated() (float64, error) {
+	return integrated(m.blocks)
+}
+
+// TruePeak returns the highest inter-sample peak as a linear value.
+func (m *Meter) TruePeak() float64 {
+	peak := 0.0
+	for c := range m.channels {
+		peak = math.Max(peak, m.peak[c].max)
+	}
+	return peak
+}
+
+// AlbumIntegrated gates the blocks of all meters together, which is how
+// BS.1770 defines the loudness of a programme made of several tracks.
+func AlbumIntegrated(meters []*Meter) (float64, float64, error) {
+	var blocks []float64
+	peak := 0.0
+	for _, m := range meters {
+		blocks = append(blocks, m.blocks...)
+		peak = math.Max(peak, m.TruePeak())
+	}
+	loudness, err := integrated(blocks)
+	return loudness, peak, err
+}
+
+func integrated(blocks []float64) (float64, error) {
+	absolute := power(absoluteGate)
+	var sum float64
+	var count int
+	for _, p := range blocks {
+		if p > absolute {
+			sum += p
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1), ErrSilent
+	}
+
+	relative := power(lufs(sum/float64(count)) + relativeGate)
+	sum, count = 0, 0
+	for _, p := range blocks {
+		if p > absolute && p > relative {
+			sum += p
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1), ErrSilent
+	}
+	return lufs(sum / float64(count)), nil
+}
+
+func lufs(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+func power(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// Gain converts a loudness in LUFS to a ReplayGain adjustment in dB.
+func Gain(lufs float64) float64 {
+	return ReferenceLoudness - lufs
+}
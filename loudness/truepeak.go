@@ -0,0 +1,59 @@
+package loudness
+
+import "math"
+
+const (
+	oversample = 4
+	phaseTaps  = 12
+)
+
+// interpolator holds the polyphase windowed-sinc filter used to estimate
+// inter-sample peaks. It only depends on the oversampling factor, so it
+// is shared by every meter.
+var interpolator = func() [oversample][phaseTaps]float64 {
+	var phases [oversample][phaseTaps]float64
+
+	n := oversample * phaseTaps
+	center := float64(n-1) / 2
+	for i := range n {
+		t := (float64(i) - center) / oversample
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		phases[i%oversample][i/oversample] = sinc * window
+	}
+	return phases
+}()
+
+// truePeak follows BS.1770-4 Annex 2: below 96 kHz the signal is
+// oversampled four times before taking the peak.
+type truePeak struct {
+	enabled bool
+	history [phaseTaps]float64
+	pos     int
+	max     float64
+}
+
+func newTruePeak(sampleRate int) *truePeak {
+	return &truePeak{enabled: sampleRate < 96000}
+}
+
+func (t *truePeak) add(x float64) {
+	t.max = math.Max(t.max, math.Abs(x))
+	if !t.enabled {
+		return
+	}
+
+	t.history[t.pos] = x
+	t.pos = (t.pos + 1) % phaseTaps
+
+	for phase := range oversample {
+		var y float64
+		for k := range phaseTaps {
+			y += interpolator[phase][k] * t.history[(t.pos+phaseTaps-1-k)%phaseTaps]
+		}
+		t.max = math.Max(t.max, math.Abs(y))
+	}
+}
@@ -1,33 +1,40 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"kanade/audio"
+	"kanade/config"
 	"kanade/downloader"
 	"kanade/hotkey"
 	"kanade/library"
 	"kanade/tui"
+	"kanade/watcher"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
-	homeDir, err := os.UserHomeDir()
+	configDir, err := config.Dir()
 	if err != nil {
 		fmt.Printf("Error getting user home directory: %v\n", err)
 		os.Exit(1)
 	}
-	logDir := homeDir + string(os.PathSeparator) + ".kanade"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0755); err != nil {
 		fmt.Printf("Error creating log directory: %v\n", err)
 		os.Exit(1)
 	}
-	logFilePath := logDir + string(os.PathSeparator) + "kanade.log"
+	logFilePath := filepath.Join(configDir, "kanade.log")
 	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		fmt.Printf("Warning: could not open log file: %v\n", err)
@@ -36,30 +43,164 @@ func main() {
 		log.SetOutput(logFile)
 	}
 
-	var dir string
-	if len(os.Args) > 1 {
-		if os.Args[1] == "--help" || os.Args[1] == "-h" {
-			fmt.Println("Usage: kanade [directory]")
-			fmt.Println("If no directory is specified, it defaults to the current working directory.")
-			os.Exit(0)
-		}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		os.Exit(runAnalyze(cfg, configDir, os.Args[2:]))
+	}
 
-		dir = os.Args[1]
-		if err := os.Chdir(dir); err != nil {
-			fmt.Printf("Error changing directory to '%s': %v\n", dir, err)
+	depth := flag.Int("depth", cfg.Library.MaxDepth, "maximum directory depth to scan (-1 for unlimited)")
+	symlinks := flag.String("symlinks", cfg.Library.FollowSymlinks, "symlink policy: skip, files or all")
+	rescan := flag.Bool("rescan", false, "ignore the library index and re-read all tags")
+	fresh := flag.Bool("fresh", false, "start without restoring the last session")
+	watch := flag.Bool("watch", cfg.Library.Watch, "watch library directories for changes")
+	crossfade := flag.Float64("crossfade", cfg.Playback.Crossfade, "seconds to crossfade between tracks (0 to disable)")
+	crossfadeCurve := flag.String("crossfade-curve", cfg.Playback.CrossfadeCurve, "crossfade curve: linear or equal-power")
+	transportFade := flag.Int("fade", cfg.Playback.TransportFade, "milliseconds to fade over when pausing, seeking or stopping (0 to disable)")
+	replayGain := flag.String("replaygain", cfg.Playback.ReplayGain, "loudness normalization: off, track or album")
+	preamp := flag.Float64("preamp", cfg.Playback.ReplayGainPreamp, "dB added to every ReplayGain adjustment")
+	speed := flag.Float64("speed", cfg.Playback.Speed, "playback speed from 0.5 to 2")
+	speedModeName := flag.String("speed-mode", cfg.Playback.SpeedMode, "speed mode: stretch keeps the pitch, resample changes it")
+	eqPreset := flag.String("eq", cfg.Equalizer.Preset, "equalizer preset to start with")
+	output := flag.String("output", cfg.Output.Backend, "audio output: speaker, alsa, null or wav")
+	outputFile := flag.String("output-file", cfg.Output.File, "file the wav output writes to")
+	realtime := flag.Bool("realtime", cfg.Output.Realtime, "pace the null and wav outputs in real time")
+	device := flag.String("device", cfg.Output.Device, "ALSA device to play through, e.g. hw:1,0")
+	sampleRate := flag.Int("sample-rate", cfg.Output.SampleRate, "output sample rate in Hz (0 to follow the first track)")
+	bufferSize := flag.Int("buffer", cfg.Output.BufferSize, "output buffer in milliseconds")
+	resampleQuality := flag.Int("resample-quality", cfg.Output.ResampleQuality, "resampler quality from 1 (fastest) to 64")
+	flag.Usage = func() {
+		fmt.Println("Usage: kanade [flags] [directory...]")
+		fmt.Println("       kanade analyze [flags] [directory...]")
+		fmt.Println("If no directory is specified, the roots from ~/.kanade/config.json are used,")
+		fmt.Println("falling back to the current working directory.")
+		fmt.Println()
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	symlinkPolicy, err := library.ParseSymlinkPolicy(*symlinks)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fadeCurve, err := audio.ParseFadeCurve(*crossfadeCurve)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	gainMode, err := audio.ParseGainMode(*replayGain)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	speedMode, err := audio.ParseSpeedMode(*speedModeName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	outputBackend, err := audio.ParseOutputBackend(*output)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The speaker always plays through the system default.
+	if *device != "" && outputBackend == audio.OutputSpeaker {
+		outputBackend = audio.OutputALSA
+	}
+	outputPath := *outputFile
+	if outputPath != "" {
+		// The working directory changes to the library below.
+		if outputPath, err = filepath.Abs(outputPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
-	} else {
-		currentDir, err := os.Getwd()
-		if err != nil {
-			fmt.Printf("Error getting current directory: %v\n", err)
-			os.Exit(1)
+	}
+	audioOutput, err := audio.NewOutput(audio.OutputConfig{
+		Backend:  outputBackend,
+		Device:   *device,
+		Path:     outputPath,
+		Realtime: *realtime,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	scanOptions := library.ScanOptions{
+		MaxDepth: *depth,
+		Symlinks: symlinkPolicy,
+		Rescan:   *rescan,
+	}
+
+	roots, err := resolveRoots(flag.Args(), cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Downloads go to the first root that can be opened; the scan below
+	// skips any others that can't.
+	dir := ""
+	for _, root := range roots {
+		if err := os.Chdir(root); err != nil {
+			log.Printf("Warning: can't open library directory '%s': %v", root, err)
+			continue
 		}
-		dir = currentDir
+		dir = root
+		break
+	}
+	if dir == "" {
+		fmt.Printf("Error: none of the library directories '%s' can be opened\n", strings.Join(roots, "', '"))
+		os.Exit(1)
+	}
+
+	index, err := library.OpenIndex(filepath.Join(configDir, "library.json"))
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	bookmarks, err := library.OpenBookmarks(filepath.Join(configDir, "bookmarks.json"))
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	stations, err := library.OpenStations(filepath.Join(configDir, "stations.json"))
+	if err != nil {
+		log.Printf("Warning: %v", err)
 	}
 
 	library := &library.Library{}
+	library.SetIndex(index)
 	player := audio.NewPlayer()
+	player.SetOutput(audioOutput)
+	if err := player.SetOutputFormat(*sampleRate, time.Duration(*bufferSize)*time.Millisecond); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := player.SetResampleQuality(*resampleQuality); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	player.SetCrossfade(time.Duration(*crossfade*float64(time.Second)), fadeCurve)
+	player.SetTransportFade(time.Duration(*transportFade) * time.Millisecond)
+	player.SetReplayGain(audio.ReplayGainConfig{
+		Mode:            gainMode,
+		Preamp:          *preamp,
+		DefaultGain:     cfg.Playback.ReplayGainDefault,
+		PreventClipping: cfg.Playback.ReplayGainPreventClipping,
+	})
+	player.SetSpeedMode(speedMode)
+	if err := player.SetSpeed(*speed); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := configureEqualizer(player.Equalizer(), cfg.Equalizer, *eqPreset); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	downloaderManager := downloader.NewManager(library, dir, 3)
 	downloaderManager.Start()
@@ -67,6 +208,9 @@ func main() {
 	cleanup := func() {
 		log.Println("Shutting down")
 		downloaderManager.Stop()
+		if err := library.SaveIndex(); err != nil {
+			log.Printf("Error saving library index: %v", err)
+		}
 		if err := player.Close(); err != nil {
 			log.Printf("Error closing audio player: %v", err)
 		}
@@ -74,43 +218,84 @@ func main() {
 	}
 	defer cleanup()
 
+	// Once the TUI is up, a signal quits it the normal way, so the session
+	// is saved; a second one, or one before then, exits straight away.
+	var program atomic.Pointer[tea.Program]
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		log.Println("Received interrupt signal")
-		cleanup()
-		os.Exit(0)
+		quitting := false
+		for range c {
+			log.Println("Received interrupt signal")
+			if p := program.Load(); p != nil && !quitting {
+				quitting = true
+				p.Send(tea.Quit())
+				continue
+			}
+			cleanup()
+			os.Exit(0)
+		}
 	}()
 
-	log.Printf("Reading songs from directory: %s", dir)
-	songs, err := library.ReadDir(dir)
+	if ffmpegPath, ok := downloader.FindFFmpeg(dir); ok {
+		audio.SetFFmpegPath(ffmpegPath)
+	} else {
+		log.Println("ffmpeg not found yet, formats without a native decoder are skipped until it is installed")
+	}
+
+	log.Printf("Reading songs from directories: %s", strings.Join(roots, ", "))
+	songs, err := library.ReadRoots(roots, scanOptions)
 	if err != nil {
-		fmt.Printf("Error reading directory '%s': %v\n", dir, err)
+		fmt.Printf("Error reading directories '%s': %v\n", strings.Join(roots, "', '"), err)
 		os.Exit(1)
 	}
 
-	if len(songs) == 0 {
-		fmt.Printf("No songs found in '%s'\n", dir)
-		fmt.Println("Please add some .mp3 files to the directory")
+	if len(songs) == 0 && len(stations.List()) == 0 {
+		fmt.Printf("No songs found in '%s'\n", strings.Join(roots, "', '"))
+		fmt.Println("Please add some audio files to the directory")
 		os.Exit(1)
 	}
 
 	log.Printf("Found %d songs", len(songs))
 
 	model := tui.NewModel(library, player, downloaderManager)
+	model.SetBookmarks(bookmarks)
+	model.SetStations(stations)
+	model.SetSleepOptions(time.Duration(cfg.Playback.SleepFade*float64(time.Second)), cfg.Playback.SleepQuit)
+
+	sessionPath := filepath.Join(configDir, "session.json")
+	if !*fresh {
+		session, err := config.LoadSession(sessionPath)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		} else if session != nil {
+			model.RestoreSession(session)
+		}
+	}
+	model.SetSessionFile(sessionPath)
+
+	if *watch {
+		libraryWatcher := watcher.New(library, scanOptions)
+		if err := libraryWatcher.Start(); err != nil {
+			log.Printf("Warning: could not watch library directories: %v", err)
+		} else {
+			defer libraryWatcher.Stop()
+			model.SetLibraryWatcher(libraryWatcher)
+		}
+	}
 
 	p := tea.NewProgram(
 		model,
 		tea.WithAltScreen(),
 		tea.WithMouseAllMotion(),
 	)
+	program.Store(p)
 
 	hotkey.InitMediaKeys(model)
 
 	log.Println("Starting TUI application")
 	finalModel, err := p.Run()
-	if err != nil {
+	if err != nil && !errors.Is(err, tea.ErrInterrupted) {
 		fmt.Printf("Error running program: %v\n", err)
 		os.Exit(1)
 	}
@@ -119,7 +304,70 @@ func main() {
 		if lastErr := model.GetLastError(); lastErr != nil {
 			log.Printf("Final error state: %v", lastErr)
 		}
+		if err := model.SaveSession(); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
 	}
 
 	log.Println("Application exited normally")
 }
+
+// resolveRoots picks the library directories from the command line, the
+// config file or the working directory, in that order.
+func resolveRoots(args []string, cfg *config.Config) ([]string, error) {
+	roots := append([]string{}, args...)
+	if len(roots) == 0 {
+		roots = append(roots, cfg.Library.Roots...)
+	}
+	if len(roots) == 0 {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current directory: %w", err)
+		}
+		roots = []string{currentDir}
+	}
+
+	for i, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve directory '%s': %w", root, err)
+		}
+		roots[i] = absRoot
+	}
+	return roots, nil
+}
+
+// configureEqualizer registers the user presets from the config and sets
+// up the starting gains. Custom bands in the config win unless another
+// preset was asked for on the command line.
+func configureEqualizer(eq *audio.Equalizer, cfg config.EqualizerConfig, preset string) error {
+	for name, bands := range cfg.Presets {
+		gains, err := bandGains(bands)
+		if err != nil {
+			return fmt.Errorf("equalizer preset %q: %w", name, err)
+		}
+		audio.RegisterEQPreset(name, gains)
+	}
+
+	if len(cfg.Bands) > 0 && preset == cfg.Preset {
+		gains, err := bandGains(cfg.Bands)
+		if err != nil {
+			return fmt.Errorf("equalizer bands: %w", err)
+		}
+		eq.SetGains(gains)
+		return nil
+	}
+	if preset == "" {
+		return nil
+	}
+	return eq.SetPreset(preset)
+}
+
+func bandGains(bands []float64) (audio.EQGains, error) {
+	var gains audio.EQGains
+	if len(bands) != audio.EQBands {
+		return gains, fmt.Errorf("expected %d bands, got %d", audio.EQBands, len(bands))
+	}
+	copy(gains[:], bands)
+	return gains, nil
+}
@@ -0,0 +1,67 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+
+	tag "github.com/dhowden/tag"
+)
+
+// RawText looks up a tag that the tag library has no accessor for. It
+// matches ID3v2 TXXX descriptions, Vorbis comments and MP4 freeform atoms
+// by name, ignoring case.
+func RawText(meta tag.Metadata, name string) (string, bool) {
+	if meta == nil {
+		return "", false
+	}
+
+	for key, value := range meta.Raw() {
+		if comm, ok := value.(*tag.Comm); ok {
+			if strings.EqualFold(comm.Description, name) {
+				return strings.TrimSpace(comm.Text), true
+			}
+			continue
+		}
+
+		if !strings.EqualFold(key, name) && !strings.HasSuffix(strings.ToLower(key), ":"+strings.ToLower(name)) {
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			return strings.TrimSpace(v), true
+		case []byte:
+			return strings.TrimSpace(string(v)), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	}
+
+	return "", false
+}
+
+// IsGapless reports whether the file is flagged as part of a gapless
+// album, either through iTunes' pgap atom or an ITUNESGAPLESS tag.
+func IsGapless(meta tag.Metadata) bool {
+	if meta == nil {
+		return false
+	}
+
+	if value, ok := meta.Raw()["pgap"]; ok {
+		switch v := value.(type) {
+		case bool:
+			return v
+		case int:
+			return v != 0
+		case []byte:
+			return len(v) > 0 && v[len(v)-1] != 0
+		}
+	}
+
+	for _, name := range []string{"ITUNESGAPLESS", "GAPLESS"} {
+		if value, ok := RawText(meta, name); ok {
+			return value == "1" || strings.EqualFold(value, "true")
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package metadata
+
+import (
+	"strconv"
+	"strings"
+
+	tag "github.com/dhowden/tag"
+)
+
+// r128Offset converts R128 gains, which target -23 LUFS, to the -18 LUFS
+// reference ReplayGain uses.
+const r128Offset = 5.0
+
+// ReplayGain holds gains in dB and peaks as linear sample values.
+type ReplayGain struct {
+	TrackGain    float64
+	TrackPeak    float64
+	AlbumGain    float64
+	AlbumPeak    float64
+	HasTrackGain bool
+	HasAlbumGain bool
+}
+
+// ReadReplayGain reads REPLAYGAIN_* tags, falling back to the R128_*
+// gains Opus files carry.
+func ReadReplayGain(meta tag.Metadata) ReplayGain {
+	var rg ReplayGain
+	if meta == nil {
+		return rg
+	}
+
+	rg.TrackGain, rg.HasTrackGain = readGain(meta, "REPLAYGAIN_TRACK_GAIN", "R128_TRACK_GAIN")
+	rg.AlbumGain, rg.HasAlbumGain = readGain(meta, "REPLAYGAIN_ALBUM_GAIN", "R128_ALBUM_GAIN")
+	rg.TrackPeak, _ = readFloat(meta, "REPLAYGAIN_TRACK_PEAK")
+	rg.AlbumPeak, _ = readFloat(meta, "REPLAYGAIN_ALBUM_PEAK")
+	return rg
+}
+
+func readGain(meta tag.Metadata, replayGainName, r128Name string) (float64, bool) {
+	if gain, ok := readFloat(meta, replayGainName); ok {
+		return gain, true
+	}
+
+	// R128 gains are Q7.8 fixed point integers.
+	value, ok := RawText(meta, r128Name)
+	if !ok {
+		return 0, false
+	}
+	q, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return float64(q)/256 + r128Offset, true
+}
+
+func readFloat(meta tag.Metadata, name string) (float64, bool) {
+	value, ok := RawText(meta, name)
+	if !ok {
+		return 0, false
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[len(value)-2:], "db") {
+		value = strings.TrimSpace(value[:len(value)-2])
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type Field string
+
+const (
+	FieldTitle       Field = "title"
+	FieldArtist      Field = "artist"
+	FieldAlbum       Field = "album"
+	FieldAlbumArtist Field = "album_artist"
+	FieldTrack       Field = "track"
+	FieldYear        Field = "date"
+	FieldGenre       Field = "genre"
+
+	FieldTrackGain Field = "REPLAYGAIN_TRACK_GAIN"
+	FieldTrackPeak Field = "REPLAYGAIN_TRACK_PEAK"
+	FieldAlbumGain Field = "REPLAYGAIN_ALBUM_GAIN"
+	FieldAlbumPeak Field = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+type TagUpdate struct {
+	Fields    map[Field]string
+	CoverPath string
+}
+
+func (u TagUpdate) Empty() bool {
+	return len(u.Fields) == 0 && u.CoverPath == ""
+}
+
+// WriteTags rewrites the file's tags with ffmpeg, copying the audio stream
+// untouched. Fields not named in the update keep their current values. MP3
+// files get ID3v2.3 frames, the same version the downloader writes.
+func WriteTags(ffmpegPath, filePath string, update TagUpdate) error {
+	if ffmpegPath == "" {
+		return fmt.Errorf("ffmpeg is required to write tags")
+	}
+	if update.Empty() {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".kanade-tags-*"+ext)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	args := []string{"-hide_banner", "-nostdin", "-v", "error", "-y", "-i", filePath}
+
+	if update.CoverPath != "" {
+		if _, err := os.Stat(update.CoverPath); err != nil {
+			return fmt.Errorf("cover image not accessible: %w", err)
+		}
+		args = append(args, "-i", update.CoverPath)
+		args = append(args, "-map", "0:a", "-map", "1:v")
+		args = append(args, "-disposition:v", "attached_pic")
+		args = append(args, "-metadata:s:v", "title=Album cover")
+		args = append(args, "-metadata:s:v", "comment=Cover (front)")
+	} else {
+		args = append(args, "-map", "0")
+	}
+
+	args = append(args, "-c", "copy", "-map_metadata", "0")
+	switch ext {
+	case ".mp3":
+		args = append(args, "-id3v2_version", "3")
+	case ".m4a", ".m4b", ".mp4":
+		// Without this the MP4 muxer drops keys it has no atom for,
+		// such as the ReplayGain fields.
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+
+	for field, value := range update.Fields {
+		args = append(args, "-metadata", fmt.Sprintf("%s=%s", field, value))
+	}
+
+	args = append(args, tmpPath)
+
+	cmd := exec.Command(ffmpegPath, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed to write tags: %w, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if info, err := os.Stat(filePath); err == nil {
+		os.Chmod(tmpPath, info.Mode().Perm())
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filePath, err)
+	}
+
+	return nil
+}
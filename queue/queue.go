@@ -0,0 +1,536 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+
+	lib "kanade/library"
+)
+
+// maxHistory bounds how far Previous can walk back.
+const maxHistory = 200
+
+type RepeatMode int
+
+const (
+	RepeatAll RepeatMode = iota
+	RepeatOne
+	RepeatOff
+)
+
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatOne:
+		return "one"
+	case RepeatOff:
+		return "off"
+	default:
+		return "all"
+	}
+}
+
+func ParseRepeatMode(s string) (RepeatMode, error) {
+	switch strings.ToLower(s) {
+	case "all":
+		return RepeatAll, nil
+	case "one", "single":
+		return RepeatOne, nil
+	case "off", "none":
+		return RepeatOff, nil
+	}
+	return RepeatAll, fmt.Errorf("unknown repeat mode %q (use off, one or all)", s)
+}
+
+type ShuffleMode int
+
+const (
+	ShuffleOff ShuffleMode = iota
+	ShuffleRandom
+	ShuffleBag
+)
+
+func (s ShuffleMode) String() string {
+	switch s {
+	case ShuffleRandom:
+		return "random"
+	case ShuffleBag:
+		return "bag"
+	default:
+		return "off"
+	}
+}
+
+func ParseShuffleMode(s string) (ShuffleMode, error) {
+	switch strings.ToLower(s) {
+	case "off", "none":
+		return ShuffleOff, nil
+	case "random", "on":
+		return ShuffleRandom, nil
+	case "bag":
+		return ShuffleBag, nil
+	}
+	return ShuffleOff, fmt.Errorf("unknown shuffle mode %q (use off, random or bag)", s)
+}
+
+type Queue struct {
+	mu      sync.RWMutex
+	items   []lib.Song
+	current int
+
+	repeat  RepeatMode
+	shuffle ShuffleMode
+
+	// history holds the paths of songs in the order they were played,
+	// so Previous retraces what was actually heard. played tracks which
+	// songs the shuffle bag has already drawn.
+	history []string
+	played  map[string]bool
+
+	// upcoming caches the pick made by PeekAdvance so the following
+	// Advance lands on the same song, even when shuffling. Any change to
+	// the queue or its modes drops it.
+	upcoming int
+
+	// resume is where the queue carries on after the playing entry was
+	// removed. current is -1 then, since the song that is still heard is
+	// no longer in the queue.
+	resume int
+}
+
+func New() *Queue {
+	return &Queue{current: -1, upcoming: -1, resume: -1, played: make(map[string]bool)}
+}
+
+func (q *Queue) Repeat() RepeatMode {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.repeat
+}
+
+func (q *Queue) SetRepeat(mode RepeatMode) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.repeat = mode
+}
+
+// CycleRepeat steps through all, one and off and returns the new mode.
+func (q *Queue) CycleRepeat() RepeatMode {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.repeat = (q.repeat + 1) % 3
+	return q.repeat
+}
+
+func (q *Queue) Shuffle() ShuffleMode {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.shuffle
+}
+
+func (q *Queue) SetShuffle(mode ShuffleMode) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.setShuffleLocked(mode)
+}
+
+// CycleShuffle steps through off, random and bag and returns the new mode.
+func (q *Queue) CycleShuffle() ShuffleMode {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.setShuffleLocked((q.shuffle + 1) % 3)
+	return q.shuffle
+}
+
+func (q *Queue) setShuffleLocked(mode ShuffleMode) {
+	if mode == ShuffleBag && q.shuffle != ShuffleBag {
+		q.resetBagLocked()
+	}
+	q.shuffle = mode
+}
+
+// resetBagLocked starts a fresh shuffle bag. The current song counts as
+// drawn so it doesn't come straight back.
+func (q *Queue) resetBagLocked() {
+	q.played = make(map[string]bool)
+	if q.current >= 0 && q.current < len(q.items) {
+		q.played[q.items[q.current].Path] = true
+	}
+}
+
+// WasPlayed reports whether the song at index has been played since the
+// queue was filled.
+func (q *Queue) WasPlayed(index int) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if index < 0 || index >= len(q.items) {
+		return false
+	}
+	return q.played[q.items[index].Path]
+}
+
+func (q *Queue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.items)
+}
+
+func (q *Queue) Items() []lib.Song {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	items := make([]lib.Song, len(q.items))
+	copy(items, q.items)
+	return items
+}
+
+func (q *Queue) CurrentIndex() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.current
+}
+
+func (q *Queue) Current() (lib.Song, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.current < 0 || q.current >= len(q.items) {
+		return lib.Song{}, false
+	}
+	return q.items[q.current], true
+}
+
+// Replace swaps the whole queue for songs and makes start the current
+// entry. This is what happens when a song is picked from the library.
+func (q *Queue) Replace(songs []lib.Song, start int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	q.pushHistoryLocked()
+	q.items = make([]lib.Song, len(songs))
+	copy(q.items, songs)
+	q.current = -1
+	q.resume = -1
+	if start >= 0 && start < len(q.items) {
+		q.current = start
+	}
+	q.resetBagLocked()
+}
+
+func (q *Queue) Enqueue(songs ...lib.Song) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.items = append(q.items, songs...)
+}
+
+func (q *Queue) PlayNext(songs ...lib.Song) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	at := q.current + 1
+	if q.resume >= 0 {
+		at = q.resume
+	}
+	items := make([]lib.Song, 0, len(q.items)+len(songs))
+	items = append(items, q.items[:at]...)
+	items = append(items, songs...)
+	items = append(items, q.items[at:]...)
+	q.items = items
+}
+
+func (q *Queue) Remove(index int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	if index < 0 || index >= len(q.items) {
+		return fmt.Errorf("queue index %d out of range", index)
+	}
+
+	q.items = append(q.items[:index], q.items[index+1:]...)
+	switch {
+	case index < q.current:
+		q.current--
+	case index == q.current:
+		// The removed song keeps playing, and the entry that slid into
+		// its place comes up next.
+		q.current = -1
+		q.resume = index
+	case index < q.resume:
+		q.resume--
+	}
+	return nil
+}
+
+func (q *Queue) Move(from, to int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	if from < 0 || from >= len(q.items) || to < 0 || to >= len(q.items) {
+		return fmt.Errorf("queue move %d -> %d out of range", from, to)
+	}
+	if from == to {
+		return nil
+	}
+
+	song := q.items[from]
+	q.items = append(q.items[:from], q.items[from+1:]...)
+	q.items = append(q.items[:to], append([]lib.Song{song}, q.items[to:]...)...)
+
+	switch {
+	case q.current == from:
+		q.current = to
+	case from < q.current && to >= q.current:
+		q.current--
+	case from > q.current && to <= q.current:
+		q.current++
+	case from < q.resume && to >= q.resume:
+		q.resume--
+	case from >= q.resume && to < q.resume:
+		q.resume++
+	}
+	return nil
+}
+
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+	q.items = nil
+	q.current = -1
+	q.resume = -1
+	q.history = nil
+	q.played = make(map[string]bool)
+}
+
+func (q *Queue) JumpTo(index int) (lib.Song, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if index < 0 || index >= len(q.items) {
+		return lib.Song{}, false
+	}
+	q.moveToLocked(index)
+	return q.items[index], true
+}
+
+// Next is a manual skip. It honours shuffle, and with repeat off it stops
+// at the end of the queue instead of wrapping.
+func (q *Queue) Next() (lib.Song, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	index, ok := q.upcomingLocked()
+	if !ok {
+		return lib.Song{}, false
+	}
+	q.moveToLocked(index)
+	return q.items[index], true
+}
+
+// Advance picks the song to play after the current one finishes. Unlike
+// Next it keeps returning the same song in repeat-one mode.
+func (q *Queue) Advance() (lib.Song, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.repeat == RepeatOne && q.current >= 0 && q.current < len(q.items) {
+		return q.items[q.current], true
+	}
+
+	index, ok := q.upcomingLocked()
+	if !ok {
+		return lib.Song{}, false
+	}
+	q.moveToLocked(index)
+	return q.items[index], true
+}
+
+// PeekAdvance returns the song Advance would move to without moving.
+func (q *Queue) PeekAdvance() (lib.Song, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.repeat == RepeatOne && q.current >= 0 && q.current < len(q.items) {
+		return q.items[q.current], true
+	}
+
+	index, ok := q.upcomingLocked()
+	if !ok {
+		return lib.Song{}, false
+	}
+	q.upcoming = index
+	return q.items[index], true
+}
+
+// Previous walks back through the playback history, skipping songs that
+// have since left the queue. Without history it falls back to the entry
+// before the current one.
+func (q *Queue) Previous() (lib.Song, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	if len(q.items) == 0 {
+		return lib.Song{}, false
+	}
+
+	for len(q.history) > 0 {
+		path := q.history[len(q.history)-1]
+		q.history = q.history[:len(q.history)-1]
+		if index := q.indexOfLocked(path); index >= 0 && index != q.current {
+			q.current = index
+			q.resume = -1
+			return q.items[index], true
+		}
+	}
+
+	index := q.current - 1
+	if q.resume >= 0 {
+		index = q.resume - 1
+	}
+	if index < 0 {
+		if q.repeat == RepeatOff {
+			return lib.Song{}, false
+		}
+		index = len(q.items) - 1
+	}
+	q.current = index
+	q.resume = -1
+	q.played[q.items[index].Path] = true
+	return q.items[index], true
+}
+
+func (q *Queue) upcomingLocked() (int, bool) {
+	if q.upcoming >= 0 && q.upcoming < len(q.items) {
+		return q.upcoming, true
+	}
+	return q.nextIndexLocked()
+}
+
+func (q *Queue) nextIndexLocked() (int, bool) {
+	n := len(q.items)
+	if n == 0 {
+		return 0, false
+	}
+
+	switch q.shuffle {
+	case ShuffleRandom:
+		if q.current < 0 || q.current >= n || n == 1 {
+			return rand.IntN(n), true
+		}
+		// Draw from the other n-1 songs so a skip always changes track.
+		index := rand.IntN(n - 1)
+		if index >= q.current {
+			index++
+		}
+		return index, true
+
+	case ShuffleBag:
+		candidates := q.bagCandidatesLocked()
+		if len(candidates) == 0 {
+			if q.repeat == RepeatOff {
+				return 0, false
+			}
+			q.resetBagLocked()
+			candidates = q.bagCandidatesLocked()
+			if len(candidates) == 0 {
+				// A single-song queue has nothing else to draw.
+				return max(q.current, 0), true
+			}
+		}
+		return candidates[rand.IntN(len(candidates))], true
+	}
+
+	index := q.current + 1
+	if q.resume >= 0 {
+		index = q.resume
+	}
+	if index >= n {
+		if q.repeat == RepeatOff {
+			return 0, false
+		}
+		index = 0
+	}
+	return index, true
+}
+
+func (q *Queue) bagCandidatesLocked() []int {
+	var candidates []int
+	for i, song := range q.items {
+		if i != q.current && !q.played[song.Path] {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates
+}
+
+func (q *Queue) moveToLocked(index int) {
+	q.upcoming = -1
+	if index != q.current {
+		q.pushHistoryLocked()
+	}
+	q.current = index
+	q.resume = -1
+	q.played[q.items[index].Path] = true
+}
+
+func (q *Queue) pushHistoryLocked() {
+	if q.current < 0 || q.current >= len(q.items) {
+		return
+	}
+	q.history = append(q.history, q.items[q.current].Path)
+	if len(q.history) > maxHistory {
+		q.history = q.history[len(q.history)-maxHistory:]
+	}
+}
+
+func (q *Queue) indexOfLocked(path string) int {
+	for i, song := range q.items {
+		if song.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// Sync refreshes queued songs from the library after it changes. Songs
+// whose files are gone from the library are dropped.
+func (q *Queue) Sync(lookup func(path string) *lib.Song) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.upcoming = -1
+
+	items := q.items[:0]
+	current, resume := q.current, q.resume
+	for i, song := range q.items {
+		updated := lookup(song.Path)
+		if updated == nil {
+			switch {
+			case i == q.current:
+				current = -1
+				resume = len(items)
+			case i < q.resume:
+				resume--
+			}
+			continue
+		}
+		if i == q.current {
+			current = len(items)
+		}
+		items = append(items, *updated)
+	}
+	q.items = items
+	q.current = current
+	q.resume = resume
+}
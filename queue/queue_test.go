@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"testing"
+
+	lib "kanade/library"
+)
+
+func songs(paths ...string) []lib.Song {
+	items := make([]lib.Song, len(paths))
+	for i, path := range paths {
+		items[i] = lib.Song{Path: path}
+	}
+	return items
+}
+
+func TestRemovePlayingEntry(t *testing.T) {
+	q := New()
+	q.SetRepeat(RepeatOff)
+	q.Replace(songs("a", "b", "c"), 1)
+
+	if err := q.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	if song, ok := q.Current(); ok {
+		t.Fatalf("Current() = %q after removing it", song.Path)
+	}
+	if index := q.CurrentIndex(); index != -1 {
+		t.Fatalf("CurrentIndex() = %d after removing it, want -1", index)
+	}
+
+	song, ok := q.Next()
+	if !ok || song.Path != "c" {
+		t.Fatalf("Next() = %q, %v, want c", song.Path, ok)
+	}
+	if index := q.CurrentIndex(); index != 1 {
+		t.Fatalf("CurrentIndex() = %d, want 1", index)
+	}
+}
+
+func TestRemovePlayingEntryThenEdit(t *testing.T) {
+	q := New()
+	q.SetRepeat(RepeatOff)
+	q.Replace(songs("a", "b", "c", "d"), 1)
+	q.Remove(1)
+	q.Remove(0)
+	q.PlayNext(songs("x")...)
+
+	song, ok := q.Advance()
+	if !ok || song.Path != "x" {
+		t.Fatalf("Advance() = %q, %v, want x", song.Path, ok)
+	}
+	song, ok = q.Advance()
+	if !ok || song.Path != "c" {
+		t.Fatalf("Advance() = %q, %v, want c", song.Path, ok)
+	}
+}
+
+func TestRemoveLastPlayingEntry(t *testing.T) {
+	q := New()
+	q.SetRepeat(RepeatOff)
+	q.Replace(songs("a", "b"), 1)
+	q.Remove(1)
+
+	if song, ok := q.Next(); ok {
+		t.Fatalf("Next() = %q with repeat off at the end", song.Path)
+	}
+	song, ok := q.Previous()
+	if !ok || song.Path != "a" {
+		t.Fatalf("Previous() = %q, %v, want a", song.Path, ok)
+	}
+}
+
+func TestSyncDropsPlayingEntry(t *testing.T) {
+	q := New()
+	q.Replace(songs("a", "b", "c", "d"), 2)
+	q.Sync(func(path string) *lib.Song {
+		if path == "a" || path == "c" {
+			return nil
+		}
+		return &lib.Song{Path: path}
+	})
+
+	if _, ok := q.Current(); ok {
+		t.Fatal("Current() still reports the dropped entry")
+	}
+	song, ok := q.Next()
+	if !ok || song.Path != "d" {
+		t.Fatalf("Next() = %q, %v, want d", song.Path, ok)
+	}
+}
+
+func TestSyncKeepsPlayingEntry(t *testing.T) {
+	q := New()
+	q.Replace(songs("a", "b", "c"), 2)
+	q.Sync(func(path string) *lib.Song {
+		if path == "a" {
+			return nil
+		}
+		return &lib.Song{Path: path, Title: "updated"}
+	})
+
+	song, ok := q.Current()
+	if !ok || song.Path != "c" || song.Title != "updated" {
+		t.Fatalf("Current() = %+v, %v, want the updated c", song, ok)
+	}
+}
@@ -84,11 +84,12 @@ func (r *AlbumArtRenderer) UpdateSizeResponsive(terminalWidth, terminalHeight in
 }
 
 func (r *AlbumArtRenderer) ExtractDominantColor(song lib.Song) string {
-	if song.Picture == nil || song.Picture.Data == nil || len(song.Picture.Data) == 0 {
+	picture := song.LoadPicture()
+	if picture == nil || len(picture.Data) == 0 {
 		return DefaultAccentColor
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(song.Picture.Data))
+	img, _, err := image.Decode(bytes.NewReader(picture.Data))
 	if err != nil {
 		return DefaultAccentColor
 	}
@@ -165,11 +166,12 @@ func getDominantColorAdvanced(img image.Image) struct{ R, G, B uint8 } {
 }
 
 func (r *AlbumArtRenderer) RenderAlbumArt(song lib.Song) string {
-	if song.Picture == nil || song.Picture.Data == nil || len(song.Picture.Data) == 0 {
+	picture := song.LoadPicture()
+	if picture == nil || len(picture.Data) == 0 {
 		return r.renderPlaceholder()
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(song.Picture.Data))
+	img, _, err := image.Decode(bytes.NewReader(picture.Data))
 	if err != nil {
 		return r.renderError("Failed to decode image")
 	}
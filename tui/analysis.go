@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"kanade/loudness"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	AnalysisProgressMsg struct {
+		Progress loudness.Progress
+	}
+
+	AnalysisDoneMsg struct {
+		Result loudness.Result
+		Error  error
+	}
+)
+
+// startAnalysis measures the loudness of the library in the background.
+// Progress shows in the library view's status line.
+func (m *Model) startAnalysis(all bool) tea.Cmd {
+	if m.analysisCancel != nil {
+		return commandError(fmt.Errorf("loudness analysis is already running"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.analysisCancel = cancel
+	progress := make(chan loudness.Progress, 1)
+	m.analysisProgress = progress
+	m.setStatus("Analyzing loudness...")
+
+	library := m.library
+	run := func() tea.Msg {
+		defer close(progress)
+		result, err := loudness.AnalyzeLibrary(ctx, library, loudness.Options{All: all}, func(p loudness.Progress) {
+			// Drop stale updates rather than slow the analysis down.
+			select {
+			case <-progress:
+			default:
+			}
+			progress <- p
+		})
+		return AnalysisDoneMsg{Result: result, Error: err}
+	}
+
+	return tea.Batch(run, m.listenForAnalysis())
+}
+
+func (m *Model) stopAnalysis() {
+	if m.analysisCancel != nil {
+		m.analysisCancel()
+	}
+}
+
+func (m *Model) listenForAnalysis() tea.Cmd {
+	progress := m.analysisProgress
+	if progress == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		p, ok := <-progress
+		if !ok {
+			return nil
+		}
+		return AnalysisProgressMsg{Progress: p}
+	}
+}
+
+func (m *Model) handleAnalysisProgress(msg AnalysisProgressMsg) tea.Cmd {
+	if m.analysisCancel == nil {
+		return nil
+	}
+	p := msg.Progress
+	if p.Path != "" {
+		m.setStatus(fmt.Sprintf("Analyzing loudness %d/%d: %s", p.Done+1, p.Total, filepath.Base(p.Path)))
+	}
+	return m.listenForAnalysis()
+}
+
+func (m *Model) handleAnalysisDone(msg AnalysisDoneMsg) tea.Cmd {
+	m.analysisCancel = nil
+	m.analysisProgress = nil
+
+	if msg.Result.Analyzed > 0 {
+		m.refreshLibrary()
+	}
+
+	switch {
+	case errors.Is(msg.Error, context.Canceled):
+		m.setStatus(fmt.Sprintf("Loudness analysis stopped after %d songs", msg.Result.Analyzed))
+	case msg.Error != nil:
+		m.setStatus("")
+		return commandError(fmt.Errorf("loudness analysis failed: %w", msg.Error))
+	case msg.Result.Analyzed == 0 && msg.Result.Failed == 0:
+		m.setStatus("Every song already has loudness values")
+	default:
+		m.setStatus(fmt.Sprintf("Analyzed %d songs, %d failed", msg.Result.Analyzed, msg.Result.Failed))
+	}
+	return nil
+}
+
+func (m *Model) setStatus(text string) {
+	m.libraryModel.statusText = text
+	m.statusTimeout = time.Now().Add(ErrorTimeout)
+}
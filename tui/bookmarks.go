@@ -0,0 +1,152 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lib "kanade/library"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// markLoopStart remembers point A. If a loop is already running its start
+// moves there straight away.
+func (m *PlayerModel) markLoopStart() {
+	position := m.audioPlayer.GetPlaybackPosition()
+	if _, end, ok := m.audioPlayer.Loop(); ok && position < end {
+		if err := m.audioPlayer.SetLoop(position, end); err != nil {
+			m.errorMsg = err.Error()
+			return
+		}
+	}
+	m.loopStart = position
+	m.loopStartSet = true
+	m.errorMsg = ""
+}
+
+// markLoopEnd sets point B and starts looping from A, or from the start of
+// the track when A wasn't marked.
+func (m *PlayerModel) markLoopEnd() {
+	start := time.Duration(0)
+	if m.loopStartSet {
+		start = m.loopStart
+	} else if loopStart, _, ok := m.audioPlayer.Loop(); ok {
+		start = loopStart
+	}
+
+	if err := m.audioPlayer.SetLoop(start, m.audioPlayer.GetPlaybackPosition()); err != nil {
+		m.errorMsg = err.Error()
+		return
+	}
+	m.loopStartSet = false
+	m.errorMsg = ""
+}
+
+func (m *PlayerModel) clearLoop() {
+	m.audioPlayer.ClearLoop()
+	m.loopStartSet = false
+}
+
+// renderMarks lists the A-B loop and the bookmarks of the current song.
+func (m *PlayerModel) renderMarks() string {
+	if m.audioPlayer == nil {
+		return ""
+	}
+
+	var marks []string
+	if start, end, ok := m.audioPlayer.Loop(); ok {
+		marks = append(marks, fmt.Sprintf("A-B %s–%s", FormatDuration(start), FormatDuration(end)))
+	} else if m.loopStartSet {
+		marks = append(marks, fmt.Sprintf("A %s–", FormatDuration(m.loopStart)))
+	}
+
+	if m.bookmarks != nil && m.currentSong != nil {
+		for _, mark := range m.bookmarks.List(m.currentSong.Path) {
+			marks = append(marks, fmt.Sprintf("%s %s", mark.Name, FormatDuration(mark.Position)))
+		}
+	}
+	return strings.Join(marks, " • ")
+}
+
+// setLoop handles :loop A B, and :loop or :loop off to stop looping.
+func (m *Model) setLoop(args []string) tea.Cmd {
+	if len(args) == 0 || (len(args) == 1 && strings.EqualFold(args[0], "off")) {
+		m.playerModel.clearLoop()
+		return nil
+	}
+	if len(args) != 2 {
+		return commandError(fmt.Errorf("usage: loop <start> <end> or loop off"))
+	}
+
+	start, err := ParsePosition(args[0])
+	if err != nil {
+		return commandError(err)
+	}
+	end, err := ParsePosition(args[1])
+	if err != nil {
+		return commandError(err)
+	}
+	if err := m.AudioPlayer.SetLoop(start, end); err != nil {
+		return commandError(err)
+	}
+	m.playerModel.loopStartSet = false
+	return nil
+}
+
+// bookmark handles :bookmark NAME, which marks the current position, and
+// :bookmark delete NAME.
+func (m *Model) bookmark(args []string) tea.Cmd {
+	path := m.AudioPlayer.GetCurrentFile()
+	if m.bookmarks == nil || path == "" {
+		return commandError(fmt.Errorf("nothing is playing"))
+	}
+	if len(args) == 0 {
+		return commandError(fmt.Errorf("usage: bookmark <name> or bookmark delete <name>"))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "delete", "del", "rm":
+		if len(args) < 2 {
+			return commandError(fmt.Errorf("usage: bookmark delete <name>"))
+		}
+		if err := m.bookmarks.Remove(path, strings.Join(args[1:], " ")); err != nil {
+			return commandError(err)
+		}
+		return nil
+	}
+
+	mark := lib.Bookmark{
+		Name:     strings.Join(args, " "),
+		Position: m.AudioPlayer.GetPlaybackPosition(),
+	}
+	if err := m.bookmarks.Set(path, mark); err != nil {
+		return commandError(err)
+	}
+	return nil
+}
+
+// jump seeks to a bookmark of the current track, or to a position such as
+// 1:30.
+func (m *Model) jump(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return commandError(fmt.Errorf("usage: jump <bookmark or position>"))
+	}
+	target := strings.Join(args, " ")
+
+	position, err := ParsePosition(target)
+	if m.bookmarks != nil {
+		if mark, ok := m.bookmarks.Get(m.AudioPlayer.GetCurrentFile(), target); ok {
+			position, err = mark.Position, nil
+		}
+	}
+	if err != nil {
+		return commandError(fmt.Errorf("no bookmark named %q", target))
+	}
+
+	if err := m.AudioPlayer.Seek(position); err != nil {
+		return commandError(err)
+	}
+	m.playerModel.updatePlaybackStatus()
+	return nil
+}
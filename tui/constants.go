@@ -72,8 +72,17 @@ const (
 	TrackChangeDelay = 250 * time.Millisecond
 	SeekInterval     = 10 * time.Second
 
+	// Frame rate cap for the visualizer
+	VisualizerFrameInterval = time.Second / 30
+
+	// How often the session is saved while running
+	SessionSaveInterval = 30 * time.Second
+
 	// Playback thresholds
 	PlaybackEndThreshold = 100 * time.Millisecond
+
+	// Playback speed step for the < and > keys
+	SpeedStep = 0.1
 )
 
 // Color Constants
@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kanade/audio"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const devicePanelRows = 10
+
+// handleDeviceKey moves through the device list while it is open. It
+// reports whether the key was used.
+func (m *PlayerModel) handleDeviceKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "up", "k":
+		m.deviceIndex = max(m.deviceIndex-1, 0)
+	case "down", "j":
+		m.deviceIndex = max(min(m.deviceIndex+1, len(m.devices)-1), 0)
+	case "enter":
+		if m.deviceIndex < len(m.devices) {
+			m.switchDevice(m.devices[m.deviceIndex].Name)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *PlayerModel) switchDevice(name string) error {
+	if err := m.audioPlayer.SetDevice(name); err != nil {
+		m.errorMsg = err.Error()
+		return err
+	}
+	m.errorMsg = ""
+	return nil
+}
+
+// openDevices lists the output devices in place of the album art, with
+// the one playing selected.
+func (m *PlayerModel) openDevices() error {
+	devices, err := audio.Devices()
+	if err != nil {
+		return err
+	}
+	m.devices = devices
+	m.deviceIndex = 0
+	current := m.currentDevice()
+	for i, device := range devices {
+		if device.Name == current {
+			m.deviceIndex = i
+		}
+	}
+	m.showDevices = true
+	m.showEQ = false
+	return nil
+}
+
+// currentDevice is the device playing, with the speaker output counting as
+// the default device.
+func (m *PlayerModel) currentDevice() string {
+	if device := m.audioPlayer.Device(); device != "" {
+		return device
+	}
+	return "default"
+}
+
+func (m *PlayerModel) renderDevices(dominantColor string) string {
+	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(dominantColor)).Bold(true)
+	deviceStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(DefaultSecondaryText))
+	mutedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(DefaultMutedText))
+	centerStyle := lipgloss.NewStyle().Width(m.width).Align(lipgloss.Center)
+	width := min(m.width-DefaultPadding*4, 72)
+
+	var lines []string
+	title := "Output devices"
+	if rate := m.audioPlayer.SampleRate(); rate > 0 {
+		title += fmt.Sprintf(" • %d Hz", rate)
+	}
+	lines = append(lines, mutedStyle.Render(title), "")
+
+	current := m.currentDevice()
+	start, end := CalculateVisibleRange(len(m.devices), devicePanelRows, m.deviceIndex)
+	for i := start; i < end; i++ {
+		device := m.devices[i]
+		marker := "  "
+		if device.Name == current {
+			marker = "● "
+		}
+		line := fmt.Sprintf("%s%d. %s", marker, i+1, device.Name)
+		if device.Description != "" {
+			line += "  " + device.Description
+		}
+		line = PadText(line, width)
+
+		style := deviceStyle
+		if i == m.deviceIndex {
+			style = selectedStyle
+		}
+		lines = append(lines, style.Render(line))
+	}
+	if len(m.devices) == 0 {
+		lines = append(lines, mutedStyle.Render("No devices found"))
+	}
+
+	lines = append(lines, "", mutedStyle.Render("↑/↓ select • enter switch • D close"))
+
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(centerStyle.Render(line))
+		content.WriteString("\n")
+	}
+	return content.String()
+}
+
+// setDevice handles :device NAME, where NAME can also be a number from
+// the :devices list, and :device on its own, which shows the list.
+func (m *Model) setDevice(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return m.listDevices()
+	}
+
+	name := strings.Join(args, " ")
+	if n, err := strconv.Atoi(name); err == nil {
+		devices, err := audio.Devices()
+		if err != nil {
+			return commandError(err)
+		}
+		if n < 1 || n > len(devices) {
+			return commandError(fmt.Errorf("no device number %d", n))
+		}
+		name = devices[n-1].Name
+	}
+	if err := m.playerModel.switchDevice(name); err != nil {
+		return commandError(err)
+	}
+	return nil
+}
+
+func (m *Model) listDevices() tea.Cmd {
+	if err := m.playerModel.openDevices(); err != nil {
+		return commandError(err)
+	}
+	return func() tea.Msg { return SwitchViewMsg{View: PlayerView} }
+}
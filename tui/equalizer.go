@@ -0,0 +1,122 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"kanade/audio"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	eqPanelRows   = 8
+	eqColumnWidth = 5
+	eqStep        = 1.0
+)
+
+var eqBandLabels = [audio.EQBands]string{"31", "62", "125", "250", "500", "1k", "2k", "4k", "8k", "16k"}
+
+// handleEQKey adjusts the equalizer while its panel is open. It reports
+// whether the key was used.
+func (m *PlayerModel) handleEQKey(msg tea.KeyMsg) bool {
+	eq := m.audioPlayer.Equalizer()
+
+	switch msg.String() {
+	case "left", "h":
+		m.eqBand = (m.eqBand + audio.EQBands - 1) % audio.EQBands
+	case "right", "l":
+		m.eqBand = (m.eqBand + 1) % audio.EQBands
+	case "up", "k":
+		eq.SetBand(m.eqBand, eq.Gains()[m.eqBand]+eqStep)
+	case "down", "j":
+		eq.SetBand(m.eqBand, eq.Gains()[m.eqBand]-eqStep)
+	case "0":
+		eq.SetBand(m.eqBand, 0)
+	case "[":
+		m.cycleEQPreset(-1)
+	case "]":
+		m.cycleEQPreset(1)
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *PlayerModel) cycleEQPreset(direction int) {
+	eq := m.audioPlayer.Equalizer()
+	names := audio.EQPresetNames()
+
+	i := slices.Index(names, eq.Preset())
+	if i < 0 && direction < 0 {
+		i = 0
+	}
+	i = (i + direction + len(names)) % len(names)
+
+	if err := eq.SetPreset(names[i]); err != nil {
+		m.errorMsg = err.Error()
+	}
+}
+
+func (m *PlayerModel) renderEqualizer(dominantColor string) string {
+	eq := m.audioPlayer.Equalizer()
+	gains := eq.Gains()
+
+	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(dominantColor))
+	bandStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(Colors.DarkenColor(dominantColor, DarkenFactor)))
+	mutedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(DefaultMutedText))
+	centerStyle := lipgloss.NewStyle().Width(m.width).Align(lipgloss.Center)
+
+	var lines []string
+	title := fmt.Sprintf("Equalizer • %s", eq.Preset())
+	if preamp := eq.Preamp(); preamp < 0 {
+		title += fmt.Sprintf(" • preamp %.1f dB", preamp)
+	}
+	lines = append(lines, mutedStyle.Render(title), "")
+
+	// Each row holds two half blocks, so the bars move in 1.5 dB steps.
+	for row := eqPanelRows - 1; row >= 0; row-- {
+		var line strings.Builder
+		for band, gain := range gains {
+			level := int((gain + audio.MaxEQGain) / (2 * audio.MaxEQGain) * eqPanelRows * 2)
+
+			cell := "·"
+			style := mutedStyle
+			if level >= (row+1)*2 {
+				cell = "█"
+				style = bandStyle
+			} else if level == row*2+1 {
+				cell = "▄"
+				style = bandStyle
+			}
+			if band == m.eqBand && cell != "·" {
+				style = selectedStyle
+			}
+			line.WriteString(lipgloss.PlaceHorizontal(eqColumnWidth, lipgloss.Center, style.Render(cell)))
+		}
+		lines = append(lines, line.String())
+	}
+
+	var labels strings.Builder
+	for band, label := range eqBandLabels {
+		style := mutedStyle
+		if band == m.eqBand {
+			style = selectedStyle.Bold(true)
+		}
+		labels.WriteString(lipgloss.PlaceHorizontal(eqColumnWidth, lipgloss.Center, style.Render(label)))
+	}
+	lines = append(lines, labels.String(), "")
+
+	selected := fmt.Sprintf("%s Hz %+.1f dB", eqBandLabels[m.eqBand], gains[m.eqBand])
+	lines = append(lines, selectedStyle.Render(selected))
+	lines = append(lines, mutedStyle.Render("←/→ band • ↑/↓ gain • [/] preset • 0 reset • E close"))
+
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(centerStyle.Render(line))
+		content.WriteString("\n")
+	}
+	return content.String()
+}
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -20,11 +21,37 @@ const (
 	GroupByArtist
 )
 
+func (g GroupingMode) String() string {
+	switch g {
+	case GroupByAlbum:
+		return "album"
+	case GroupByArtist:
+		return "artist"
+	default:
+		return "none"
+	}
+}
+
+func ParseGroupingMode(s string) (GroupingMode, error) {
+	switch strings.ToLower(s) {
+	case "none", "off":
+		return NoGrouping, nil
+	case "album":
+		return GroupByAlbum, nil
+	case "artist":
+		return GroupByArtist, nil
+	}
+	return NoGrouping, fmt.Errorf("unknown grouping mode %q (use none, album or artist)", s)
+}
+
 type GroupItem struct {
 	Name      string
 	Songs     []lib.Song
 	Expanded  bool
 	SongCount int
+	// Radio marks the group of internet radio stations, which comes first
+	// whatever the grouping.
+	Radio bool
 }
 
 type ListItem struct {
@@ -48,11 +75,16 @@ type LibraryModel struct {
 	searchQuery   string
 	position      time.Duration
 	totalDuration time.Duration
+	statusText    string
 
 	groupingMode   GroupingMode
 	groups         []GroupItem
 	displayItems   []ListItem
 	expandedGroups map[string]bool
+
+	stations         []lib.Song
+	filteredStations []lib.Song
+	radioExpanded    bool
 }
 
 type LibraryStyles struct {
@@ -153,17 +185,11 @@ func (m *LibraryModel) GetColoredStyles(dominantColor string) LibraryStyles {
 func (m *LibraryModel) filterSongs() {
 	if m.searchQuery == "" {
 		m.filteredSongs = m.songs
+		m.filteredStations = m.stations
 	} else {
 		query := strings.ToLower(m.searchQuery)
-		var filtered []lib.Song
-
-		for _, song := range m.songs {
-			searchText := strings.ToLower(song.Artist + " " + song.Title + " " + song.Album + " " + song.Path)
-			if strings.Contains(searchText, query) {
-				filtered = append(filtered, song)
-			}
-		}
-		m.filteredSongs = filtered
+		m.filteredSongs = searchSongs(m.songs, query)
+		m.filteredStations = searchSongs(m.stations, query)
 	}
 
 	m.rebuildDisplayItems()
@@ -173,6 +199,71 @@ func (m *LibraryModel) filterSongs() {
 	}
 }
 
+func searchSongs(songs []lib.Song, query string) []lib.Song {
+	var filtered []lib.Song
+	for _, song := range songs {
+		searchText := strings.ToLower(song.Artist + " " + song.Title + " " + song.Album + " " + song.Path)
+		if strings.Contains(searchText, query) {
+			filtered = append(filtered, song)
+		}
+	}
+	return filtered
+}
+
+// SetStations replaces the stations listed in the Radio group.
+func (m *LibraryModel) SetStations(stations []lib.Song) {
+	m.stations = stations
+	m.filterSongs()
+}
+
+// showRadio expands the Radio group and moves to it, clearing a search
+// that hides it.
+func (m *LibraryModel) showRadio() {
+	if m.searchQuery != "" {
+		m.searchQuery = ""
+		m.filterSongs()
+	}
+	m.radioExpanded = true
+	m.rebuildDisplayItems()
+	m.cursor = 0
+}
+
+func (m *LibraryModel) SetSongs(songs []lib.Song) {
+	var selectedPath, selectedGroup string
+	if m.cursor >= 0 && m.cursor < len(m.displayItems) {
+		item := m.displayItems[m.cursor]
+		if item.IsGroup {
+			selectedGroup = item.Group.Name
+		} else if item.Song != nil {
+			selectedPath = item.Song.Path
+		}
+	}
+
+	m.songs = songs
+	m.filterSongs()
+
+	if m.currentSong != nil {
+		for _, song := range songs {
+			if song.Path == m.currentSong.Path {
+				songCopy := song
+				m.currentSong = &songCopy
+				break
+			}
+		}
+	}
+
+	for i, item := range m.displayItems {
+		if item.IsGroup && selectedGroup != "" && item.Group.Name == selectedGroup {
+			m.cursor = i
+			return
+		}
+		if !item.IsGroup && selectedPath != "" && item.Song != nil && item.Song.Path == selectedPath {
+			m.cursor = i
+			return
+		}
+	}
+}
+
 func (m *LibraryModel) groupSongs() []GroupItem {
 	if m.groupingMode == NoGrouping {
 		return nil
@@ -189,7 +280,10 @@ func (m *LibraryModel) groupSongs() []GroupItem {
 				groupKey = "Unknown Album"
 			}
 		case GroupByArtist:
-			groupKey = song.Artist
+			groupKey = song.AlbumArtist
+			if groupKey == "" {
+				groupKey = song.Artist
+			}
 			if groupKey == "" {
 				groupKey = "Unknown Artist"
 			}
@@ -200,14 +294,16 @@ func (m *LibraryModel) groupSongs() []GroupItem {
 	var groups []GroupItem
 	for name, songs := range groupMap {
 
-		sort.Slice(songs, func(i, j int) bool {
+		sort.SliceStable(songs, func(i, j int) bool {
 			if m.groupingMode == GroupByArtist {
-
+				if songs[i].Year != songs[j].Year {
+					return songs[i].Year < songs[j].Year
+				}
 				if songs[i].Album != songs[j].Album {
 					return songs[i].Album < songs[j].Album
 				}
 			}
-			return songs[i].Title < songs[j].Title
+			return trackLess(songs[i], songs[j])
 		})
 
 		groups = append(groups, GroupItem{
@@ -225,9 +321,46 @@ func (m *LibraryModel) groupSongs() []GroupItem {
 	return groups
 }
 
+func trackLess(a, b lib.Song) bool {
+	if a.DiscNumber != b.DiscNumber {
+		return a.DiscNumber < b.DiscNumber
+	}
+	if a.TrackNumber != b.TrackNumber {
+		if a.TrackNumber == 0 || b.TrackNumber == 0 {
+			return b.TrackNumber == 0
+		}
+		return a.TrackNumber < b.TrackNumber
+	}
+	return a.Title < b.Title
+}
+
 func (m *LibraryModel) rebuildDisplayItems() {
 	m.displayItems = nil
 
+	if len(m.filteredStations) > 0 {
+		radio := GroupItem{
+			Name:      "Radio",
+			Songs:     m.filteredStations,
+			Expanded:  m.radioExpanded,
+			SongCount: len(m.filteredStations),
+			Radio:     true,
+		}
+		m.displayItems = append(m.displayItems, ListItem{
+			IsGroup:    true,
+			Group:      &radio,
+			GroupIndex: -1,
+		})
+		if radio.Expanded {
+			for i, station := range radio.Songs {
+				m.displayItems = append(m.displayItems, ListItem{
+					Song:       &station,
+					GroupIndex: -1,
+					SongIndex:  i,
+				})
+			}
+		}
+	}
+
 	if m.groupingMode == NoGrouping {
 		for i, song := range m.filteredSongs {
 			m.displayItems = append(m.displayItems, ListItem{
@@ -283,6 +416,11 @@ func (m *LibraryModel) toggleGroupExpansion() {
 	if !item.IsGroup {
 		return
 	}
+	if item.Group.Radio {
+		m.radioExpanded = !m.radioExpanded
+		m.rebuildDisplayItems()
+		return
+	}
 
 	groupName := item.Group.Name
 	m.expandedGroups[groupName] = !m.expandedGroups[groupName]
@@ -294,17 +432,19 @@ func (m *LibraryModel) jumpToCurrentSong() {
 		return
 	}
 
-	songInFilteredList := false
-	for _, song := range m.filteredSongs {
-		if song.Path == m.currentSong.Path {
-			songInFilteredList = true
-			break
-		}
+	isCurrent := func(song lib.Song) bool {
+		return song.Path == m.currentSong.Path
 	}
+	songInFilteredList := slices.ContainsFunc(m.filteredSongs, isCurrent) ||
+		slices.ContainsFunc(m.filteredStations, isCurrent)
 
 	if !songInFilteredList && m.searchQuery != "" {
 		m.searchQuery = ""
-		m.filteredSongs = m.songs
+		m.filterSongs()
+	}
+
+	if !m.radioExpanded && slices.ContainsFunc(m.stations, isCurrent) {
+		m.radioExpanded = true
 		m.rebuildDisplayItems()
 	}
 
@@ -331,6 +471,51 @@ func (m *LibraryModel) jumpToCurrentSong() {
 	}
 }
 
+func (m *LibraryModel) selectedSongs() []lib.Song {
+	if len(m.displayItems) == 0 || m.cursor >= len(m.displayItems) {
+		return nil
+	}
+
+	item := m.displayItems[m.cursor]
+	if item.IsGroup {
+		return item.Group.Songs
+	}
+	return []lib.Song{*item.Song}
+}
+
+func (m *LibraryModel) queueSelection(next bool) tea.Cmd {
+	songs := m.selectedSongs()
+	if len(songs) == 0 {
+		return nil
+	}
+
+	return func() tea.Msg {
+		return QueueSongsMsg{Songs: songs, Next: next}
+	}
+}
+
+func (m *LibraryModel) editTags() tea.Cmd {
+	if len(m.displayItems) == 0 || m.cursor >= len(m.displayItems) {
+		return nil
+	}
+
+	item := m.displayItems[m.cursor]
+	// Stations have no tags to edit.
+	if (item.IsGroup && item.Group.Radio) || (!item.IsGroup && item.GroupIndex < 0) {
+		return nil
+	}
+	var msg EditTagsMsg
+	if item.IsGroup {
+		msg = EditTagsMsg{Songs: item.Group.Songs, Group: item.Group.Name}
+	} else {
+		msg = EditTagsMsg{Songs: []lib.Song{*item.Song}}
+	}
+
+	return func() tea.Msg {
+		return msg
+	}
+}
+
 func (m *LibraryModel) Init() tea.Cmd {
 	return tea.Tick(TickInterval, func(t time.Time) tea.Msg {
 		return TickMsg{Time: t}
@@ -390,6 +575,20 @@ func (m *LibraryModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.jumpToCurrentSong()
 			return m, nil
 
+		case "e":
+			return m, m.editTags()
+
+		case "a":
+			return m, m.queueSelection(false)
+
+		case "n":
+			return m, m.queueSelection(true)
+
+		case "Q":
+			return m, func() tea.Msg {
+				return SwitchViewMsg{View: QueueView}
+			}
+
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -643,7 +842,11 @@ func (m *LibraryModel) renderLibraryContent(currentStyles LibraryStyles, availab
 				expandIcon = "▼"
 			}
 
-			groupText := fmt.Sprintf("%s %s (%d songs)", expandIcon, item.Group.Name, item.Group.SongCount)
+			unit := "songs"
+			if item.Group.Radio {
+				unit = "stations"
+			}
+			groupText := fmt.Sprintf("%s %s (%d %s)", expandIcon, item.Group.Name, item.Group.SongCount, unit)
 			maxWidth := SafeMax(m.width-BorderAccountWidth, ContentMinWidth, ContentMinWidth)
 			if m.groupingMode != NoGrouping {
 				maxWidth -= 2
@@ -752,7 +955,7 @@ func (m *LibraryModel) View() string {
 		content.WriteString("\n")
 	}
 
-	if len(m.songs) == 0 {
+	if len(m.songs) == 0 && len(m.stations) == 0 {
 		content.WriteString(currentStyles.Title.Render("Kanade"))
 		content.WriteString("\n\n")
 		content.WriteString(currentStyles.Normal.Render("No songs found"))
@@ -772,6 +975,9 @@ func (m *LibraryModel) View() string {
 	availableHeight := m.height - currentHeight - HelpBottomReserve
 
 	libraryTitle := fmt.Sprintf("Library (%d songs)", len(m.filteredSongs))
+	if len(m.filteredStations) > 0 {
+		libraryTitle = fmt.Sprintf("Library (%d songs, %d stations)", len(m.filteredSongs), len(m.filteredStations))
+	}
 	if m.searchQuery != "" {
 		libraryTitle = fmt.Sprintf("%s • %s", libraryTitle, m.searchQuery)
 	}
@@ -823,6 +1029,10 @@ func (m *LibraryModel) View() string {
 	groupingText := m.getGroupingModeText()
 	pageInfo += fmt.Sprintf(" • %s", groupingText)
 
+	if m.statusText != "" {
+		pageInfo = m.statusText + " • " + pageInfo
+	}
+
 	rightContent := pageInfo
 
 	spacedContent := JoinHorizontalWithSpacing(leftContent, rightContent, m.width-BorderAccountWidth)
@@ -5,7 +5,11 @@ import (
 	"kanade/audio"
 	"kanade/downloader"
 	lib "kanade/library"
+	"kanade/loudness"
+	"kanade/queue"
+	"kanade/watcher"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,8 +22,41 @@ const (
 	LibraryView ViewState = iota
 	PlayerView
 	DownloaderView
+	TagEditorView
+	QueueView
 )
 
+func (v ViewState) String() string {
+	switch v {
+	case PlayerView:
+		return "player"
+	case DownloaderView:
+		return "downloader"
+	case TagEditorView:
+		return "tags"
+	case QueueView:
+		return "queue"
+	default:
+		return "library"
+	}
+}
+
+func ParseViewState(s string) (ViewState, error) {
+	switch strings.ToLower(s) {
+	case "library", "lib", "l":
+		return LibraryView, nil
+	case "player", "p":
+		return PlayerView, nil
+	case "downloader", "dl", "d":
+		return DownloaderView, nil
+	case "tags":
+		return TagEditorView, nil
+	case "queue", "q":
+		return QueueView, nil
+	}
+	return LibraryView, fmt.Errorf("unknown view %q", s)
+}
+
 type Model struct {
 	previousView ViewState
 	currentView  ViewState
@@ -29,12 +66,30 @@ type Model struct {
 	libraryModel    *LibraryModel
 	playerModel     *PlayerModel
 	downloaderModel *DownloaderModel
+	tagEditorModel  *TagEditorModel
+	queueModel      *QueueModel
 
 	library           *lib.Library
 	AudioPlayer       *audio.Player
 	downloaderManager *downloader.DownloadManager
+	libraryWatcher    *watcher.Watcher
 	songs             []lib.Song
-	currentSongIndex  int
+	queue             *queue.Queue
+	advancing         bool
+	preparedNext      string
+	analysisCancel    func()
+	analysisProgress  chan loudness.Progress
+	playerEvents      <-chan audio.Event
+	bookmarks         *lib.Bookmarks
+	stations          *lib.Stations
+	sessionPath       string
+	lastSessionSave   time.Time
+	resume            *SongSelectedMsg
+	sleep             *sleepTimer
+	sleepID           int
+	sleepFade         time.Duration
+	sleepQuit         bool
+	statusTimeout     time.Time
 
 	SelectedSong     *lib.Song
 	dominantColor    string
@@ -48,13 +103,20 @@ type Model struct {
 
 type (
 	SongSelectedMsg struct {
-		Song     lib.Song
-		KeepView bool
+		Song      lib.Song
+		KeepView  bool
+		FromQueue bool
+		// Continued is set when the player already moved on to Song by
+		// itself, so only the interface has to catch up.
+		Continued bool
+		// Resume loads Song paused at Position instead of playing it,
+		// which is how a saved session comes back.
+		Resume   bool
+		Position time.Duration
 	}
 
-	NextTrackMsg    struct{}
-	PrevTrackMsg    struct{}
-	SongFinishedMsg struct{}
+	NextTrackMsg struct{}
+	PrevTrackMsg struct{}
 
 	SwitchViewMsg struct {
 		View ViewState
@@ -96,6 +158,25 @@ type (
 		URL string
 	}
 
+	LibraryChangedMsg struct {
+		Change watcher.Change
+	}
+
+	EditTagsMsg struct {
+		Songs []lib.Song
+		Group string
+	}
+
+	TagsSavedMsg struct {
+		Paths []string
+		Error error
+	}
+
+	QueueSongsMsg struct {
+		Songs []lib.Song
+		Next  bool
+	}
+
 	DominantColorMsg struct {
 		Color string
 	}
@@ -106,6 +187,13 @@ type (
 	CommandExecutedMsg struct{}
 )
 
+// commandError reports err in the UI.
+func commandError(err error) tea.Cmd {
+	return func() tea.Msg {
+		return ErrorMsg{Error: err}
+	}
+}
+
 func NewModel(library *lib.Library, audioPlayer *audio.Player, downloaderManager *downloader.DownloadManager) *Model {
 	songs := library.ListSongs()
 
@@ -113,6 +201,8 @@ func NewModel(library *lib.Library, audioPlayer *audio.Player, downloaderManager
 	playerModel := NewPlayerModel(audioPlayer)
 	downloaderModel := NewDownloaderModel()
 	downloaderModel.SetDownloaderManager(downloaderManager)
+	playQueue := queue.New()
+	playerModel.SetQueue(playQueue)
 
 	model := &Model{
 		previousView:      LibraryView,
@@ -121,10 +211,12 @@ func NewModel(library *lib.Library, audioPlayer *audio.Player, downloaderManager
 		AudioPlayer:       audioPlayer,
 		downloaderManager: downloaderManager,
 		songs:             songs,
-		currentSongIndex:  -1,
+		queue:             playQueue,
 		libraryModel:      libraryModel,
 		playerModel:       playerModel,
 		downloaderModel:   downloaderModel,
+		tagEditorModel:    NewTagEditorModel(library),
+		queueModel:        NewQueueModel(playQueue),
 		dominantColor:     DefaultAccentColor,
 		albumArtRenderer:  NewAlbumArtRenderer(AlbumArtMinMax, AlbumArtMinMax),
 		commandBar:        NewCommandBar(),
@@ -133,6 +225,7 @@ func NewModel(library *lib.Library, audioPlayer *audio.Player, downloaderManager
 	audioPlayer.SetErrorCallback(func(err error) {
 		log.Printf("Audio player error: %v", err)
 	})
+	model.playerEvents, _ = audioPlayer.Subscribe()
 
 	return model
 }
@@ -144,9 +237,46 @@ func (m *Model) Init() tea.Cmd {
 		m.downloaderModel.Init(),
 		m.listenForDownloadProgress(),
 		m.listenForDownloadCompletion(),
+		m.listenForLibraryChanges(),
+		m.listenForPlayerEvents(),
+		m.resumeSession(),
 	)
 }
 
+func (m *Model) SetBookmarks(bookmarks *lib.Bookmarks) {
+	m.bookmarks = bookmarks
+	m.playerModel.bookmarks = bookmarks
+}
+
+func (m *Model) SetLibraryWatcher(libraryWatcher *watcher.Watcher) {
+	m.libraryWatcher = libraryWatcher
+}
+
+func (m *Model) listenForLibraryChanges() tea.Cmd {
+	if m.libraryWatcher == nil {
+		return nil
+	}
+	changes := m.libraryWatcher.Changes()
+	return func() tea.Msg {
+		change, ok := <-changes
+		if !ok {
+			return nil
+		}
+		return LibraryChangedMsg{Change: change}
+	}
+}
+
+func (m *Model) refreshLibrary() {
+	m.songs = m.library.ListSongs()
+	m.libraryModel.SetSongs(m.songs)
+	m.queue.Sync(m.Song)
+	if m.SelectedSong != nil {
+		if song := m.Song(m.SelectedSong.Path); song != nil {
+			m.SelectedSong = song
+		}
+	}
+}
+
 func (m *Model) listenForDownloadProgress() tea.Cmd {
 	return tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
 		select {
@@ -195,7 +325,13 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		downloaderModel, downloaderCmd := m.downloaderModel.Update(WindowSizeMsg{Width: msg.Width, Height: msg.Height})
 		m.downloaderModel = downloaderModel.(*DownloaderModel)
 
-		cmds = append(cmds, libraryCmd, playerCmd, downloaderCmd)
+		tagEditorModel, tagEditorCmd := m.tagEditorModel.Update(WindowSizeMsg{Width: msg.Width, Height: msg.Height})
+		m.tagEditorModel = tagEditorModel.(*TagEditorModel)
+
+		queueModel, queueCmd := m.queueModel.Update(WindowSizeMsg{Width: msg.Width, Height: msg.Height})
+		m.queueModel = queueModel.(*QueueModel)
+
+		cmds = append(cmds, libraryCmd, playerCmd, downloaderCmd, tagEditorCmd, queueCmd)
 
 	case tea.KeyMsg:
 		if m.commandBar != nil && m.commandBar.Active {
@@ -262,9 +398,15 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+		if m.currentView == TagEditorView {
+			tagEditorModel, cmd := m.tagEditorModel.Update(msg)
+			m.tagEditorModel = tagEditorModel.(*TagEditorModel)
+			return m, cmd
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
-			if m.currentView == PlayerView {
+			if m.currentView == PlayerView || m.currentView == QueueView {
 				m.currentView = LibraryView
 				return m, nil
 			}
@@ -283,6 +425,14 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.commandBar.Reset()
 				return m, nil
 			}
+			if m.currentView == PlayerView && m.playerModel.showEQ {
+				m.playerModel.showEQ = false
+				return m, nil
+			}
+			if m.currentView == PlayerView && m.playerModel.showDevices {
+				m.playerModel.showDevices = false
+				return m, nil
+			}
 			if m.currentView == PlayerView {
 				m.currentView = LibraryView
 				return m, nil
@@ -303,6 +453,16 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "p":
 			return m, m.playPause()
 
+		case "S":
+			if m.currentView == PlayerView || m.currentView == LibraryView || m.currentView == QueueView {
+				return m, m.toggleShuffle("")
+			}
+
+		case "r":
+			if m.currentView == PlayerView || m.currentView == LibraryView || m.currentView == QueueView {
+				return m, m.toggleRepeat("")
+			}
+
 		case "/":
 			if m.currentView == LibraryView && m.commandBar != nil {
 				m.commandBar.Active = true
@@ -332,19 +492,35 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.playerModel = playerModel.(*PlayerModel)
 		cmds = append(cmds, playerCmd)
 
-	case NextTrackMsg, SongFinishedMsg:
+	case NextTrackMsg:
 		return m, m.playNextTrack()
 
+	case PlayerEventMsg:
+		return m, m.handlePlayerEvent(msg.Event)
+
+	case SleepTickMsg:
+		return m, m.handleSleepTick(msg)
+
+	case VisualizerTickMsg:
+		return m, m.playerModel.handleVisualizerTick(m.currentView == PlayerView)
+
 	case PrevTrackMsg:
 		return m, m.playPreviousTrack()
 
 	case SongSelectedMsg:
 		downloaderModel, _ := m.downloaderModel.Update(msg)
 		m.downloaderModel = downloaderModel.(*DownloaderModel)
+		tagEditorModel, _ := m.tagEditorModel.Update(msg)
+		m.tagEditorModel = tagEditorModel.(*TagEditorModel)
+		queueModel, _ := m.queueModel.Update(msg)
+		m.queueModel = queueModel.(*QueueModel)
 		return m.handleSongSelection(msg)
 
 	case SwitchViewMsg:
 		m.currentView = msg.View
+		if msg.View == PlayerView {
+			return m, m.playerModel.startVisualizer()
+		}
 		return m, nil
 
 	case DownloadProgressMsg:
@@ -356,9 +532,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case DownloadCompletedMsg:
 		if msg.Event.Error == nil && msg.Event.Song != nil {
-			m.songs = m.library.ListSongs()
-			libraryModel := NewLibraryModel(m.songs)
-			m.libraryModel = libraryModel
+			m.refreshLibrary()
 		}
 
 		downloaderModel, cmd := m.downloaderModel.Update(msg)
@@ -371,41 +545,74 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		downloaderModel, cmd := m.downloaderModel.Update(msg)
 		m.downloaderModel = downloaderModel.(*DownloaderModel)
 		cmds = append(cmds, cmd)
+
+	case LibraryChangedMsg:
+		m.refreshLibrary()
+		cmds = append(cmds, m.listenForLibraryChanges())
+
+	case EditTagsMsg:
+		if len(msg.Songs) == 0 {
+			return m, nil
+		}
+		m.tagEditorModel.Open(msg.Songs, msg.Group)
+		m.currentView = TagEditorView
+		return m, nil
+
+	case AnalysisProgressMsg:
+		return m, m.handleAnalysisProgress(msg)
+
+	case AnalysisDoneMsg:
+		return m, m.handleAnalysisDone(msg)
+
+	case StationsChangedMsg:
+		return m, m.handleStationsChanged(msg)
+
+	case QueueSongsMsg:
+		if msg.Next {
+			m.queue.PlayNext(msg.Songs...)
+		} else {
+			m.queue.Enqueue(msg.Songs...)
+		}
+		return m, nil
+
+	case TagsSavedMsg:
+		if len(msg.Paths) > 0 {
+			m.refreshLibrary()
+		}
+		tagEditorModel, _ := m.tagEditorModel.Update(msg)
+		m.tagEditorModel = tagEditorModel.(*TagEditorModel)
+		if msg.Error != nil {
+			return m, nil
+		}
+		m.currentView = LibraryView
+		return m, nil
 	}
 
 	if tickMsg, ok := msg.(TickMsg); ok {
 		if m.lastError != nil && time.Now().After(m.errorTimeout) {
 			m.lastError = nil
 		}
-
-		if m.AudioPlayer.HasPlaybackFinished() || m.AudioPlayer.IsAtEnd() {
-			cmds = append(cmds, func() tea.Msg {
-				return SongFinishedMsg{}
-			})
+		if m.analysisCancel == nil && m.libraryModel.statusText != "" && time.Now().After(m.statusTimeout) {
+			m.libraryModel.statusText = ""
 		}
 
-		statusMsg := PlaybackStatusMsg{
-			IsPlaying: m.AudioPlayer.IsPlaying(),
-		}
+		cmds = append(cmds, m.prepareNextTrack())
 
-		libraryModel, _ := m.libraryModel.Update(statusMsg)
-		m.libraryModel = libraryModel.(*LibraryModel)
+		if m.sessionPath != "" && time.Since(m.lastSessionSave) >= SessionSaveInterval {
+			if err := m.SaveSession(); err != nil {
+				log.Printf("Failed to save session: %v", err)
+			}
+		}
 
 		if m.currentView == LibraryView {
 			positionMsg := PlaybackPositionMsg{
 				Position:      m.AudioPlayer.GetPlaybackPosition(),
 				TotalDuration: m.AudioPlayer.GetTotalLength(),
 			}
-			libraryModel, _ = m.libraryModel.Update(positionMsg)
+			libraryModel, _ := m.libraryModel.Update(positionMsg)
 			m.libraryModel = libraryModel.(*LibraryModel)
 		}
 
-		if err := m.AudioPlayer.GetLastError(); err != nil && err != m.lastError {
-			cmds = append(cmds, func() tea.Msg {
-				return ErrorMsg{Error: err}
-			})
-		}
-
 		_ = tickMsg
 	}
 
@@ -430,6 +637,16 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		downloaderModel, cmd := m.downloaderModel.Update(msg)
 		m.downloaderModel = downloaderModel.(*DownloaderModel)
 		cmds = append(cmds, cmd)
+
+	case TagEditorView:
+		tagEditorModel, cmd := m.tagEditorModel.Update(msg)
+		m.tagEditorModel = tagEditorModel.(*TagEditorModel)
+		cmds = append(cmds, cmd)
+
+	case QueueView:
+		queueModel, cmd := m.queueModel.Update(msg)
+		m.queueModel = queueModel.(*QueueModel)
+		cmds = append(cmds, cmd)
 	}
 
 	return m, tea.Batch(cmds...)
@@ -442,12 +659,25 @@ func (m *Model) handleSongSelection(msg SongSelectedMsg) (tea.Model, tea.Cmd) {
 		m.currentView = PlayerView
 	}
 
-	m.currentSongIndex = m.libraryModel.FindSongIndex(msg.Song)
+	if !msg.FromQueue {
+		orderedSongs := m.libraryModel.GetOrderedSongs()
+		index := m.libraryModel.FindSongIndex(msg.Song)
+		if index < 0 {
+			orderedSongs = []lib.Song{msg.Song}
+			index = 0
+		}
+		m.queue.Replace(orderedSongs, index)
+	}
 
 	libraryModel, _ := m.libraryModel.Update(msg)
 	m.libraryModel = libraryModel.(*LibraryModel)
 
-	if m.SelectedSong != nil && m.SelectedSong.Path == msg.Song.Path {
+	m.advancing = false
+	m.preparedNext = ""
+
+	// Songs coming from the queue always restart, which is how repeat-one
+	// and single-song queues loop.
+	if !msg.FromQueue && m.SelectedSong != nil && m.SelectedSong.Path == msg.Song.Path {
 		playerModel, playerCmd := m.playerModel.Update(msg)
 		m.playerModel = playerModel.(*PlayerModel)
 		return m, playerCmd
@@ -461,19 +691,25 @@ func (m *Model) handleSongSelection(msg SongSelectedMsg) (tea.Model, tea.Cmd) {
 	colorMsg := DominantColorMsg{Color: m.dominantColor}
 	dModel, _ := m.downloaderModel.Update(colorMsg)
 	m.downloaderModel = dModel.(*DownloaderModel)
+	tModel, _ := m.tagEditorModel.Update(colorMsg)
+	m.tagEditorModel = tModel.(*TagEditorModel)
+	qModel, _ := m.queueModel.Update(colorMsg)
+	m.queueModel = qModel.(*QueueModel)
 	lModel, _ := m.libraryModel.Update(colorMsg)
 	m.libraryModel = lModel.(*LibraryModel)
 
-	if err := m.loadAndPlaySong(msg.Song); err != nil {
+	if msg.Continued {
+		playerModel, playerCmd := m.playerModel.Update(msg)
+		m.playerModel = playerModel.(*PlayerModel)
+		cmds = append(cmds, playerCmd)
+	} else if err := m.loadAndPlaySong(msg); err != nil {
 		playerModel, playerCmd := m.playerModel.Update(PlaybackStatusMsg{
 			Error: err,
 		})
 		m.playerModel = playerModel.(*PlayerModel)
 		cmds = append(cmds, playerCmd)
 
-		cmds = append(cmds, func() tea.Msg {
-			return ErrorMsg{Error: err}
-		})
+		cmds = append(cmds, commandError(err))
 	} else {
 		playerModel, playerCmd := m.playerModel.Update(msg)
 		m.playerModel = playerModel.(*PlayerModel)
@@ -483,7 +719,8 @@ func (m *Model) handleSongSelection(msg SongSelectedMsg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-func (m *Model) loadAndPlaySong(song lib.Song) error {
+func (m *Model) loadAndPlaySong(msg SongSelectedMsg) error {
+	song := msg.Song
 
 	if m.AudioPlayer.IsPlaying() {
 		m.AudioPlayer.Stop()
@@ -493,10 +730,27 @@ func (m *Model) loadAndPlaySong(song lib.Song) error {
 		return fmt.Errorf("invalid song path")
 	}
 
-	if err := m.AudioPlayer.Load(song.Path); err != nil {
+	if err := m.AudioPlayer.Load(song.Path, song.Loudness()); err != nil {
 		return fmt.Errorf("failed to load song '%s': %w", song.Title, err)
 	}
 
+	// Scans only read headers, so some formats get their length here.
+	if song.Duration == 0 && !audio.IsStreamURL(song.Path) {
+		if length := m.AudioPlayer.GetTotalLength(); length > 0 {
+			m.library.SetDuration(song.Path, length)
+			m.refreshLibrary()
+		}
+	}
+
+	if msg.Resume {
+		// A position past the end of a file that changed since is simply
+		// ignored.
+		if msg.Position > 0 && msg.Position < m.AudioPlayer.GetTotalLength() {
+			m.AudioPlayer.Seek(msg.Position)
+		}
+		return nil
+	}
+
 	if err := m.AudioPlayer.Play(); err != nil {
 		return fmt.Errorf("failed to play song '%s': %w", song.Title, err)
 	}
@@ -506,6 +760,19 @@ func (m *Model) loadAndPlaySong(song lib.Song) error {
 	return nil
 }
 
+// Song looks a song up in the library by path, for integrations that
+// only get a path from player events. A stream URL is described by its
+// station.
+func (m *Model) Song(path string) *lib.Song {
+	if path == "" {
+		return nil
+	}
+	if audio.IsStreamURL(path) {
+		return m.streamSong(path)
+	}
+	return m.library.GetSong(path)
+}
+
 func (m *Model) GetLastError() error {
 	return m.lastError
 }
@@ -519,6 +786,10 @@ func (m *Model) View() string {
 		base = m.playerModel.View()
 	case DownloaderView:
 		base = m.downloaderModel.View()
+	case TagEditorView:
+		base = m.tagEditorModel.View()
+	case QueueView:
+		base = m.queueModel.View()
 	default:
 		base = "Unknown view"
 	}
@@ -558,6 +829,8 @@ func (m *Model) executeCommand(input string) tea.Cmd {
 			return func() tea.Msg { return SwitchViewMsg{View: PlayerView} }
 		case "d":
 			return func() tea.Msg { return SwitchViewMsg{View: DownloaderView} }
+		case "q":
+			return func() tea.Msg { return SwitchViewMsg{View: QueueView} }
 		}
 	}
 
@@ -594,9 +867,82 @@ func (m *Model) executeCommand(input string) tea.Cmd {
 			return func() tea.Msg { return SwitchViewMsg{View: PlayerView} }
 		case "dl", "downloader", "d":
 			return func() tea.Msg { return SwitchViewMsg{View: DownloaderView} }
+		case "queue", "q":
+			return func() tea.Msg { return SwitchViewMsg{View: QueueView} }
 		}
 		return nil
 
+	case "queue":
+		if len(parts) > 1 && strings.ToLower(parts[1]) == "clear" {
+			m.queue.Clear()
+			return nil
+		}
+		return func() tea.Msg { return SwitchViewMsg{View: QueueView} }
+
+	case "shuffle":
+		if len(parts) > 1 {
+			return m.toggleShuffle(parts[1])
+		}
+		return m.toggleShuffle("")
+
+	case "repeat":
+		if len(parts) > 1 {
+			return m.toggleRepeat(parts[1])
+		}
+		return m.toggleRepeat("")
+
+	case "analyze":
+		if len(parts) > 1 {
+			switch strings.ToLower(parts[1]) {
+			case "all":
+				return m.startAnalysis(true)
+			case "stop":
+				m.stopAnalysis()
+				return nil
+			}
+		}
+		return m.startAnalysis(false)
+
+	case "eq", "equalizer":
+		if len(parts) > 1 {
+			return m.setEQPreset(strings.Join(parts[1:], " "))
+		}
+		m.playerModel.showEQ = !m.playerModel.showEQ
+		if m.playerModel.showEQ {
+			return func() tea.Msg { return SwitchViewMsg{View: PlayerView} }
+		}
+		return nil
+
+	case "speed":
+		return m.setSpeed(parts[1:])
+
+	case "loop":
+		return m.setLoop(parts[1:])
+
+	case "sleep":
+		return m.setSleep(parts[1:])
+
+	case "device":
+		return m.setDevice(parts[1:])
+
+	case "devices":
+		return m.listDevices()
+
+	case "radio":
+		return m.radio(parts[1:])
+
+	case "bookmark", "bm":
+		return m.bookmark(parts[1:])
+
+	case "jump", "goto":
+		return m.jump(parts[1:])
+
+	case "replaygain", "rg":
+		if len(parts) > 1 {
+			return m.setReplayGain(parts[1])
+		}
+		return m.setReplayGain("")
+
 	case "search":
 		if len(parts) < 2 {
 			return nil
@@ -617,9 +963,7 @@ func (m *Model) play() tea.Cmd {
 
 	err := m.AudioPlayer.Play()
 	if err != nil {
-		return func() tea.Msg {
-			return ErrorMsg{Error: err}
-		}
+		return commandError(err)
 	}
 
 	return func() tea.Msg {
@@ -634,9 +978,7 @@ func (m *Model) pause() tea.Cmd {
 
 	err := m.AudioPlayer.Pause()
 	if err != nil {
-		return func() tea.Msg {
-			return ErrorMsg{Error: err}
-		}
+		return commandError(err)
 	}
 
 	return func() tea.Msg {
@@ -648,16 +990,12 @@ func (m *Model) playPause() tea.Cmd {
 	if m.AudioPlayer.IsPlaying() {
 		err := m.AudioPlayer.Pause()
 		if err != nil {
-			return func() tea.Msg {
-				return ErrorMsg{Error: err}
-			}
+			return commandError(err)
 		}
 	} else {
 		err := m.AudioPlayer.Play()
 		if err != nil {
-			return func() tea.Msg {
-				return ErrorMsg{Error: err}
-			}
+			return commandError(err)
 		}
 	}
 
@@ -672,9 +1010,7 @@ func (m *Model) stop() tea.Cmd {
 	if m.AudioPlayer.IsPlaying() {
 		err := m.AudioPlayer.Stop()
 		if err != nil {
-			return func() tea.Msg {
-				return ErrorMsg{Error: err}
-			}
+			return commandError(err)
 		}
 	}
 
@@ -690,46 +1026,192 @@ func (m *Model) stop() tea.Cmd {
 }
 
 func (m *Model) playNextTrack() tea.Cmd {
+	nextSong, ok := m.queue.Next()
+	if !ok {
+		return nil
+	}
+
+	return func() tea.Msg {
+		return SongSelectedMsg{Song: nextSong, KeepView: true, FromQueue: true}
+	}
+}
+
+// advanceTrack moves on when a song ends. It only acts once until the
+// next song has been selected.
+func (m *Model) advanceTrack() tea.Cmd {
+	if m.advancing {
+		return nil
+	}
+	if m.sleepStopsAfterCurrent() {
+		return m.finishSleep(true)
+	}
+
+	var nextSong lib.Song
+	ok := !m.restartsStream()
+	if ok {
+		nextSong, ok = m.queue.Advance()
+	}
+	if !ok {
+		if err := m.AudioPlayer.Stop(); err != nil {
+			return commandError(err)
+		}
+		m.playerModel.updatePlaybackStatus()
+		return nil
+	}
+
+	m.advancing = true
+	return func() tea.Msg {
+		return SongSelectedMsg{Song: nextSong, KeepView: true, FromQueue: true}
+	}
+}
 
-	orderedSongs := m.libraryModel.GetOrderedSongs()
+// prepareNextTrack hands the song the queue will advance to over to the
+// player, so it can follow the current one without a gap.
+func (m *Model) prepareNextTrack() tea.Cmd {
+	if m.SelectedSong == nil || m.advancing {
+		return nil
+	}
 
-	if len(orderedSongs) == 0 || m.currentSongIndex < 0 {
+	// Live streams connect when they start, so they can't be prepared.
+	var path string
+	next, ok := m.queue.PeekAdvance()
+	if ok && !m.sleepStopsAfterCurrent() && !audio.IsStreamURL(next.Path) {
+		path = next.Path
+	}
+	if path == m.preparedNext {
 		return nil
 	}
+	m.preparedNext = path
 
-	nextIndex := m.currentSongIndex + 1
-	if nextIndex >= len(orderedSongs) {
+	if path == "" {
+		m.AudioPlayer.ClearNext()
+		return nil
+	}
 
-		nextIndex = 0
+	player := m.AudioPlayer
+	gapless := continuesAlbum(*m.SelectedSong, next)
+	loudness := next.Loudness()
+	return func() tea.Msg {
+		if err := player.SetNext(path, loudness, gapless); err != nil {
+			log.Printf("Failed to prepare next track: %v", err)
+		}
+		return nil
+	}
+}
+
+// continuesAlbum reports whether next carries on a gapless album, where a
+// crossfade would blur a transition the album means to be seamless.
+func continuesAlbum(current, next lib.Song) bool {
+	if !current.Gapless && !next.Gapless {
+		return false
 	}
+	return current.Album != "" && current.Album != "Unknown Album" && current.Album == next.Album
+}
 
-	m.currentSongIndex = nextIndex
-	nextSong := orderedSongs[nextIndex]
+// followPlayer moves the queue along after the player switched to the
+// prepared track on its own.
+func (m *Model) followPlayer() tea.Cmd {
+	m.preparedNext = ""
 
+	song, ok := m.queue.Advance()
+	if !ok {
+		return nil
+	}
+
+	// The queue may have changed after the track was handed over, in
+	// which case the song it now points at has to be loaded normally.
+	continued := song.Path == m.AudioPlayer.GetCurrentFile()
 	return func() tea.Msg {
-		return SongSelectedMsg{Song: nextSong, KeepView: true}
+		return SongSelectedMsg{Song: song, KeepView: true, FromQueue: true, Continued: continued}
 	}
 }
 
-func (m *Model) playPreviousTrack() tea.Cmd {
+func (m *Model) toggleShuffle(arg string) tea.Cmd {
+	if arg == "" {
+		m.queue.CycleShuffle()
+		return nil
+	}
 
-	orderedSongs := m.libraryModel.GetOrderedSongs()
+	mode, err := queue.ParseShuffleMode(arg)
+	if err != nil {
+		return commandError(err)
+	}
+	m.queue.SetShuffle(mode)
+	return nil
+}
 
-	if len(orderedSongs) == 0 || m.currentSongIndex < 0 {
+func (m *Model) toggleRepeat(arg string) tea.Cmd {
+	if arg == "" {
+		m.queue.CycleRepeat()
 		return nil
 	}
 
-	prevIndex := m.currentSongIndex - 1
-	if prevIndex < 0 {
+	mode, err := queue.ParseRepeatMode(arg)
+	if err != nil {
+		return commandError(err)
+	}
+	m.queue.SetRepeat(mode)
+	return nil
+}
+
+// setReplayGain switches the normalization mode, cycling off, track and
+// album when no mode is given.
+func (m *Model) setReplayGain(arg string) tea.Cmd {
+	config := m.AudioPlayer.ReplayGain()
+	if arg == "" {
+		config.Mode = (config.Mode + 1) % 3
+	} else {
+		mode, err := audio.ParseGainMode(arg)
+		if err != nil {
+			return commandError(err)
+		}
+		config.Mode = mode
+	}
+	m.AudioPlayer.SetReplayGain(config)
+	return nil
+}
+
+// setSpeed takes a speed like 1.25 or 1.25x and/or a speed mode. With no
+// arguments it goes back to normal speed.
+func (m *Model) setSpeed(args []string) tea.Cmd {
+	speed := 1.0
+	if len(args) > 0 {
+		speed = m.AudioPlayer.Speed()
+	}
+	for _, arg := range args {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(arg), "x"), 64)
+		if err == nil {
+			speed = value
+			continue
+		}
+		mode, err := audio.ParseSpeedMode(arg)
+		if err != nil {
+			return commandError(err)
+		}
+		m.AudioPlayer.SetSpeedMode(mode)
+	}
+
+	if err := m.AudioPlayer.SetSpeed(speed); err != nil {
+		return commandError(err)
+	}
+	return nil
+}
 
-		prevIndex = len(orderedSongs) - 1
+func (m *Model) setEQPreset(name string) tea.Cmd {
+	if err := m.AudioPlayer.Equalizer().SetPreset(name); err != nil {
+		return commandError(fmt.Errorf("%w (available: %s)", err, strings.Join(audio.EQPresetNames(), ", ")))
 	}
+	return nil
+}
 
-	m.currentSongIndex = prevIndex
-	prevSong := orderedSongs[prevIndex]
+func (m *Model) playPreviousTrack() tea.Cmd {
+	prevSong, ok := m.queue.Previous()
+	if !ok {
+		return nil
+	}
 
 	return func() tea.Msg {
-		return SongSelectedMsg{Song: prevSong, KeepView: true}
+		return SongSelectedMsg{Song: prevSong, KeepView: true, FromQueue: true}
 	}
 }
 
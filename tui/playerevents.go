@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"kanade/audio"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type PlayerEventMsg struct {
+	Event audio.Event
+}
+
+func (m *Model) listenForPlayerEvents() tea.Cmd {
+	events := m.playerEvents
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return nil
+		}
+		return PlayerEventMsg{Event: event}
+	}
+}
+
+func (m *Model) handlePlayerEvent(event audio.Event) tea.Cmd {
+	cmds := []tea.Cmd{m.listenForPlayerEvents()}
+
+	switch event.Type {
+	case audio.EventStarted, audio.EventPaused, audio.EventStopped, audio.EventTrackLoaded:
+		libraryModel, _ := m.libraryModel.Update(PlaybackStatusMsg{
+			IsPlaying: m.AudioPlayer.IsPlaying(),
+		})
+		m.libraryModel = libraryModel.(*LibraryModel)
+		m.playerModel.updatePlaybackStatus()
+	}
+
+	switch event.Type {
+	case audio.EventTrackLoaded:
+		// Events for a track that was replaced in the meantime are stale.
+		if event.Continued && event.Path == m.AudioPlayer.GetCurrentFile() {
+			cmds = append(cmds, m.followPlayer())
+		}
+
+	case audio.EventFinished:
+		if event.Path == m.AudioPlayer.GetCurrentFile() {
+			cmds = append(cmds, m.advanceTrack())
+		}
+
+	case audio.EventError:
+		cmds = append(cmds, commandError(event.Err))
+	}
+
+	return tea.Batch(cmds...)
+}
@@ -2,11 +2,14 @@ package tui
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"kanade/audio"
 	lib "kanade/library"
+	"kanade/queue"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -27,7 +30,23 @@ type PlayerModel struct {
 	styles           PlayerStyles
 	lastUpdate       time.Time
 	albumArtRenderer *AlbumArtRenderer
-	wasPlaying       bool
+	queue            *queue.Queue
+	showEQ           bool
+	eqBand           int
+	showDevices      bool
+	devices          []audio.Device
+	deviceIndex      int
+	bookmarks        *lib.Bookmarks
+	loopStart        time.Duration
+	loopStartSet     bool
+	sleepStatus      string
+	stream           audio.StreamStatus
+	streaming        bool
+
+	visualizer        visualizerMode
+	visualizerRunning bool
+	visualizerLevels  []float64
+	visualizerWave    []float64
 
 	lastTrackChange  time.Time
 	trackChangeDelay time.Duration
@@ -61,6 +80,10 @@ func NewPlayerModel(audioPlayer *audio.Player) *PlayerModel {
 	}
 }
 
+func (m *PlayerModel) SetQueue(q *queue.Queue) {
+	m.queue = q
+}
+
 func DefaultPlayerStyles() PlayerStyles {
 	return PlayerStyles{
 		Title: lipgloss.NewStyle().
@@ -119,14 +142,15 @@ func (m *PlayerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case SongSelectedMsg:
 		m.currentSong = &msg.Song
 		m.errorMsg = ""
+		m.loopStartSet = false
 		if m.audioPlayer != nil {
 			m.audioPlayer.SetVolume(m.volume)
 		}
 		m.updatePlaybackStatus()
 
-		return m, tea.Tick(TickInterval, func(t time.Time) tea.Msg {
+		return m, tea.Batch(tea.Tick(TickInterval, func(t time.Time) tea.Msg {
 			return TickMsg{Time: t}
-		})
+		}), m.startVisualizer())
 
 	case PlaybackStatusMsg:
 		if msg.Error != nil {
@@ -140,29 +164,42 @@ func (m *PlayerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case TickMsg:
 		if m.audioPlayer != nil && m.currentSong != nil {
 			m.updatePlaybackStatus()
-
-			if m.wasPlaying && !m.isPlaying && m.position >= m.totalDuration-PlaybackEndThreshold {
-				m.wasPlaying = false
-				return m, func() tea.Msg {
-					return SongFinishedMsg{}
-				}
-			}
-			m.wasPlaying = m.isPlaying
 		}
 
 		if m.showVolumeBar && time.Since(m.lastVolumeChange) > VolumeBarTimeout {
 			m.showVolumeBar = false
 		}
 
-		return m, tea.Tick(SlowTickInterval, func(t time.Time) tea.Msg {
+		return m, tea.Batch(tea.Tick(SlowTickInterval, func(t time.Time) tea.Msg {
 			return TickMsg{Time: t}
-		})
+		}), m.startVisualizer())
 
 	case tea.KeyMsg:
 		if m.audioPlayer == nil {
 			return m, nil
 		}
 
+		if msg.String() == "E" {
+			m.showEQ = !m.showEQ
+			m.showDevices = false
+			return m, nil
+		}
+		if m.showEQ && m.handleEQKey(msg) {
+			return m, nil
+		}
+
+		if msg.String() == "D" {
+			if m.showDevices {
+				m.showDevices = false
+			} else if err := m.openDevices(); err != nil {
+				m.errorMsg = err.Error()
+			}
+			return m, nil
+		}
+		if m.showDevices && m.handleDeviceKey(msg) {
+			return m, nil
+		}
+
 		switch msg.String() {
 		case " ", "p":
 			if m.isPlaying {
@@ -229,6 +266,27 @@ func (m *PlayerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return NextTrackMsg{}
 			}
 
+		case ">", ".":
+			m.changeSpeed(m.audioPlayer.Speed() + SpeedStep)
+
+		case "<", ",":
+			m.changeSpeed(m.audioPlayer.Speed() - SpeedStep)
+
+		case "backspace":
+			m.changeSpeed(1)
+
+		case "v":
+			return m, m.toggleVisualizer()
+
+		case "a":
+			m.markLoopStart()
+
+		case "b":
+			m.markLoopEnd()
+
+		case "c":
+			m.clearLoop()
+
 		case "0":
 			err := m.audioPlayer.Seek(0)
 			if err != nil {
@@ -309,6 +367,7 @@ func (m *PlayerModel) updatePlaybackStatus() {
 	m.isPlaying = m.audioPlayer.IsPlaying()
 	m.position = m.audioPlayer.GetPlaybackPosition()
 	m.totalDuration = m.audioPlayer.GetTotalLength()
+	m.stream, m.streaming = m.audioPlayer.StreamStatus()
 	m.lastUpdate = time.Now()
 }
 
@@ -353,15 +412,23 @@ func (m *PlayerModel) View() string {
 		content.WriteString("\n")
 	}
 
-	albumArtLines := strings.SplitSeq(albumArt, "\n")
-	for line := range albumArtLines {
-		if line != "" {
-			centerStyle := lipgloss.NewStyle().
-				Width(m.width).
-				Align(lipgloss.Center)
-			content.WriteString(centerStyle.Render(line))
+	if m.showEQ {
+		content.WriteString(m.renderEqualizer(dominantColor))
+	} else if m.showDevices {
+		content.WriteString(m.renderDevices(dominantColor))
+	} else if m.visualizer != visualizerOff {
+		content.WriteString(m.renderVisualizer(dominantColor))
+	} else {
+		albumArtLines := strings.SplitSeq(albumArt, "\n")
+		for line := range albumArtLines {
+			if line != "" {
+				centerStyle := lipgloss.NewStyle().
+					Width(m.width).
+					Align(lipgloss.Center)
+				content.WriteString(centerStyle.Render(line))
+			}
+			content.WriteString("\n")
 		}
-		content.WriteString("\n")
 	}
 
 	titleStyle := lipgloss.NewStyle().
@@ -376,10 +443,20 @@ func (m *PlayerModel) View() string {
 		Width(m.width).
 		Align(lipgloss.Center).
 		Foreground(lipgloss.Color(dominantColor))
-	content.WriteString(artistStyle.Render(m.currentSong.Artist))
+	content.WriteString(artistStyle.Render(m.artistLine()))
 	content.WriteString("\n\n")
 
-	if m.totalDuration > 0 {
+	if m.streaming {
+		streamStyle := lipgloss.NewStyle().
+			Width(m.width).
+			Align(lipgloss.Center).
+			Foreground(lipgloss.Color(DefaultMutedText))
+		if m.stream.State == audio.StreamPlaying {
+			streamStyle = streamStyle.Foreground(lipgloss.Color(dominantColor)).Bold(true)
+		}
+		content.WriteString(streamStyle.Render(m.streamStatusText()))
+		content.WriteString("\n\n")
+	} else if m.totalDuration > 0 {
 		progressWidth := ProgressBarWidth
 
 		progress := ClampFloat64(float64(m.position)/float64(m.totalDuration), 0.0, 1.0)
@@ -393,6 +470,34 @@ func (m *PlayerModel) View() string {
 		content.WriteString("\n\n")
 	}
 
+	if m.queue != nil {
+		modeStyle := lipgloss.NewStyle().
+			Width(m.width).
+			Align(lipgloss.Center).
+			Foreground(lipgloss.Color(DefaultMutedText))
+		modes := fmt.Sprintf("Shuffle: %s • Repeat: %s", m.queue.Shuffle(), m.queue.Repeat())
+		if m.audioPlayer != nil {
+			modes += fmt.Sprintf(" • ReplayGain: %s", m.audioPlayer.ReplayGain().Mode)
+			if speed := m.audioPlayer.Speed(); speed != 1 {
+				modes += fmt.Sprintf(" • Speed: %sx (%s)", formatSpeed(speed), m.audioPlayer.SpeedMode())
+			}
+		}
+		if m.sleepStatus != "" {
+			modes += " • " + m.sleepStatus
+		}
+		content.WriteString(modeStyle.Render(modes))
+		content.WriteString("\n\n")
+	}
+
+	if marks := m.renderMarks(); marks != "" {
+		marksStyle := lipgloss.NewStyle().
+			Width(m.width).
+			Align(lipgloss.Center).
+			Foreground(lipgloss.Color(dominantColor))
+		content.WriteString(marksStyle.Render(marks))
+		content.WriteString("\n\n")
+	}
+
 	if m.showVolumeBar {
 		volumeWidth := VolumeBarWidth
 		volumeProgress := ClampFloat64(m.volume, 0.0, 1.0)
@@ -428,6 +533,48 @@ func (m *PlayerModel) View() string {
 	return content.String()
 }
 
+// artistLine shows the artist, or for a live stream what the station says
+// is playing.
+func (m *PlayerModel) artistLine() string {
+	if m.streaming {
+		if m.stream.Title != "" {
+			return m.stream.Title
+		}
+		if m.stream.Station != "" {
+			return m.stream.Station
+		}
+	}
+	return m.currentSong.Artist
+}
+
+// streamStatusText takes the place of the progress bar for a live stream.
+func (m *PlayerModel) streamStatusText() string {
+	var text string
+	switch m.stream.State {
+	case audio.StreamConnecting:
+		text = "Connecting…"
+	case audio.StreamBuffering:
+		percent := ClampInt(int(100*m.stream.Buffered/audio.StreamPrebuffer), 0, 100)
+		text = fmt.Sprintf("Buffering %d%%", percent)
+	case audio.StreamPlaying:
+		text = "● LIVE"
+	case audio.StreamReconnecting:
+		text = fmt.Sprintf("Reconnecting (attempt %d)", m.stream.Attempt)
+		if m.stream.Err != nil {
+			text += ": " + m.stream.Err.Error()
+		}
+	case audio.StreamFailed:
+		text = "Stream failed"
+		if m.stream.Err != nil {
+			text += ": " + m.stream.Err.Error()
+		}
+	}
+	if !m.isPlaying && m.stream.State != audio.StreamFailed {
+		text = "○ LIVE"
+	}
+	return TruncateString(text, max(m.width-DefaultPadding*4, 10))
+}
+
 func (m *PlayerModel) generateStableProgressBar(width int, progress float64, dominantColor string) string {
 
 	blocks := []string{"░", "▏", "▎", "▍", "▌", "▋", "▊", "▉", "█"}
@@ -464,3 +611,16 @@ func (m *PlayerModel) generateStableProgressBar(width int, progress float64, dom
 
 	return finalBar.String()
 }
+
+func (m *PlayerModel) changeSpeed(speed float64) {
+	speed = ClampFloat64(math.Round(speed*100)/100, audio.MinSpeed, audio.MaxSpeed)
+	if err := m.audioPlayer.SetSpeed(speed); err != nil {
+		m.errorMsg = err.Error()
+		return
+	}
+	m.errorMsg = ""
+}
+
+func formatSpeed(speed float64) string {
+	return strconv.FormatFloat(speed, 'f', -1, 64)
+}
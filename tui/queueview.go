@@ -0,0 +1,257 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lib "kanade/library"
+	"kanade/queue"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type QueueModel struct {
+	width  int
+	height int
+
+	queue  *queue.Queue
+	cursor int
+
+	errorMsg      string
+	errorTimeout  time.Time
+	currentSong   *lib.Song
+	dominantColor string
+}
+
+func NewQueueModel(q *queue.Queue) *QueueModel {
+	return &QueueModel{
+		queue:         q,
+		dominantColor: DefaultAccentColor,
+	}
+}
+
+func (m *QueueModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *QueueModel) setError(msg string) {
+	m.errorMsg = msg
+	m.errorTimeout = time.Now().Add(ErrorTimeout)
+}
+
+func (m *QueueModel) clampCursor() {
+	if m.cursor >= m.queue.Len() {
+		m.cursor = max(0, m.queue.Len()-1)
+	}
+}
+
+func (m *QueueModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case SongSelectedMsg:
+		m.currentSong = &msg.Song
+		return m, nil
+
+	case DominantColorMsg:
+		m.dominantColor = msg.Color
+		return m, nil
+
+	case TickMsg:
+		if m.errorMsg != "" && time.Now().After(m.errorTimeout) {
+			m.errorMsg = ""
+		}
+		m.clampCursor()
+		return m, tea.Tick(TickInterval, func(t time.Time) tea.Msg {
+			return TickMsg{Time: t}
+		})
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *QueueModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.clampCursor()
+
+	switch msg.String() {
+	case "esc":
+		return m, func() tea.Msg {
+			return SwitchViewMsg{View: LibraryView}
+		}
+
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+
+	case "down", "j":
+		if m.cursor < m.queue.Len()-1 {
+			m.cursor++
+		}
+
+	case "home":
+		m.cursor = 0
+
+	case "end":
+		m.cursor = max(0, m.queue.Len()-1)
+
+	case "enter", " ":
+		if song, ok := m.queue.JumpTo(m.cursor); ok {
+			return m, func() tea.Msg {
+				return SongSelectedMsg{Song: song, KeepView: true, FromQueue: true}
+			}
+		}
+
+	case "d", "delete":
+		if err := m.queue.Remove(m.cursor); err != nil {
+			m.setError(err.Error())
+		}
+		m.clampCursor()
+
+	case "K", "shift+up":
+		if m.cursor > 0 {
+			if err := m.queue.Move(m.cursor, m.cursor-1); err != nil {
+				m.setError(err.Error())
+			} else {
+				m.cursor--
+			}
+		}
+
+	case "J", "shift+down":
+		if m.cursor < m.queue.Len()-1 {
+			if err := m.queue.Move(m.cursor, m.cursor+1); err != nil {
+				m.setError(err.Error())
+			} else {
+				m.cursor++
+			}
+		}
+
+	case "C":
+		m.queue.Clear()
+		m.cursor = 0
+	}
+
+	return m, nil
+}
+
+func (m *QueueModel) View() string {
+	accent := DefaultAccentColor
+	selectedBackground := "#333333"
+	if m.currentSong != nil {
+		accent = Colors.AdjustColorForContrast(m.dominantColor)
+		selectedBackground = Colors.DarkenColor(accent, DarkenFactor)
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultTextColor)).
+		Bold(true).
+		Padding(0, DefaultPadding)
+	normalStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultSecondaryText))
+	playedStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultMutedText))
+	selectedStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultTextColor)).
+		Background(lipgloss.Color(selectedBackground)).
+		Bold(true)
+	helpStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(accent)).
+		Padding(0, DefaultPadding)
+
+	items := m.queue.Items()
+	current := m.queue.CurrentIndex()
+	if m.cursor >= len(items) {
+		m.cursor = max(0, len(items)-1)
+	}
+
+	var content strings.Builder
+
+	for range TopPaddingLines {
+		content.WriteString("\n")
+	}
+
+	content.WriteString(titleStyle.Render("Kanade"))
+	content.WriteString("\n\n")
+
+	var total time.Duration
+	for _, song := range items {
+		total += song.Duration
+	}
+	queueTitle := fmt.Sprintf("Queue (%d songs", len(items))
+	if total > 0 {
+		queueTitle += ", " + FormatDuration(total)
+	}
+	queueTitle += ")"
+	content.WriteString(titleStyle.Render(queueTitle))
+	content.WriteString("\n")
+
+	currentHeight := strings.Count(content.String(), "\n") + 1
+	availableHeight := m.height - currentHeight - HelpBottomReserve
+	boxHeight := availableHeight - DefaultPadding
+	visibleHeight := SafeMax(boxHeight-DefaultPadding, MinVisibleHeight, MinVisibleHeight)
+
+	var list strings.Builder
+	if len(items) == 0 {
+		emptyStyle := lipgloss.NewStyle().
+			Width(m.width - BorderAccountWidth).
+			Align(lipgloss.Center)
+		list.WriteString(emptyStyle.Render(playedStyle.Render("The queue is empty\nPress a in the library to add songs")))
+	} else {
+		start, end := CalculateVisibleRange(len(items), visibleHeight, m.cursor)
+		maxWidth := SafeMax(m.width-BorderAccountWidth-10, ContentMinWidth, ContentMinWidth)
+
+		for i := start; i < end; i++ {
+			song := items[i]
+
+			prefix := "  "
+			if i == current {
+				prefix = "♪ "
+			}
+
+			line := fmt.Sprintf("%s%3d. %s", prefix, i+1, TruncateString(FormatSongInfo(song.Artist, song.Title, song.Path), maxWidth))
+			if song.Duration > 0 {
+				line += "  " + FormatDuration(song.Duration)
+			}
+
+			switch {
+			case i == m.cursor:
+				list.WriteString(selectedStyle.Render(line))
+			case i != current && m.queue.WasPlayed(i):
+				list.WriteString(playedStyle.Render(line))
+			default:
+				list.WriteString(normalStyle.Render(line))
+			}
+			list.WriteString("\n")
+		}
+	}
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(accent)).
+		Width(m.width-BorderAccountWidth).
+		Height(boxHeight).
+		Margin(0, DefaultPadding)
+	content.WriteString(box.Render(list.String()))
+	content.WriteString("\n")
+
+	if m.errorMsg != "" {
+		errorStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(DefaultErrorColor)).
+			Bold(true).
+			Padding(0, DefaultPadding)
+		content.WriteString(errorStyle.Render("Error: " + m.errorMsg))
+	} else {
+		content.WriteString(helpStyle.Render("Enter play • d remove • Shift+↑/↓ move • C clear • Esc back"))
+	}
+	content.WriteString("\n")
+
+	return content.String()
+}
@@ -0,0 +1,227 @@
+package tui
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"kanade/audio"
+	lib "kanade/library"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// StationsChangedMsg reports the stations a :radio add saved, which is done
+// in the background since it can download a playlist.
+type StationsChangedMsg struct {
+	Added []lib.Station
+	Error error
+}
+
+func (m *Model) SetStations(stations *lib.Stations) {
+	m.stations = stations
+	m.refreshStations()
+}
+
+func (m *Model) refreshStations() {
+	if m.stations == nil {
+		return
+	}
+	var songs []lib.Song
+	for _, station := range m.stations.List() {
+		songs = append(songs, *station.Song())
+	}
+	m.libraryModel.SetStations(songs)
+}
+
+// streamSong describes a stream URL, by its station if it is saved and by
+// its host otherwise.
+func (m *Model) streamSong(rawURL string) *lib.Song {
+	if m.stations != nil {
+		if station, ok := m.stations.Find(rawURL); ok {
+			return station.Song()
+		}
+	}
+	return lib.Station{Name: streamHost(rawURL), URL: rawURL}.Song()
+}
+
+func streamHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// radio handles :radio, which shows the stations, :radio add URL [NAME],
+// :radio remove NAME and :radio NAME or URL, which plays it. Stations can
+// also be given by their number in the Radio group.
+func (m *Model) radio(args []string) tea.Cmd {
+	if len(args) == 0 {
+		m.libraryModel.showRadio()
+		return func() tea.Msg { return SwitchViewMsg{View: LibraryView} }
+	}
+	if m.stations == nil {
+		return commandError(fmt.Errorf("stations are not available"))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		if len(args) < 2 {
+			return commandError(fmt.Errorf("usage: radio add <url or playlist> [name]"))
+		}
+		return addStations(m.stations, args[1], strings.Join(args[2:], " "))
+
+	case "remove", "rm", "delete", "del":
+		if len(args) < 2 {
+			return commandError(fmt.Errorf("usage: radio remove <name>"))
+		}
+		station, err := m.findStation(strings.Join(args[1:], " "))
+		if err != nil {
+			return commandError(err)
+		}
+		if _, err := m.stations.Remove(station.URL); err != nil {
+			return commandError(err)
+		}
+		m.refreshStations()
+		m.setStatus(fmt.Sprintf("Removed %s", station.Name))
+		return nil
+	}
+
+	target := strings.Join(args, " ")
+	var song *lib.Song
+	if audio.IsStreamURL(target) {
+		song = m.streamSong(target)
+	} else {
+		station, err := m.findStation(target)
+		if err != nil {
+			return commandError(err)
+		}
+		song = station.Song()
+	}
+	return func() tea.Msg {
+		return SongSelectedMsg{Song: *song}
+	}
+}
+
+// findStation looks a station up by name, URL or number.
+func (m *Model) findStation(target string) (lib.Station, error) {
+	if station, ok := m.stations.Find(target); ok {
+		return station, nil
+	}
+	if n, err := strconv.Atoi(target); err == nil {
+		stations := m.stations.List()
+		if n < 1 || n > len(stations) {
+			return lib.Station{}, fmt.Errorf("no station number %d", n)
+		}
+		return stations[n-1], nil
+	}
+	return lib.Station{}, fmt.Errorf("no station named %q", target)
+}
+
+// addStations saves a stream URL as a station. A remote playlist is kept
+// as it is, since stations often move the streams it lists, while each
+// stream in a local playlist becomes a station of its own.
+func addStations(stations *lib.Stations, target, name string) tea.Cmd {
+	return func() tea.Msg {
+		found, err := resolveStations(target, name)
+		if err != nil {
+			return StationsChangedMsg{Error: err}
+		}
+
+		var added []lib.Station
+		for _, station := range found {
+			station.Name = uniqueStationName(stations, station)
+			if err := stations.Add(station); err != nil {
+				return StationsChangedMsg{Added: added, Error: err}
+			}
+			added = append(added, station)
+		}
+		return StationsChangedMsg{Added: added}
+	}
+}
+
+func resolveStations(target, name string) ([]lib.Station, error) {
+	if audio.IsStreamURL(target) {
+		if name == "" {
+			name = streamHost(target)
+		}
+		if !audio.IsPlaylist(target) {
+			return []lib.Station{{Name: name, URL: target}}, nil
+		}
+
+		// Reading the playlist checks that it works and may name the
+		// station.
+		entries, err := audio.LoadPlaylist(target)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("playlist %s lists no streams", target)
+		}
+		if entries[0].Title != "" && name == streamHost(target) {
+			name = entries[0].Title
+		}
+		return []lib.Station{{Name: name, URL: target}}, nil
+	}
+
+	entries, err := audio.LoadPlaylist(target)
+	if err != nil {
+		return nil, err
+	}
+	var found []lib.Station
+	for _, entry := range entries {
+		if !audio.IsStreamURL(entry.URL) {
+			continue
+		}
+		station := lib.Station{Name: entry.Title, URL: entry.URL}
+		switch {
+		case name != "" && len(found) == 0:
+			station.Name = name
+		case station.Name == "":
+			station.Name = streamHost(entry.URL)
+		}
+		found = append(found, station)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("playlist %s lists no streams", target)
+	}
+	return found, nil
+}
+
+// uniqueStationName numbers a name another station already has, as
+// playlists often give several streams the same title.
+func uniqueStationName(stations *lib.Stations, station lib.Station) string {
+	name := station.Name
+	for i := 2; ; i++ {
+		existing, ok := stations.Find(name)
+		if !ok || existing.URL == station.URL {
+			return name
+		}
+		name = fmt.Sprintf("%s (%d)", station.Name, i)
+	}
+}
+
+// restartsStream reports whether advancing would go straight back to the
+// live stream that just ended. Streams only end when they fail, so it
+// would fail again.
+func (m *Model) restartsStream() bool {
+	current := m.AudioPlayer.GetCurrentFile()
+	next, ok := m.queue.PeekAdvance()
+	return ok && audio.IsStreamURL(current) && next.Path == current
+}
+
+func (m *Model) handleStationsChanged(msg StationsChangedMsg) tea.Cmd {
+	if len(msg.Added) > 0 {
+		m.refreshStations()
+	}
+	switch {
+	case msg.Error != nil:
+		return commandError(msg.Error)
+	case len(msg.Added) == 1:
+		m.setStatus(fmt.Sprintf("Added %s", msg.Added[0].Name))
+	default:
+		m.setStatus(fmt.Sprintf("Added %d stations", len(msg.Added)))
+	}
+	return nil
+}
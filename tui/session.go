@@ -0,0 +1,124 @@
+package tui
+
+import (
+	"slices"
+	"time"
+
+	"kanade/config"
+	lib "kanade/library"
+	"kanade/queue"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SetSessionFile makes the model save its session to path every
+// SessionSaveInterval. SaveSession writes it on demand, e.g. on exit.
+func (m *Model) SetSessionFile(path string) {
+	m.sessionPath = path
+	m.lastSessionSave = time.Now()
+}
+
+func (m *Model) SaveSession() error {
+	if m.sessionPath == "" {
+		return nil
+	}
+	m.lastSessionSave = time.Now()
+	return m.session().Save(m.sessionPath)
+}
+
+func (m *Model) session() *config.Session {
+	session := &config.Session{
+		Song:         m.AudioPlayer.GetCurrentFile(),
+		Volume:       m.playerModel.volume,
+		QueueCurrent: m.queue.CurrentIndex(),
+		Shuffle:      m.queue.Shuffle().String(),
+		Repeat:       m.queue.Repeat().String(),
+		Grouping:     m.libraryModel.groupingMode.String(),
+		View:         m.currentView.String(),
+	}
+	if session.Song != "" {
+		session.Position = m.AudioPlayer.GetPlaybackPosition()
+	}
+	if m.currentView == TagEditorView {
+		session.View = m.previousView.String()
+	}
+
+	for _, song := range m.queue.Items() {
+		session.Queue = append(session.Queue, song.Path)
+	}
+	for name, expanded := range m.libraryModel.expandedGroups {
+		if expanded {
+			session.ExpandedGroups = append(session.ExpandedGroups, name)
+		}
+	}
+	slices.Sort(session.ExpandedGroups)
+
+	return session
+}
+
+// RestoreSession brings back a saved session. Songs that have left the
+// library since are skipped, and the song that was playing is loaded,
+// paused where it was, once the program starts.
+func (m *Model) RestoreSession(session *config.Session) {
+	if session.Volume >= 0 && session.Volume <= 1 {
+		m.playerModel.volume = session.Volume
+		m.AudioPlayer.SetVolume(session.Volume)
+	}
+
+	var songs []lib.Song
+	current := -1
+	for i, path := range session.Queue {
+		song := m.Song(path)
+		if song == nil {
+			continue
+		}
+		if i == session.QueueCurrent {
+			current = len(songs)
+		}
+		songs = append(songs, *song)
+	}
+	if len(songs) > 0 {
+		m.queue.Replace(songs, current)
+	}
+	if mode, err := queue.ParseShuffleMode(session.Shuffle); err == nil {
+		m.queue.SetShuffle(mode)
+	}
+	if mode, err := queue.ParseRepeatMode(session.Repeat); err == nil {
+		m.queue.SetRepeat(mode)
+	}
+
+	if mode, err := ParseGroupingMode(session.Grouping); err == nil {
+		m.libraryModel.groupingMode = mode
+	}
+	for _, name := range session.ExpandedGroups {
+		m.libraryModel.expandedGroups[name] = true
+	}
+	m.libraryModel.rebuildDisplayItems()
+
+	if song := m.Song(session.Song); song != nil {
+		m.resume = &SongSelectedMsg{
+			Song:      *song,
+			KeepView:  true,
+			FromQueue: true,
+			Resume:    true,
+			Position:  session.Position,
+		}
+	}
+
+	view, err := ParseViewState(session.View)
+	if err != nil || view == TagEditorView || (view == PlayerView && m.resume == nil) {
+		view = LibraryView
+	}
+	m.currentView = view
+}
+
+func (m *Model) resumeSession() tea.Cmd {
+	if m.resume == nil {
+		return nil
+	}
+	msg := *m.resume
+	m.resume = nil
+	return func() tea.Msg {
+		return msg
+	}
+}
@@ -0,0 +1,243 @@
+package tui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type sleepMode int
+
+const (
+	sleepAfter sleepMode = iota
+	sleepEndOfTrack
+	sleepEndOfAlbum
+)
+
+type sleepTimer struct {
+	id       int
+	mode     sleepMode
+	deadline time.Time
+	quit     bool
+	fading   bool
+}
+
+type SleepTickMsg struct {
+	id int
+}
+
+// SetSleepOptions sets how long the sleep timer fades out for and whether
+// kanade quits once it has paused.
+func (m *Model) SetSleepOptions(fade time.Duration, quit bool) {
+	m.sleepFade = fade
+	m.sleepQuit = quit
+}
+
+// setSleep handles :sleep 30m, :sleep end-of-track, :sleep end-of-album
+// and :sleep off. Adding quit closes kanade when the timer runs out.
+func (m *Model) setSleep(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return commandError(fmt.Errorf("usage: sleep <duration|end-of-track|end-of-album|off> [quit]"))
+	}
+
+	timer := &sleepTimer{quit: m.sleepQuit}
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "off", "cancel":
+			m.cancelSleep()
+			return nil
+		case "quit", "exit":
+			timer.quit = true
+		case "end-of-track", "track", "eot":
+			timer.mode = sleepEndOfTrack
+		case "end-of-album", "album", "eoa":
+			timer.mode = sleepEndOfAlbum
+		default:
+			delay, err := parseSleepDelay(arg)
+			if err != nil {
+				return commandError(err)
+			}
+			timer.mode = sleepAfter
+			timer.deadline = time.Now().Add(delay)
+		}
+	}
+	if timer.mode == sleepAfter && timer.deadline.IsZero() {
+		return commandError(fmt.Errorf("sleep needs a duration, end-of-track or end-of-album"))
+	}
+
+	m.cancelSleep()
+	m.sleepID++
+	timer.id = m.sleepID
+	m.sleep = timer
+	// Drop a track that was already handed to the player, in case
+	// playback has to stop before it.
+	m.AudioPlayer.ClearNext()
+	m.preparedNext = ""
+	m.playerModel.sleepStatus = m.sleepStatus()
+	return m.sleepTick(timer.id)
+}
+
+// parseSleepDelay reads a Go duration like 1h30m, or a plain number of
+// minutes.
+func parseSleepDelay(s string) (time.Duration, error) {
+	if minutes, err := strconv.ParseFloat(s, 64); err == nil && minutes > 0 {
+		return time.Duration(minutes * float64(time.Minute)), nil
+	}
+	delay, err := time.ParseDuration(s)
+	if err != nil || delay <= 0 {
+		return 0, fmt.Errorf("invalid sleep time %q", s)
+	}
+	return delay, nil
+}
+
+func (m *Model) cancelSleep() {
+	if m.sleep == nil {
+		return
+	}
+	if m.sleep.fading {
+		m.AudioPlayer.ResetFade()
+	}
+	m.sleep = nil
+	m.preparedNext = ""
+	m.playerModel.sleepStatus = ""
+}
+
+func (m *Model) sleepTick(id int) tea.Cmd {
+	return tea.Tick(FastTickInterval, func(time.Time) tea.Msg {
+		return SleepTickMsg{id: id}
+	})
+}
+
+func (m *Model) handleSleepTick(msg SleepTickMsg) tea.Cmd {
+	if m.sleep == nil || m.sleep.id != msg.id {
+		return nil
+	}
+
+	m.playerModel.sleepStatus = m.sleepStatus()
+	remaining, ok := m.sleepRemaining()
+	if !ok {
+		return m.sleepTick(msg.id)
+	}
+
+	switch {
+	case !m.sleep.fading && remaining <= m.sleepFade && m.AudioPlayer.IsPlaying():
+		m.sleep.fading = true
+		m.AudioPlayer.FadeOut(max(remaining, 0))
+	case m.sleep.fading && remaining > m.sleepFade+time.Second:
+		// Seeked back out of the fade.
+		m.sleep.fading = false
+		m.AudioPlayer.ResetFade()
+	}
+
+	// The track based modes end when the player finishes the track.
+	if m.sleep.mode == sleepAfter && remaining <= 0 {
+		return m.finishSleep(false)
+	}
+	return m.sleepTick(msg.id)
+}
+
+// sleepRemaining is the time left on the sleep timer. It is unknown for
+// the track based modes while nothing is loaded.
+func (m *Model) sleepRemaining() (time.Duration, bool) {
+	if m.sleep.mode == sleepAfter {
+		return time.Until(m.sleep.deadline), true
+	}
+	if m.SelectedSong == nil || m.AudioPlayer.GetCurrentFile() == "" {
+		return 0, false
+	}
+
+	remaining := m.AudioPlayer.GetTotalLength() - m.AudioPlayer.GetPlaybackPosition()
+	if m.sleep.mode == sleepEndOfAlbum {
+		items := m.queue.Items()
+		for i := m.queue.CurrentIndex() + 1; i >= 1 && i < len(items); i++ {
+			if items[i].Album != m.SelectedSong.Album {
+				break
+			}
+			remaining += items[i].Duration
+		}
+	}
+	return time.Duration(float64(remaining) / m.AudioPlayer.Speed()), true
+}
+
+// sleepStopsAfterCurrent reports whether playback should stop when the
+// current track ends instead of moving on.
+func (m *Model) sleepStopsAfterCurrent() bool {
+	if m.sleep == nil || m.SelectedSong == nil {
+		return false
+	}
+	switch m.sleep.mode {
+	case sleepEndOfTrack:
+		return true
+	case sleepEndOfAlbum:
+		next, ok := m.queue.PeekAdvance()
+		return !ok || next.Album != m.SelectedSong.Album
+	}
+	return false
+}
+
+// finishSleep pauses playback once the fade is done. At the end of a
+// track the queue still moves on, so the next song is ready, paused, when
+// playback resumes.
+func (m *Model) finishSleep(trackEnded bool) tea.Cmd {
+	quit := m.sleep.quit
+	m.sleep = nil
+	m.preparedNext = ""
+	m.playerModel.sleepStatus = ""
+
+	var cmd tea.Cmd
+	if trackEnded {
+		next, ok := m.queue.Advance()
+		switch {
+		case !ok:
+			m.AudioPlayer.Stop()
+		case quit:
+			// Load it right away so the saved session starts there.
+			if err := m.loadAndPlaySong(SongSelectedMsg{Song: next, Resume: true}); err != nil {
+				log.Printf("Failed to load %s: %v", next.Path, err)
+			}
+		default:
+			m.advancing = true
+			cmd = func() tea.Msg {
+				return SongSelectedMsg{Song: next, KeepView: true, FromQueue: true, Resume: true}
+			}
+		}
+	} else if m.AudioPlayer.IsPlaying() {
+		m.AudioPlayer.Pause()
+	}
+	m.AudioPlayer.ResetFade()
+	m.playerModel.updatePlaybackStatus()
+
+	if quit {
+		return tea.Quit
+	}
+	return cmd
+}
+
+// sleepStatus is the countdown shown in the player view.
+func (m *Model) sleepStatus() string {
+	if m.sleep == nil {
+		return ""
+	}
+
+	var target string
+	switch m.sleep.mode {
+	case sleepEndOfTrack:
+		target = "end of track"
+	case sleepEndOfAlbum:
+		target = "end of album"
+	}
+
+	remaining, ok := m.sleepRemaining()
+	switch {
+	case !ok:
+		return "Sleep: " + target
+	case target != "":
+		return fmt.Sprintf("Sleep: %s (%s)", FormatDuration(remaining), target)
+	default:
+		return "Sleep: " + FormatDuration(remaining)
+	}
+}
@@ -0,0 +1,398 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"kanade/audio"
+	"kanade/config"
+	lib "kanade/library"
+	"kanade/metadata"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	trackPattern = regexp.MustCompile(`^\d+(/\d+)?$`)
+	yearPattern  = regexp.MustCompile(`^\d{4}$`)
+)
+
+type tagField struct {
+	label   string
+	field   metadata.Field
+	value   string
+	initial string
+	mixed   bool
+}
+
+type TagEditorModel struct {
+	width  int
+	height int
+
+	library   *lib.Library
+	songs     []lib.Song
+	groupName string
+	fields    []tagField
+	cursor    int
+	saving    bool
+
+	errorMsg      string
+	errorTimeout  time.Time
+	currentSong   *lib.Song
+	dominantColor string
+}
+
+func NewTagEditorModel(library *lib.Library) *TagEditorModel {
+	return &TagEditorModel{
+		library:       library,
+		dominantColor: DefaultAccentColor,
+	}
+}
+
+func songFieldValue(song lib.Song, field metadata.Field) string {
+	switch field {
+	case metadata.FieldTitle:
+		return song.Title
+	case metadata.FieldArtist:
+		return song.Artist
+	case metadata.FieldAlbum:
+		return song.Album
+	case metadata.FieldAlbumArtist:
+		return song.AlbumArtist
+	case metadata.FieldTrack:
+		if song.TrackNumber > 0 {
+			return strconv.Itoa(song.TrackNumber)
+		}
+	case metadata.FieldYear:
+		if song.Year > 0 {
+			return strconv.Itoa(song.Year)
+		}
+	case metadata.FieldGenre:
+		return song.Genre
+	}
+	return ""
+}
+
+func (m *TagEditorModel) Open(songs []lib.Song, groupName string) {
+	m.songs = songs
+	m.groupName = groupName
+	m.cursor = 0
+	m.saving = false
+	m.errorMsg = ""
+
+	fields := []tagField{
+		{label: "Title", field: metadata.FieldTitle},
+		{label: "Artist", field: metadata.FieldArtist},
+		{label: "Album", field: metadata.FieldAlbum},
+		{label: "Album Artist", field: metadata.FieldAlbumArtist},
+		{label: "Track", field: metadata.FieldTrack},
+		{label: "Year", field: metadata.FieldYear},
+		{label: "Genre", field: metadata.FieldGenre},
+		{label: "Cover Image"},
+	}
+
+	m.fields = m.fields[:0]
+	for _, f := range fields {
+		if len(songs) > 1 && (f.field == metadata.FieldTitle || f.field == metadata.FieldTrack) {
+			continue
+		}
+
+		if f.field != "" && len(songs) > 0 {
+			f.initial = songFieldValue(songs[0], f.field)
+			for _, song := range songs[1:] {
+				if songFieldValue(song, f.field) != f.initial {
+					f.mixed = true
+					f.initial = ""
+					break
+				}
+			}
+			f.value = f.initial
+		}
+		m.fields = append(m.fields, f)
+	}
+}
+
+func (m *TagEditorModel) buildUpdate() (metadata.TagUpdate, error) {
+	update := metadata.TagUpdate{Fields: make(map[metadata.Field]string)}
+
+	for _, f := range m.fields {
+		value := strings.TrimSpace(f.value)
+
+		if f.field == "" {
+			if value != "" {
+				update.CoverPath = config.ExpandHome(value)
+			}
+			continue
+		}
+
+		if value == f.initial || (f.mixed && value == "") {
+			continue
+		}
+
+		switch f.field {
+		case metadata.FieldTrack:
+			if value != "" && !trackPattern.MatchString(value) {
+				return update, fmt.Errorf("track must be a number such as 3 or 3/12")
+			}
+		case metadata.FieldYear:
+			if value != "" && !yearPattern.MatchString(value) {
+				return update, fmt.Errorf("year must be four digits")
+			}
+		}
+
+		update.Fields[f.field] = value
+	}
+
+	return update, nil
+}
+
+func (m *TagEditorModel) save() tea.Cmd {
+	update, err := m.buildUpdate()
+	if err != nil {
+		m.setError(err.Error())
+		return nil
+	}
+
+	if update.Empty() {
+		return func() tea.Msg {
+			return SwitchViewMsg{View: LibraryView}
+		}
+	}
+
+	ffmpegPath := audio.FFmpegPath()
+	if ffmpegPath == "" {
+		m.setError("ffmpeg is required to write tags and is not available yet")
+		return nil
+	}
+
+	m.saving = true
+	songs := m.songs
+	library := m.library
+
+	return func() tea.Msg {
+		var saved []string
+		for _, song := range songs {
+			if err := metadata.WriteTags(ffmpegPath, song.Path, update); err != nil {
+				return TagsSavedMsg{Paths: saved, Error: fmt.Errorf("%s: %w", filepath.Base(song.Path), err)}
+			}
+			if err := library.RefreshSong(song.Path); err != nil {
+				return TagsSavedMsg{Paths: saved, Error: fmt.Errorf("%s: %w", filepath.Base(song.Path), err)}
+			}
+			saved = append(saved, song.Path)
+		}
+
+		if err := library.SaveIndex(); err != nil {
+			return TagsSavedMsg{Paths: saved, Error: err}
+		}
+		return TagsSavedMsg{Paths: saved}
+	}
+}
+
+func (m *TagEditorModel) setError(msg string) {
+	m.errorMsg = msg
+	m.errorTimeout = time.Now().Add(ErrorTimeout)
+}
+
+func (m *TagEditorModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *TagEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case SongSelectedMsg:
+		m.currentSong = &msg.Song
+		return m, nil
+
+	case DominantColorMsg:
+		m.dominantColor = msg.Color
+		return m, nil
+
+	case TagsSavedMsg:
+		m.saving = false
+		if msg.Error != nil {
+			m.setError(msg.Error.Error())
+		}
+		return m, nil
+
+	case TickMsg:
+		if m.errorMsg != "" && time.Now().After(m.errorTimeout) {
+			m.errorMsg = ""
+		}
+		return m, tea.Tick(TickInterval, func(t time.Time) tea.Msg {
+			return TickMsg{Time: t}
+		})
+
+	case tea.KeyMsg:
+		if m.saving {
+			return m, nil
+		}
+		return m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *TagEditorModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.fields) == 0 {
+		return m, nil
+	}
+	field := &m.fields[m.cursor]
+
+	switch msg.String() {
+	case "esc":
+		return m, func() tea.Msg {
+			return SwitchViewMsg{View: LibraryView}
+		}
+
+	case "ctrl+s":
+		return m, m.save()
+
+	case "up", "shift+tab":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		return m, nil
+
+	case "down", "tab", "enter":
+		if m.cursor < len(m.fields)-1 {
+			m.cursor++
+		}
+		return m, nil
+
+	case "ctrl+u":
+		field.value = ""
+		return m, nil
+
+	case "ctrl+r":
+		field.value = field.initial
+		return m, nil
+
+	case "backspace":
+		if len(field.value) > 0 {
+			runes := []rune(field.value)
+			field.value = string(runes[:len(runes)-1])
+		}
+		return m, nil
+
+	default:
+		if msg.Type == tea.KeySpace {
+			field.value += " "
+			return m, nil
+		}
+		for _, r := range msg.Runes {
+			if r == '\n' || r == '\r' || r == '\t' {
+				continue
+			}
+			field.value += string(r)
+		}
+		return m, nil
+	}
+}
+
+func (m *TagEditorModel) View() string {
+	accent := DefaultAccentColor
+	if m.currentSong != nil {
+		accent = Colors.AdjustColorForContrast(m.dominantColor)
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultTextColor)).
+		Bold(true).
+		Padding(0, DefaultPadding)
+	labelStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultSecondaryText)).
+		Width(14)
+	activeLabelStyle := labelStyle.
+		Foreground(lipgloss.Color(accent)).
+		Bold(true)
+	mutedStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(DefaultMutedText))
+	helpStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(accent)).
+		Padding(0, DefaultPadding)
+
+	var content strings.Builder
+
+	for range TopPaddingLines {
+		content.WriteString("\n")
+	}
+
+	content.WriteString(titleStyle.Render("Edit Tags"))
+	content.WriteString("\n")
+
+	var subtitle string
+	switch {
+	case len(m.songs) == 1:
+		subtitle = m.songs[0].Path
+	case m.groupName != "":
+		subtitle = fmt.Sprintf("%d songs in %s", len(m.songs), m.groupName)
+	default:
+		subtitle = fmt.Sprintf("%d songs", len(m.songs))
+	}
+	maxWidth := SafeMax(m.width-BorderAccountWidth, ContentMinWidth, ContentMinWidth)
+	content.WriteString(lipgloss.NewStyle().Padding(0, DefaultPadding).Render(mutedStyle.Render(TruncateString(subtitle, maxWidth))))
+	content.WriteString("\n\n")
+
+	inputWidth := SafeMax(m.width-BorderAccountWidth-18, MinInputWidth, MinInputWidth)
+
+	var form strings.Builder
+	for i, f := range m.fields {
+		value := f.value
+		if value == "" && f.mixed {
+			value = mutedStyle.Render("(multiple values)")
+		} else if value == "" && f.field == "" {
+			value = mutedStyle.Render("(path to image, leave empty to keep)")
+		} else {
+			value = TruncateString(value, inputWidth)
+		}
+
+		label := labelStyle.Render(f.label)
+		if i == m.cursor {
+			label = activeLabelStyle.Render(f.label)
+			if !m.saving && time.Now().UnixMilli()/500%2 == 0 {
+				value += "█"
+			}
+		}
+
+		form.WriteString(label)
+		form.WriteString(" ")
+		form.WriteString(value)
+		form.WriteString("\n")
+	}
+
+	formStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(accent)).
+		Width(m.width-BorderAccountWidth).
+		Padding(0, MinimumPadding).
+		Margin(0, DefaultPadding)
+	content.WriteString(formStyle.Render(strings.TrimSuffix(form.String(), "\n")))
+	content.WriteString("\n\n")
+
+	if m.saving {
+		content.WriteString(helpStyle.Render("Writing tags..."))
+		content.WriteString("\n")
+	} else if m.errorMsg != "" {
+		errorStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(DefaultErrorColor)).
+			Bold(true).
+			Padding(0, DefaultPadding)
+		content.WriteString(errorStyle.Render("Error: " + m.errorMsg))
+		content.WriteString("\n")
+	}
+
+	content.WriteString(helpStyle.Render("↑/↓ select field • Ctrl+S save • Ctrl+U clear • Ctrl+R reset • Esc cancel"))
+	content.WriteString("\n")
+
+	return content.String()
+}
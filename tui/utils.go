@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,25 @@ func FormatDuration(d time.Duration) string {
 	return fmt.Sprintf("%d:%02d", minutes, seconds)
 }
 
+// ParsePosition reads a position in a track written as seconds (83.5),
+// m:ss, h:mm:ss or a Go duration such as 1m23s.
+func ParsePosition(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	var position float64
+	for _, part := range strings.Split(s, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid position %q", s)
+		}
+		position = position*60 + value
+	}
+	return time.Duration(position * float64(time.Second)), nil
+}
+
 func TruncateString(s string, maxWidth int) string {
 	if lipgloss.Width(s) <= maxWidth {
 		return s
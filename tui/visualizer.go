@@ -0,0 +1,238 @@
+package tui
+
+import (
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type visualizerMode int
+
+const (
+	visualizerOff visualizerMode = iota
+	visualizerSpectrum
+	visualizerScope
+)
+
+const (
+	visualizerMinRows  = 8
+	visualizerMaxRows  = 20
+	visualizerMaxWidth = 64
+	// How far a bar can drop per frame, so it falls instead of flickering.
+	visualizerFalloff = 0.06
+	// The oscilloscope shows about 20 ms of audio.
+	visualizerScopeSamples = 1024
+)
+
+var visualizerBlocks = []string{" ", "▁", "▂", "▃", "▄", "▅", "▆", "▇", "█"}
+
+type VisualizerTickMsg struct{}
+
+// toggleVisualizer cycles between the spectrum, the oscilloscope and the
+// album art.
+func (m *PlayerModel) toggleVisualizer() tea.Cmd {
+	m.visualizer = (m.visualizer + 1) % (visualizerScope + 1)
+	m.visualizerLevels = nil
+	m.visualizerWave = nil
+	return m.startVisualizer()
+}
+
+// startVisualizer starts the frame ticks if the visualizer is showing and
+// they aren't already running.
+func (m *PlayerModel) startVisualizer() tea.Cmd {
+	if m.visualizer == visualizerOff || m.visualizerRunning {
+		return nil
+	}
+	m.visualizerRunning = true
+	return visualizerTick()
+}
+
+func visualizerTick() tea.Cmd {
+	return tea.Tick(VisualizerFrameInterval, func(time.Time) tea.Msg {
+		return VisualizerTickMsg{}
+	})
+}
+
+// handleVisualizerTick reads the next frame. The ticks stop while the
+// player view is hidden and start again when it comes back.
+func (m *PlayerModel) handleVisualizerTick(visible bool) tea.Cmd {
+	if m.visualizer == visualizerOff || !visible || m.audioPlayer == nil {
+		m.visualizerRunning = false
+		return nil
+	}
+
+	playing := m.audioPlayer.IsPlaying()
+	switch m.visualizer {
+	case visualizerSpectrum:
+		bars := m.visualizerWidth() / 2
+		levels := make([]float64, bars)
+		if playing {
+			levels = m.audioPlayer.Spectrum(bars)
+		}
+		if len(m.visualizerLevels) != bars {
+			m.visualizerLevels = make([]float64, bars)
+		}
+		for i, level := range levels {
+			m.visualizerLevels[i] = max(level, m.visualizerLevels[i]-visualizerFalloff)
+		}
+
+	case visualizerScope:
+		m.visualizerWave = nil
+		if playing {
+			m.visualizerWave = m.audioPlayer.Waveform(visualizerScopeSamples)
+		}
+	}
+	return visualizerTick()
+}
+
+func (m *PlayerModel) visualizerWidth() int {
+	return ClampInt(m.width-DefaultPadding*4, 2, visualizerMaxWidth)
+}
+
+// visualizerRows matches the height of the album art it replaces, within
+// reason.
+func (m *PlayerModel) visualizerRows() int {
+	return ClampInt(strings.Count(m.cachedAlbumArt, "\n"), visualizerMinRows, visualizerMaxRows)
+}
+
+func (m *PlayerModel) renderVisualizer(dominantColor string) string {
+	rows := m.visualizerRows()
+	var lines []string
+	if m.visualizer == visualizerScope {
+		lines = m.renderScope(rows, dominantColor)
+	} else {
+		lines = m.renderSpectrum(rows, dominantColor)
+	}
+
+	centerStyle := lipgloss.NewStyle().Width(m.width).Align(lipgloss.Center)
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(centerStyle.Render(line))
+		content.WriteString("\n")
+	}
+	content.WriteString("\n")
+	return content.String()
+}
+
+// renderSpectrum draws a bar per band, in eighths of a row. The top third
+// is in the album color and the rest a shade darker.
+func (m *PlayerModel) renderSpectrum(rows int, dominantColor string) []string {
+	peakStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(dominantColor))
+	barStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(Colors.DarkenColor(dominantColor, 0.8)))
+	baseStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(DefaultMutedText))
+
+	bars := m.visualizerWidth() / 2
+	lines := make([]string, 0, rows)
+	for row := rows - 1; row >= 0; row-- {
+		style := barStyle
+		if row >= rows*2/3 {
+			style = peakStyle
+		}
+
+		var line cellRuns
+		for bar := range bars {
+			var level float64
+			if bar < len(m.visualizerLevels) {
+				level = m.visualizerLevels[bar]
+			}
+			eighths := ClampInt(int(level*float64(rows*8))-row*8, 0, 8)
+			cell, cellStyle := visualizerBlocks[eighths], &style
+			if row == 0 && eighths == 0 {
+				cell, cellStyle = "▁", &baseStyle
+			}
+			line.write(cellStyle, cell)
+			// The gap takes the bar's style so it doesn't break the run.
+			if bar < bars-1 {
+				line.write(cellStyle, " ")
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// renderScope draws the waveform with each column covering a slice of the
+// samples, filled between the lowest and highest of them.
+func (m *PlayerModel) renderScope(rows int, dominantColor string) []string {
+	waveStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(dominantColor))
+	axisStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(DefaultMutedText))
+
+	width := m.visualizerWidth()
+	grid := make([][]bool, rows)
+	for row := range grid {
+		grid[row] = make([]bool, width)
+	}
+
+	if len(m.visualizerWave) > 0 {
+		perColumn := max(len(m.visualizerWave)/width, 1)
+		toRow := func(sample float64) int {
+			return ClampInt(int((1-ClampFloat64(sample, -1, 1))/2*float64(rows)), 0, rows-1)
+		}
+		for column := range width {
+			start := column * perColumn
+			if start >= len(m.visualizerWave) {
+				break
+			}
+			low, high := 1.0, -1.0
+			for _, sample := range m.visualizerWave[start:min(start+perColumn, len(m.visualizerWave))] {
+				low, high = min(low, sample), max(high, sample)
+			}
+			for row := toRow(high); row <= toRow(low); row++ {
+				grid[row][column] = true
+			}
+		}
+	}
+
+	lines := make([]string, 0, rows)
+	for row := range grid {
+		var line cellRuns
+		for column := range width {
+			switch {
+			case grid[row][column]:
+				line.write(&waveStyle, "█")
+			case row == rows/2:
+				line.write(&axisStyle, "─")
+			default:
+				line.write(nil, " ")
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// cellRuns builds a line of cells, styling each run of cells that share a
+// style at once. Styling every cell on its own is too slow to redraw many
+// times a second.
+type cellRuns struct {
+	line  strings.Builder
+	run   strings.Builder
+	style *lipgloss.Style
+}
+
+func (c *cellRuns) write(style *lipgloss.Style, cell string) {
+	if style != c.style {
+		c.flush()
+		c.style = style
+	}
+	c.run.WriteString(cell)
+}
+
+func (c *cellRuns) flush() {
+	if c.run.Len() == 0 {
+		return
+	}
+	if c.style != nil {
+		c.line.WriteString(c.style.Render(c.run.String()))
+	} else {
+		c.line.WriteString(c.run.String())
+	}
+	c.run.Reset()
+}
+
+func (c *cellRuns) String() string {
+	c.flush()
+	return c.line.String()
+}
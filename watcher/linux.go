@@ -0,0 +1,209 @@
+//go:build linux
+
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	lib "kanade/library"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO |
+	unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+type backend struct {
+	fd       int
+	watchMu  sync.Mutex
+	watches  map[int]string
+	watchDir map[string]int
+	readDone chan struct{}
+}
+
+func (w *Watcher) startBackend(roots []string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+
+	w.fd = fd
+	w.watches = make(map[int]string)
+	w.watchDir = make(map[string]int)
+	w.readDone = make(chan struct{})
+
+	for _, root := range roots {
+		w.addWatchTree(root, 0)
+	}
+
+	go w.readLoop()
+
+	log.Printf("Watcher: watching %d directories with inotify", len(w.watches))
+	return nil
+}
+
+func (w *Watcher) stopBackend() {
+	<-w.readDone
+	unix.Close(w.fd)
+}
+
+func (w *Watcher) addWatchTree(dir string, depth int) {
+	w.watchMu.Lock()
+	_, exists := w.watchDir[dir]
+	w.watchMu.Unlock()
+	if exists {
+		return
+	}
+
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		log.Printf("Watcher: failed to watch %s: %v", dir, err)
+		return
+	}
+
+	w.watchMu.Lock()
+	w.watches[wd] = dir
+	w.watchDir[dir] = wd
+	w.watchMu.Unlock()
+
+	if w.opts.MaxDepth >= 0 && depth >= w.opts.MaxDepth {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 && w.opts.Symlinks == lib.FollowAllSymlinks {
+			if info, err := os.Stat(path); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+
+		if isDir {
+			w.addWatchTree(path, depth+1)
+		}
+	}
+}
+
+func (w *Watcher) removeWatch(wd int) {
+	w.watchMu.Lock()
+	defer w.watchMu.Unlock()
+
+	if dir, ok := w.watches[wd]; ok {
+		delete(w.watchDir, dir)
+		delete(w.watches, wd)
+	}
+}
+
+func (w *Watcher) depthOf(dir string) int {
+	root := w.library.RootFor(dir)
+	if root == "" {
+		return 0
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+func (w *Watcher) readLoop() {
+	defer close(w.readDone)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, int(settleDelay.Milliseconds()))
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Printf("Watcher: poll failed: %v", err)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		n, err = unix.Read(w.fd, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Printf("Watcher: read failed: %v", err)
+			return
+		}
+
+		w.handleEvents(buf[:n])
+	}
+}
+
+func (w *Watcher) handleEvents(buf []byte) {
+	offset := 0
+	for offset+unix.SizeofInotifyEvent <= len(buf) {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(buf) {
+			return
+		}
+		name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+		offset = nameEnd
+
+		w.watchMu.Lock()
+		dir, ok := w.watches[int(event.Wd)]
+		w.watchMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		if event.Mask&unix.IN_IGNORED != 0 {
+			w.removeWatch(int(event.Wd))
+			continue
+		}
+
+		if event.Mask&unix.IN_DELETE_SELF != 0 {
+			w.notify(dir)
+			continue
+		}
+
+		if name == "" || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		isDir := event.Mask&unix.IN_ISDIR != 0
+		if isDir && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			w.addWatchTree(path, w.depthOf(path))
+		}
+
+		if !isDir && event.Mask == unix.IN_CREATE {
+			// Wait for IN_CLOSE_WRITE so half-written files aren't read.
+			continue
+		}
+
+		w.notify(path)
+	}
+}
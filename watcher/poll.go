@@ -0,0 +1,109 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const pollInterval = 3 * time.Second
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+type backend struct {
+	roots    []string
+	snapshot map[string]fileState
+	pollDone chan struct{}
+}
+
+func (w *Watcher) startBackend(roots []string) error {
+	w.roots = roots
+	w.snapshot = w.takeSnapshot()
+	w.pollDone = make(chan struct{})
+
+	go w.pollLoop()
+
+	log.Printf("Watcher: polling %d library roots every %v", len(roots), pollInterval)
+	return nil
+}
+
+func (w *Watcher) stopBackend() {
+	<-w.pollDone
+}
+
+func (w *Watcher) pollLoop() {
+	defer close(w.pollDone)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			current := w.takeSnapshot()
+
+			for path, state := range current {
+				previous, ok := w.snapshot[path]
+				if !ok || (!state.isDir && (previous.size != state.size || !previous.modTime.Equal(state.modTime))) {
+					w.notify(path)
+				}
+			}
+			for path := range w.snapshot {
+				if _, ok := current[path]; !ok {
+					w.notify(path)
+				}
+			}
+
+			w.snapshot = current
+		}
+	}
+}
+
+func (w *Watcher) takeSnapshot() map[string]fileState {
+	snapshot := make(map[string]fileState)
+
+	for _, root := range w.roots {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if entry.IsDir() {
+				if w.opts.MaxDepth >= 0 && path != root {
+					rel, err := filepath.Rel(root, path)
+					if err == nil && strings.Count(rel, string(filepath.Separator))+1 > w.opts.MaxDepth {
+						return filepath.SkipDir
+					}
+				}
+				snapshot[path] = fileState{isDir: true}
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			snapshot[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+	}
+
+	return snapshot
+}
@@ -0,0 +1,175 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	lib "kanade/library"
+)
+
+const settleDelay = 500 * time.Millisecond
+
+type Change struct {
+	Added   []string
+	Removed []string
+	Updated []string
+}
+
+func (c Change) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Updated) == 0
+}
+
+type Watcher struct {
+	library *lib.Library
+	opts    lib.ScanOptions
+	changes chan Change
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	pending   map[string]bool
+	lastEvent time.Time
+
+	backend
+}
+
+func New(library *lib.Library, opts lib.ScanOptions) *Watcher {
+	return &Watcher{
+		library: library,
+		opts:    opts,
+		changes: make(chan Change, 16),
+		done:    make(chan struct{}),
+		pending: make(map[string]bool),
+	}
+}
+
+func (w *Watcher) Changes() <-chan Change {
+	return w.changes
+}
+
+func (w *Watcher) Start() error {
+	if err := w.startBackend(w.library.ListRoots()); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go w.flushLoop()
+	return nil
+}
+
+func (w *Watcher) Stop() {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	close(w.done)
+	w.wg.Wait()
+	w.stopBackend()
+}
+
+func (w *Watcher) notify(path string) {
+	w.mu.Lock()
+	w.pending[path] = true
+	w.lastEvent = time.Now()
+	w.mu.Unlock()
+}
+
+func (w *Watcher) flushLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(settleDelay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if len(w.pending) == 0 || time.Since(w.lastEvent) < settleDelay {
+				w.mu.Unlock()
+				continue
+			}
+			paths := make([]string, 0, len(w.pending))
+			for path := range w.pending {
+				paths = append(paths, path)
+			}
+			w.pending = make(map[string]bool)
+			w.mu.Unlock()
+
+			sort.Strings(paths)
+			change := w.apply(paths)
+			if change.Empty() {
+				continue
+			}
+
+			select {
+			case w.changes <- change:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// apply brings the library in line with the current state of the given
+// paths, which may be files or directories that were created, modified or
+// removed since the last flush.
+func (w *Watcher) apply(paths []string) Change {
+	var change Change
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if w.library.Contains(path) {
+				w.library.RemoveSong(path)
+				change.Removed = append(change.Removed, path)
+				continue
+			}
+			change.Removed = append(change.Removed, w.library.RemoveDir(path)...)
+			continue
+		}
+
+		if info.IsDir() {
+			for _, song := range w.library.AddDir(path, w.opts) {
+				change.Added = append(change.Added, song.Path)
+			}
+			continue
+		}
+
+		if w.library.Contains(path) {
+			if err := w.library.RefreshSong(path); err != nil {
+				log.Printf("Watcher: failed to refresh %s: %v", path, err)
+				if !w.library.Contains(path) {
+					change.Removed = append(change.Removed, path)
+				}
+				continue
+			}
+			change.Updated = append(change.Updated, path)
+			continue
+		}
+
+		if !lib.IsSupportedAudioFile(path) {
+			continue
+		}
+
+		if _, err := w.library.AddFile(path); err != nil {
+			log.Printf("Watcher: skipping %s: %v", path, err)
+			continue
+		}
+		change.Added = append(change.Added, path)
+	}
+
+	if !change.Empty() {
+		if err := w.library.SaveIndex(); err != nil {
+			log.Printf("Watcher: failed to save library index: %v", err)
+		}
+		log.Printf("Watcher: %d added, %d removed, %d updated", len(change.Added), len(change.Removed), len(change.Updated))
+	}
+
+	return change
+}